@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"huffman-compressor/internal"
+	"os"
+)
+
+// analysisReport is the JSON form of an analysis, with the derived figures
+type analysisReport struct {
+	Path string `json:"path"`
+	internal.Analysis
+	Ratio          float64 `json:"ratio"`
+	HeaderOverhead float64 `json:"header_overhead"`
+	StreamRatio    float64 `json:"stream_ratio"`
+}
+
+// runAnalyze handles: huffman analyze [-json] [-workers N] file...
+func runAnalyze(args []string) {
+	var options codecOptions
+	flags := newCommand("analyze", "[flags] file...")
+	asJSON := flags.Bool("json", false, "Print the figures as JSON")
+	options.workerFlags(flags)
+	paths := parseArgs(flags, args)
+	if len(paths) == 0 {
+		flags.Usage()
+		os.Exit(1)
+	}
+
+	failed := false
+	reports := []analysisReport{}
+	for i, path := range paths {
+		analysis, err := internal.AnalyzeFileWorkers(path, options.workers)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", path, err)
+			failed = true
+			continue
+		}
+		if *asJSON {
+			reports = append(reports, analysisReport{
+				Path:           path,
+				Analysis:       analysis,
+				Ratio:          analysis.Ratio(),
+				HeaderOverhead: analysis.HeaderOverhead(),
+				StreamRatio:    analysis.StreamRatio(),
+			})
+			continue
+		}
+		if i > 0 {
+			fmt.Println()
+		}
+		printAnalysis(path, analysis)
+	}
+
+	if *asJSON {
+		output, err := json.MarshalIndent(reports, "", "  ")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println(string(output))
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+func printAnalysis(path string, a internal.Analysis) {
+	fmt.Printf("%s (sizes for the %s format)\n", path, a.Format)
+	fmt.Printf("  Size:                 %d bytes, %d distinct symbols\n", a.OriginalSize, a.Symbols)
+	fmt.Printf("  Entropy:              %.4f bits/symbol\n", a.Entropy)
+	fmt.Printf("  Average code length:  %.4f bits/symbol\n", a.AverageCodeLength)
+	fmt.Printf("  Redundancy:           %.4f bits/symbol (efficiency %.2f%%)\n", a.Redundancy, a.Efficiency)
+	fmt.Printf("  Payload:              %d bytes, entropy bound %d bytes\n", a.PayloadSize, a.EntropySize)
+	fmt.Printf("  Header overhead:      %d bytes header, %d bytes trailer (%.2f%%)\n",
+		a.HeaderSize, a.TrailerSize, a.HeaderOverhead())
+	fmt.Printf("  Compressed size:      %d bytes (ratio %.2f%%)\n", a.CompressedSize, a.Ratio())
+	if a.CompressedSize < a.OriginalSize {
+		fmt.Printf("  Space saved:          %d bytes\n", a.OriginalSize-a.CompressedSize)
+	} else {
+		fmt.Printf("  Space increased:      %d bytes, Huffman coding doesn't pay off\n", a.CompressedSize-a.OriginalSize)
+	}
+	fmt.Printf("  Stream size:          %d bytes (ratio %.2f%%), as hf compress writes it by default\n",
+		a.StreamSize, a.StreamRatio())
+}
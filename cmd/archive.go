@@ -0,0 +1,141 @@
+package main
+
+import (
+	"fmt"
+	"huffman-compressor/internal"
+	"io"
+	"os"
+)
+
+// runArchive handles: huffman archive [-level N] archive.hfa path...
+func runArchive(args []string) {
+	flags := newCommand("archive", "[-level N] archive.hfa path...")
+	level := flags.Int("level", internal.MinLevel, "Compression level, 1 (fastest) to 9 (smallest)")
+	args = parseArgs(flags, args)
+
+	if len(args) < 2 {
+		flags.Usage()
+		os.Exit(1)
+	}
+	archivePath, paths := args[0], args[1:]
+
+	err := internal.CreateArchive(archivePath, paths, *level)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Archiving failed: %v\n", err)
+		os.Exit(1)
+	}
+
+	entries, err := internal.ListArchive(archivePath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Archive check failed: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("✓ Archived %d entries to %s\n", len(entries), archivePath)
+}
+
+// runExtract handles: huffman extract [-C dir] [-policy P] archive.hfa [entry...]
+func runExtract(args []string) {
+	flags := newCommand("extract", "[-C dir] [-policy error|skip|rename] archive.hfa [entry...]")
+	destDir := flags.String("C", ".", "Directory to extract into")
+	policyName := flags.String("policy", "error", "What to do with unsafe or duplicate entries: error, skip or rename")
+	args = parseArgs(flags, args)
+
+	if len(args) < 1 {
+		flags.Usage()
+		os.Exit(1)
+	}
+	policy, err := internal.ParseExtractPolicy(*policyName)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	options := internal.ExtractOptions{
+		Policy: policy,
+		Notify: func(entry internal.ArchiveEntry, name string, err error) {
+			if name == "" {
+				fmt.Fprintf(os.Stderr, "Warning: skipped %s: %v\n", entry.Path, err)
+			} else {
+				fmt.Fprintf(os.Stderr, "Warning: extracted %s as %s: %v\n", entry.Path, name, err)
+			}
+		},
+	}
+	err = internal.ExtractArchive(args[0], *destDir, args[1:], options)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Extraction failed: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("✓ Extracted %s to %s\n", args[0], *destDir)
+}
+
+// runList handles: huffman list [-l] file...
+func runList(args []string) {
+	flags := newCommand("list", "[-l] archive.hfa | file.hf...")
+	long := flags.Bool("l", false, "Show mode, sizes and modification time")
+	args = parseArgs(flags, args)
+
+	if len(args) < 1 {
+		flags.Usage()
+		os.Exit(1)
+	}
+	if isArchive(args[0]) {
+		if len(args) != 1 {
+			flags.Usage()
+			os.Exit(1)
+		}
+		listArchive(args[0], *long)
+		return
+	}
+
+	// Compressed files get one line each, like gzip -l
+	failed := false
+	fmt.Printf("%12s %12s %8s  %s\n", "compressed", "original", "ratio", "name")
+	for _, path := range args {
+		info, err := internal.GetCompressedInfo(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", path, err)
+			failed = true
+			continue
+		}
+		fmt.Printf("%12d %12d %7.2f%%  %s\n", info.CompressedSize, info.OriginalSize, info.Ratio(), path)
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// isArchive reports whether path starts with the archive magic number
+func isArchive(path string) bool {
+	file, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+	magic := make([]byte, len(internal.ArchiveMagic))
+	_, err = io.ReadFull(file, magic)
+	return err == nil && string(magic) == internal.ArchiveMagic
+}
+
+func listArchive(path string, long bool) {
+	entries, err := internal.ListArchive(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Listing failed: %v\n", err)
+		os.Exit(1)
+	}
+
+	for _, entry := range entries {
+		name := entry.Path
+		switch entry.Type {
+		case internal.EntryDir:
+			name += "/"
+		case internal.EntrySymlink:
+			name += " -> " + entry.Link
+		}
+		if !long {
+			fmt.Println(name)
+			continue
+		}
+		fmt.Printf("%-7s %04o %10d %10d %s %s\n", entry.Type, uint32(entry.Mode), entry.Size,
+			entry.CompressedSize, entry.ModTime.Format("2006-01-02 15:04"), name)
+	}
+}
@@ -0,0 +1,326 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"huffman-compressor/internal"
+	"io"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// codecOptions are the flags shared by the compress and decompress commands
+// and the flag based command line
+type codecOptions struct {
+	toStdout  bool
+	force     bool
+	keep      bool
+	verify    bool
+	blockSize int
+	sha256    bool
+	adaptive  bool
+	lz77      bool
+	index     bool
+	levels    [internal.MaxLevel + 1]bool
+	maxOutput uint64
+	maxRatio  float64
+	workers   int
+	byteRange string
+}
+
+func (o *codecOptions) outputFlags(flags *flag.FlagSet) {
+	flags.BoolVar(&o.toStdout, "c", false, "Write to stdout, same as -output -")
+	flags.BoolVar(&o.force, "force", false, "Overwrite an existing output file")
+	flags.BoolVar(&o.force, "f", false, "Short for -force")
+}
+
+// keepFlags adds -k, only the compress and decompress commands delete their
+// input. The flag based command line always keeps it.
+func (o *codecOptions) keepFlags(flags *flag.FlagSet) {
+	flags.BoolVar(&o.keep, "keep", false, "Keep the input file, it is deleted after success otherwise")
+	flags.BoolVar(&o.keep, "k", false, "Short for -keep")
+}
+
+func (o *codecOptions) compressFlags(flags *flag.FlagSet) {
+	flags.BoolVar(&o.verify, "verify", false, "After compressing, decode the output and check it against its checksums")
+	flags.IntVar(&o.blockSize, "block-size", internal.DefaultBlockSize, "Bytes of input encoded with one frequency table")
+	flags.BoolVar(&o.sha256, "sha256", false, "Also store a SHA-256 of the original data")
+	flags.BoolVar(&o.adaptive, "adaptive", false, "Use adaptive Huffman codes, no code tables are stored")
+	flags.BoolVar(&o.lz77, "lz77", false, "Replace repeated strings with back references before Huffman coding")
+	flags.BoolVar(&o.index, "index", false, "Append a block index so byte ranges can be decoded without the blocks before them")
+
+	// -1 (fastest) to -9 (smallest), like gzip
+	for level := internal.MinLevel; level <= internal.MaxLevel; level++ {
+		flags.BoolVar(&o.levels[level], fmt.Sprint(level), false, fmt.Sprintf("Compress at level %d", level))
+	}
+}
+
+func (o *codecOptions) limitFlags(flags *flag.FlagSet) {
+	flags.Uint64Var(&o.maxOutput, "max-output", 0, "Abort decompression past this many output bytes (0 for no limit)")
+	flags.Float64Var(&o.maxRatio, "max-ratio", 0, "Abort decompression past this many output bytes per input byte (0 for no limit)")
+}
+
+func (o *codecOptions) rangeFlags(flags *flag.FlagSet) {
+	flags.StringVar(&o.byteRange, "range", "", "Decode only the bytes START:END of the original data, either side can be left out")
+}
+
+// workerFlags adds -workers, blocks are coded on every CPU by default
+func (o *codecOptions) workerFlags(flags *flag.FlagSet) {
+	flags.IntVar(&o.workers, "workers", runtime.GOMAXPROCS(0), "Blocks coded at once, the output is the same for any number")
+}
+
+// level returns the level picked with -1 to -9, 0 for none, and checks it
+// doesn't clash with the other coding flags
+func (o *codecOptions) level() (int, error) {
+	level := 0
+	for l := internal.MinLevel; l <= internal.MaxLevel; l++ {
+		if !o.levels[l] {
+			continue
+		}
+		if level != 0 {
+			return 0, fmt.Errorf("provide only one compression level")
+		}
+		level = l
+	}
+	if o.adaptive && o.lz77 {
+		return 0, fmt.Errorf("provide either adaptive or lz77 option, not both")
+	}
+	if level != 0 && (o.adaptive || o.lz77) {
+		return 0, fmt.Errorf("a compression level already picks the coding, drop adaptive and lz77")
+	}
+	return level, nil
+}
+
+func (o *codecOptions) streamFlags() uint8 {
+	flags := internal.DefaultFlags
+	if o.sha256 {
+		flags |= internal.FlagSHA256
+	}
+	if o.adaptive {
+		flags |= internal.FlagAdaptive
+	}
+	if o.lz77 {
+		flags |= internal.FlagLZ77
+	}
+	if o.index {
+		flags |= internal.FlagIndex
+	}
+	return flags
+}
+
+func (o *codecOptions) limits() (internal.DecodeLimits, error) {
+	if o.maxRatio < 0 {
+		return internal.DecodeLimits{}, fmt.Errorf("-max-ratio can't be negative")
+	}
+	return internal.DecodeLimits{MaxOutputSize: o.maxOutput, MaxRatio: o.maxRatio}, nil
+}
+
+// codecJob turns one input into one output, either can be "-"
+type codecJob struct {
+	input      string
+	output     string
+	decompress bool
+	level      int
+	options    *codecOptions
+	verbose    bool // print progress and statistics
+}
+
+// run checks the job against -f, writes the output and deletes the input
+// afterwards unless -k was given
+func (job codecJob) run() error {
+	var inputInfo os.FileInfo
+	if job.input != stdio {
+		var err error
+		inputInfo, err = os.Stat(job.input)
+		if err != nil {
+			return err
+		}
+	}
+
+	if job.output == stdio {
+		if !job.decompress && isTerminal(os.Stdout) && !job.options.force {
+			return fmt.Errorf("refusing to write compressed data to a terminal, use -f to force")
+		}
+		if job.options.verify {
+			return fmt.Errorf("-verify needs an output file to read back")
+		}
+	} else if outputInfo, err := os.Stat(job.output); err == nil {
+		// Like gzip, never clobber a file unless asked to
+		if inputInfo != nil && os.SameFile(inputInfo, outputInfo) {
+			return fmt.Errorf("%s is both input and output", job.output)
+		}
+		if !job.options.force {
+			return fmt.Errorf("%s already exists, use -f to overwrite", job.output)
+		}
+	}
+
+	var err error
+	if job.decompress {
+		err = job.runDecompress()
+	} else {
+		err = job.runCompress()
+	}
+	if err != nil {
+		return err
+	}
+
+	// The input is deleted once it was turned into an output file, a
+	// range is only part of it
+	if !job.options.keep && job.input != stdio && job.output != stdio && job.options.byteRange == "" {
+		removeSource(job.input)
+	}
+	return nil
+}
+
+func (job codecJob) runCompress() error {
+	flags := job.options.streamFlags()
+	if job.input == stdio || job.output == stdio {
+		return pipeCompress(job.input, job.output, job.options.blockSize, job.level, flags, job.options.workers)
+	}
+
+	if job.verbose {
+		fmt.Printf("Compressing %s to %s...\n", job.input, job.output)
+	}
+	// Single pass, one frequency table per block
+	err := internal.CompressFileWorkers(job.input, job.output, job.options.blockSize, job.level, flags, job.options.workers)
+	if err != nil {
+		return fmt.Errorf("compression failed: %w", err)
+	}
+
+	if job.options.verify {
+		if job.verbose {
+			fmt.Println("Verifying round trip...")
+		}
+		// The stored checksums were computed from the input while it was
+		// compressed, so decoding them back proves the round trip
+		err = internal.VerifyCompressedFile(job.output)
+		if err != nil {
+			return fmt.Errorf("verification failed: %w", err)
+		}
+		if job.verbose {
+			fmt.Println("✓ Round trip verified")
+		}
+	}
+
+	if job.verbose {
+		stats, err := internal.GetCompressionStats(job.input, job.output)
+		if err == nil {
+			internal.PrintCompressionStats(stats)
+		}
+		fmt.Printf("✓ Successfully compressed to %s\n", job.output)
+	}
+	return nil
+}
+
+func (job codecJob) runDecompress() error {
+	limits, err := job.options.limits()
+	if err != nil {
+		return err
+	}
+	if job.options.byteRange != "" {
+		return job.runRange()
+	}
+	if job.input == stdio || job.output == stdio {
+		return pipeDecompress(job.input, job.output, limits, job.options.workers)
+	}
+
+	if job.verbose {
+		fmt.Printf("Decompressing %s to %s...\n", job.input, job.output)
+	}
+	err = internal.DecompressWorkers(job.input, job.output, limits, job.options.workers)
+	if err != nil {
+		return fmt.Errorf("decompression failed: %w", err)
+	}
+
+	if job.verbose {
+		// Stats are computed the same way as for compression: the
+		// decompressed file is the original, the input is the compressed one
+		stats, err := internal.GetCompressionStats(job.output, job.input)
+		if err == nil {
+			internal.PrintCompressionStats(stats)
+		}
+		fmt.Printf("✓ Successfully decompressed to %s\n", job.output)
+	}
+	return nil
+}
+
+// runRange decodes only the blocks holding the bytes picked with -range
+func (job codecJob) runRange() error {
+	if job.input == stdio {
+		return fmt.Errorf("-range needs a file to seek in, not stdin")
+	}
+	reader, file, err := internal.OpenSeekable(job.input)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	start, end, err := parseRange(job.options.byteRange, reader.Size())
+	if err != nil {
+		return err
+	}
+	output, finish, err := createOutput(job.output)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(output, io.NewSectionReader(reader, start, end-start))
+	if err != nil {
+		err = fmt.Errorf("failed to decode range: %w", err)
+	}
+	return errors.Join(err, finish(err == nil))
+}
+
+// parseRange parses "START:END" into offsets within size. START defaults
+// to 0 and END to size, an END past size stops at size.
+func parseRange(byteRange string, size int64) (int64, int64, error) {
+	first, last, found := strings.Cut(byteRange, ":")
+	if !found {
+		return 0, 0, fmt.Errorf("invalid range %q, use START:END", byteRange)
+	}
+	start, end := int64(0), size
+	var err error
+	if first != "" {
+		start, err = strconv.ParseInt(first, 10, 64)
+	}
+	if err == nil && last != "" {
+		end, err = strconv.ParseInt(last, 10, 64)
+	}
+	if err != nil || start < 0 || end < start {
+		return 0, 0, fmt.Errorf("invalid range %q, use START:END", byteRange)
+	}
+	if start > size {
+		return 0, 0, fmt.Errorf("range starts at %d, past the %d bytes of data", start, size)
+	}
+	return start, min(end, size), nil
+}
+
+// removeSource deletes an input file after its output was written
+func removeSource(path string) {
+	err := os.Remove(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to delete %s: %v\n", path, err)
+	}
+}
+
+// compressedName is the default output name for compressing path
+func compressedName(path string) (string, error) {
+	if strings.HasSuffix(path, suffix) {
+		return "", fmt.Errorf("%s already has the %s suffix", path, suffix)
+	}
+	return path + suffix, nil
+}
+
+// decompressedName is the default output name for decompressing path
+func decompressedName(path string) (string, error) {
+	name, found := strings.CutSuffix(path, suffix)
+	if !found || name == "" {
+		return "", fmt.Errorf("%s: unknown suffix, name the output with -o", path)
+	}
+	return name, nil
+}
+
+// suffix is added to compressed file names
+const suffix = ".hf"
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"huffman-compressor/internal"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// newCommand returns the flag set of a command, printing usage and its
+// flags on -h
+func newCommand(name, usage string) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: huffman "+name+" "+usage)
+		flags.PrintDefaults()
+	}
+	return flags
+}
+
+// parseArgs parses flags placed anywhere among the file names, not only
+// before them, and returns the file names
+func parseArgs(flags *flag.FlagSet, args []string) []string {
+	var files []string
+	args = expandShortFlags(args)
+	for {
+		flags.Parse(args)
+		rest := flags.Args()
+		// Everything after "--" is a file name
+		if parsed := len(args) - len(rest); parsed > 0 && args[parsed-1] == "--" {
+			return append(files, rest...)
+		}
+		if len(rest) == 0 {
+			return files
+		}
+		files = append(files, rest[0])
+		args = rest[1:]
+	}
+}
+
+// runCodecCommand handles compress and decompress: every file is turned
+// into a file named with or without the .hf suffix, no files means stdin
+// to stdout
+func runCodecCommand(name string, args []string, decompress bool) {
+	var options codecOptions
+	flags := newCommand(name, "[flags] [file...]")
+	output := flags.String("o", "", "Output file, only with a single input")
+	verbose := flags.Bool("v", false, "Print progress and statistics")
+	options.outputFlags(flags)
+	options.keepFlags(flags)
+	options.workerFlags(flags)
+	if decompress {
+		options.limitFlags(flags)
+		options.rangeFlags(flags)
+	} else {
+		options.compressFlags(flags)
+	}
+	inputs := parseArgs(flags, args)
+
+	level, err := options.level()
+	if err != nil {
+		commandError(flags, err)
+	}
+	if len(inputs) == 0 {
+		inputs = []string{stdio}
+	}
+	if len(inputs) > 1 && (*output != "" || options.toStdout) {
+		commandError(flags, fmt.Errorf("-o and -c take a single input file"))
+	}
+	if options.toStdout && *output != "" {
+		commandError(flags, fmt.Errorf("provide either -c or -o, not both"))
+	}
+
+	failed := false
+	for _, input := range inputs {
+		job := codecJob{input: input, decompress: decompress, level: level, options: &options}
+		switch {
+		case *output != "":
+			job.output = *output
+		case options.toStdout || input == stdio || options.byteRange != "":
+			// A range goes to stdout unless named with -o
+			job.output = stdio
+		case decompress:
+			job.output, err = decompressedName(input)
+		default:
+			job.output, err = compressedName(input)
+		}
+		job.verbose = *verbose && job.output != stdio
+
+		if err == nil {
+			err = job.run()
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", input, err)
+			failed = true
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+func runCompressCommand(args []string) {
+	runCodecCommand("compress", args, false)
+}
+
+func runDecompressCommand(args []string) {
+	runCodecCommand("decompress", args, true)
+}
+
+// runInfo handles: huffman info file...
+func runInfo(args []string) {
+	flags := newCommand("info", "file...")
+	paths := parseArgs(flags, args)
+	if len(paths) == 0 {
+		flags.Usage()
+		os.Exit(1)
+	}
+
+	failed := false
+	for i, path := range paths {
+		if i > 0 {
+			fmt.Println()
+		}
+		info, err := internal.GetCompressedInfo(path)
+		printInfo(path, info)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", path, err)
+			failed = true
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// printInfo prints whatever part of info could be read
+func printInfo(path string, info internal.CompressedInfo) {
+	fmt.Println(path)
+	if info.Format == "" {
+		return
+	}
+	fmt.Printf("  Format:           %s version %d\n", info.Format, info.Version)
+	fmt.Printf("  Flags:            %s\n", internal.FlagNames(info.Flags))
+	if info.Format == "stream" {
+		if info.Level != 0 {
+			fmt.Printf("  Level:            %d\n", info.Level)
+		}
+		fmt.Printf("  Blocks:           %d\n", info.Blocks)
+	} else {
+		fmt.Printf("  Symbols:          %d\n", info.Symbols)
+		fmt.Printf("  Padding bits:     %d\n", info.PaddingBits)
+	}
+	fmt.Printf("  Original size:    %d bytes\n", info.OriginalSize)
+	fmt.Printf("  Compressed size:  %d bytes\n", info.CompressedSize)
+	if info.IndexSize > 0 {
+		fmt.Printf("  Header overhead:  %d bytes header, %d bytes trailer, %d bytes index (%.2f%%)\n",
+			info.HeaderSize, info.TrailerSize, info.IndexSize, info.Overhead())
+	} else {
+		fmt.Printf("  Header overhead:  %d bytes header, %d bytes trailer (%.2f%%)\n",
+			info.HeaderSize, info.TrailerSize, info.Overhead())
+	}
+	fmt.Printf("  Payload:          %d bytes\n", info.PayloadSize)
+	fmt.Printf("  Ratio:            %.2f%%\n", info.Ratio())
+}
+
+// runTest handles: huffman test [-max-output N] [-max-ratio X] file...
+func runTest(args []string) {
+	var options codecOptions
+	flags := newCommand("test", "[flags] file...")
+	options.limitFlags(flags)
+	paths := parseArgs(flags, args)
+	if len(paths) == 0 {
+		flags.Usage()
+		os.Exit(1)
+	}
+	limits, err := options.limits()
+	if err != nil {
+		commandError(flags, err)
+	}
+
+	failed := false
+	for _, path := range paths {
+		err := internal.VerifyCompressedFileLimits(path, limits)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", path, err)
+			failed = true
+			continue
+		}
+		fmt.Printf("%s: OK\n", path)
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// runBench handles: huffman bench [-levels 1,6,9] [-block-size N] [-workers N] file
+func runBench(args []string) {
+	var options codecOptions
+	flags := newCommand("bench", "[flags] file")
+	levelList := flags.String("levels", "1-9", "Levels to run, as a list like 1,6,9 or a range like 1-9")
+	blockSize := flags.Int("block-size", internal.DefaultBlockSize, "Bytes of input encoded with one frequency table")
+	options.workerFlags(flags)
+	paths := parseArgs(flags, args)
+	if len(paths) != 1 {
+		flags.Usage()
+		os.Exit(1)
+	}
+	levels, err := parseLevels(*levelList)
+	if err != nil {
+		commandError(flags, err)
+	}
+
+	data, err := os.ReadFile(paths[0])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("%s: %d bytes\n", paths[0], len(data))
+	fmt.Printf("%5s %12s %8s %14s %14s\n", "Level", "Compressed", "Ratio", "Compress", "Decompress")
+	for _, level := range levels {
+		result, err := internal.Benchmark(data, level, *blockSize, options.workers)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Level %d failed: %v\n", level, err)
+			os.Exit(1)
+		}
+		fmt.Printf("%5d %12d %7.2f%% %9.2f MB/s %9.2f MB/s\n", level, result.CompressedSize,
+			result.Ratio(), result.CompressSpeed(), result.DecompressSpeed())
+	}
+}
+
+// parseLevels parses "1,6,9" or "1-9"
+func parseLevels(list string) ([]int, error) {
+	var levels []int
+	for _, part := range strings.Split(list, ",") {
+		first, last, isRange := strings.Cut(part, "-")
+		low, err := strconv.Atoi(first)
+		high := low
+		if err == nil && isRange {
+			high, err = strconv.Atoi(last)
+		}
+		if err != nil || low > high || low < internal.MinLevel || high > internal.MaxLevel {
+			return nil, fmt.Errorf("invalid levels %q, use levels %d to %d", part, internal.MinLevel, internal.MaxLevel)
+		}
+		for level := low; level <= high; level++ {
+			levels = append(levels, level)
+		}
+	}
+	return levels, nil
+}
+
+func commandError(flags *flag.FlagSet, err error) {
+	fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+	flags.Usage()
+	os.Exit(1)
+}
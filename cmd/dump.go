@@ -0,0 +1,34 @@
+package main
+
+import (
+	"fmt"
+	"huffman-compressor/internal"
+	"math"
+	"os"
+)
+
+// runDump handles: huffman dump [-range START:END] file
+func runDump(args []string) {
+	flags := newCommand("dump", "[flags] file")
+	symbolRange := flags.String("range", "", "List only the symbols START:END, 0-based byte offsets of the original data; either side may be empty")
+	paths := parseArgs(flags, args)
+	if len(paths) != 1 {
+		flags.Usage()
+		os.Exit(1)
+	}
+
+	start, end := int64(0), int64(math.MaxInt64)
+	if *symbolRange != "" {
+		var err error
+		start, end, err = parseRange(*symbolRange, math.MaxInt64)
+		if err != nil {
+			commandError(flags, err)
+		}
+	}
+
+	err := internal.DumpFile(paths[0], os.Stdout, uint64(start), uint64(end))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", paths[0], err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+	"huffman-compressor/internal"
+	"os"
+)
+
+// runInspect handles: huffman inspect [-format dot|json|csv] [-block N] file
+func runInspect(args []string) {
+	flags := newCommand("inspect", "[flags] file")
+	format := flags.String("format", "csv", "Output format: dot (Graphviz tree), json (codes and tree) or csv (codes)")
+	block := flags.Int("block", 0, "Block of a framed stream to show the codes of, counted from 0")
+	paths := parseArgs(flags, args)
+	if len(paths) != 1 {
+		flags.Usage()
+		os.Exit(1)
+	}
+	if *block < 0 {
+		commandError(flags, fmt.Errorf("invalid block %d", *block))
+	}
+
+	root, codeTable, err := internal.FileCodes(paths[0], *block)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", paths[0], err)
+		os.Exit(1)
+	}
+
+	switch *format {
+	case "dot":
+		err = internal.WriteTreeDOT(os.Stdout, root)
+	case "json":
+		err = internal.WriteCodesJSON(os.Stdout, root, codeTable)
+	case "csv":
+		err = internal.WriteCodesCSV(os.Stdout, root, codeTable)
+	default:
+		commandError(flags, fmt.Errorf("unknown format %q, use dot, json or csv", *format))
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+}
@@ -7,71 +7,179 @@ import (
 	"os"
 )
 
+const usage = `Usage: huffman <command> [flags] [file...]
+
+Commands:
+  compress    Compress files, or stdin to stdout
+  decompress  Decompress files, or stdin to stdout
+  info        Print the headers of compressed files without decoding them
+  test        Decode compressed files and verify their checksums
+  list        List the entries of an archive, or the sizes of compressed files
+  bench       Measure compression ratio and speed on a file
+  analyze     Compare the Huffman codes of files with their entropy
+  inspect     Export the Huffman tree and codes of a file as DOT, JSON or CSV
+  dump        Show the header fields and the code of every symbol of a compressed file
+  archive     Pack files and directories into an archive
+  extract     Unpack an archive
+
+Run "huffman <command> -h" for the flags of a command. The flag based
+command line (huffman -compress -input file ...) still works.
+`
+
 func main() {
+	if len(os.Args) > 1 {
+		args := os.Args[2:]
+		switch os.Args[1] {
+		case "compress":
+			runCompressCommand(args)
+			return
+		case "decompress":
+			runDecompressCommand(args)
+			return
+		case "info":
+			runInfo(args)
+			return
+		case "test":
+			runTest(args)
+			return
+		case "list":
+			runList(args)
+			return
+		case "bench":
+			runBench(args)
+			return
+		case "analyze":
+			runAnalyze(args)
+			return
+		case "inspect":
+			runInspect(args)
+			return
+		case "dump":
+			runDump(args)
+			return
+		case "archive":
+			runArchive(args)
+			return
+		case "extract":
+			runExtract(args)
+			return
+		case "help":
+			fmt.Print(usage)
+			return
+		}
+	}
+
+	runFlags(os.Args[1:])
+}
+
+// runFlags handles the flag based command line, where -compress and
+// -decompress pick the mode and -input/-output name the files
+func runFlags(args []string) {
+	var options codecOptions
 	var (
-		inputFile  = flag.String("input", "", "Input file to compress/decompress")
-		outputFile = flag.String("output", "", "Output file")
+		inputFile  = flag.String("input", "", "Input file to compress/decompress, - for stdin")
+		outputFile = flag.String("output", "", "Output file, - for stdout")
 		compress   = flag.Bool("compress", false, "Compress the input file")
 		decompress = flag.Bool("decompress", false, "Decompress the input file")
 	)
+	options.outputFlags(flag.CommandLine)
+	flag.BoolVar(&options.keep, "keep", true, "The input file is always kept, accepted for compatibility")
+	flag.BoolVar(&options.keep, "k", true, "Short for -keep")
+	options.compressFlags(flag.CommandLine)
+	options.limitFlags(flag.CommandLine)
+	options.rangeFlags(flag.CommandLine)
+	options.workerFlags(flag.CommandLine)
+
+	// gzip style short forms, combinable as in -dc
+	flag.BoolVar(compress, "z", false, "Short for -compress")
+	flag.BoolVar(decompress, "d", false, "Short for -decompress")
 
-	flag.Parse()
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), usage, "\nFlags without a command:\n")
+		flag.PrintDefaults()
+	}
+	flag.CommandLine.Parse(expandShortFlags(args))
 
+	level, err := options.level()
+	if err != nil {
+		usageError(err)
+	}
+
+	// The input file can also follow the flags: huffman -dc dump.hf
+	if flag.NArg() > 1 || (flag.NArg() == 1 && *inputFile != "") {
+		usageError(fmt.Errorf("provide only one input file"))
+	}
+	if flag.NArg() == 1 {
+		*inputFile = flag.Arg(0)
+	}
+	if options.toStdout {
+		if *outputFile != "" && *outputFile != stdio {
+			usageError(fmt.Errorf("provide either -c or an output file, not both"))
+		}
+		*outputFile = stdio
+	}
+
+	// Without an input file data comes from stdin, as long as there is
+	// something to do with it. Stdin also defaults the output to stdout
+	// and the mode to compression.
+	piped := *inputFile == stdio || *outputFile == stdio
+	if *inputFile == "" && (*compress || *decompress || piped) {
+		*inputFile = stdio
+		piped = true
+	}
 	if *inputFile == "" {
-		fmt.Println("Error: Input file is required")
-		flag.Usage()
-		os.Exit(1)
+		usageError(fmt.Errorf("input file is required"))
+	}
+	if *inputFile == stdio && *outputFile == "" {
+		*outputFile = stdio
 	}
+	if piped && !*decompress {
+		*compress = true
+	}
+
 	// make sure only one of these is set and not both
 	if *compress && *decompress {
-		fmt.Println("Error: Provide either compress or decompress option, not both")
-		flag.Usage()
-		os.Exit(1)
+		usageError(fmt.Errorf("provide either compress or decompress option, not both"))
+	}
+	if options.verify && !*compress {
+		usageError(fmt.Errorf("-verify can only be used together with -compress"))
+	}
+	if options.byteRange != "" && !*decompress {
+		usageError(fmt.Errorf("-range can only be used together with -decompress"))
 	}
 	// if not output file name provided then
 	if *outputFile == "" {
 		*outputFile = "output.txt"
 	}
 
-	// validate input file exists
-	_, err := os.Stat(*inputFile)
-
-	if os.IsNotExist(err) {
-		fmt.Printf("%v file does not exists\n", inputFile)
-		os.Exit(1)
+	if !*compress && !*decompress {
+		// Without a mode, just show the byte frequencies of the input
+		table, err := internal.AnalyzeFrequencies(*inputFile)
+		if err != nil {
+			fmt.Printf("Error analyzing frequencies: %v\n", err)
+			os.Exit(1)
+		}
+		internal.PrintFrequencies(table)
+		return
 	}
 
-	table, err := internal.AnalyzeFrequencies(*inputFile)
-
+	job := codecJob{
+		input:      *inputFile,
+		output:     *outputFile,
+		decompress: *decompress,
+		level:      level,
+		options:    &options,
+		verbose:    !piped,
+	}
+	err = job.run()
 	if err != nil {
-		fmt.Printf("Error analyzing frequencies: %v\n", err)
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
 	}
+}
 
-	internal.PrintFrequencies(table)
-
-	if *compress {
-		fmt.Printf("Compressing %s to %s...\n", *inputFile, *outputFile)
-
-		// Perform compression
-		err := internal.CompressFile(*inputFile, *outputFile)
-		if err != nil {
-
-			fmt.Fprintf(os.Stderr, "Compression failed: %v\n", err)
-			os.Exit(1)
-		}
-
-		// Show statistics
-		stats, err := internal.GetCompressionStats(*inputFile, *outputFile)
-		if err == nil {
-
-			internal.PrintCompressionStats(stats)
-		}
-
-		fmt.Printf("✓ Successfully compressed to %s\n", *outputFile)
-	} else if *decompress {
-		fmt.Printf("Decompressing %s to %s\n", *inputFile, *outputFile)
-		// TODO: Will implement in Step 6-7
-		fmt.Println("Decompression not yet implemented")
-	}
+func usageError(err error) {
+	fmt.Printf("Error: %v\n", err)
+	flag.Usage()
+	os.Exit(1)
 }
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"huffman-compressor/internal"
+	"io"
+	"os"
+	"strings"
+)
+
+// stdio is the file name meaning stdin for input and stdout for output
+const stdio = "-"
+
+// shortFlags are the single letter bool flags that can be combined, as in -dc
+const shortFlags = "cdfkz123456789"
+
+// expandShortFlags splits combined single letter flags like -dc into -d -c,
+// the flag package only takes one flag per argument
+func expandShortFlags(args []string) []string {
+	expanded := make([]string, 0, len(args))
+	for i, arg := range args {
+		if arg == "--" {
+			return append(expanded, args[i:]...)
+		}
+		if len(arg) > 2 && arg[0] == '-' && strings.Trim(arg[1:], shortFlags) == "" {
+			for _, flag := range arg[1:] {
+				expanded = append(expanded, "-"+string(flag))
+			}
+			continue
+		}
+		expanded = append(expanded, arg)
+	}
+	return expanded
+}
+
+// isTerminal reports whether file is a terminal rather than a file or pipe
+func isTerminal(file *os.File) bool {
+	info, err := file.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+func openInput(path string) (io.ReadCloser, error) {
+	if path == stdio {
+		return io.NopCloser(os.Stdin), nil
+	}
+	return os.Open(path)
+}
+
+// createOutput creates path, or returns stdout for "-". The file only
+// replaces path once finish is called with succeeded set.
+func createOutput(path string) (io.Writer, func(succeeded bool) error, error) {
+	if path == stdio {
+		return os.Stdout, func(bool) error { return nil }, nil
+	}
+	file, err := internal.CreateAtomic(path, 0644)
+	if err != nil {
+		return nil, nil, err
+	}
+	finish := func(succeeded bool) error {
+		if !succeeded {
+			file.Abort()
+			return nil
+		}
+		return file.Commit()
+	}
+	return file, finish, nil
+}
+
+// pipeCompress compresses without needing to stat or seek either side, so
+// input and output can be pipes. Progress messages would mix with the data
+// on stdout and are left out.
+func pipeCompress(inputPath, outputPath string, blockSize, level int, flags uint8, workers int) error {
+	input, err := openInput(inputPath)
+	if err != nil {
+		return err
+	}
+	defer input.Close()
+
+	output, finish, err := createOutput(outputPath)
+	if err != nil {
+		return err
+	}
+	err = internal.CompressStreamWorkers(input, output, blockSize, level, flags, workers)
+	return errors.Join(err, finish(err == nil))
+}
+
+// pipeDecompress decodes a framed stream or a .hf file the same way
+func pipeDecompress(inputPath, outputPath string, limits internal.DecodeLimits, workers int) error {
+	input, err := openInput(inputPath)
+	if err != nil {
+		return err
+	}
+	defer input.Close()
+
+	decoded, err := internal.NewLimitedReaderWorkers(input, limits, workers)
+	if err != nil {
+		return err
+	}
+	output, finish, err := createOutput(outputPath)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(output, decoded)
+	if err != nil {
+		err = fmt.Errorf("failed to decode data: %w", err)
+	}
+	return errors.Join(err, finish(err == nil))
+}
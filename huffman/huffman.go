@@ -0,0 +1,6 @@
+// Package huffman implements reading and writing of Huffman compressed .hf
+// streams over any io.Reader or io.Writer, in the style of compress/gzip.
+//
+// Data written through a Writer can be read back with a Reader, and both are
+// compatible with files produced by the command line tool.
+package huffman
@@ -0,0 +1,78 @@
+package huffman
+
+import (
+	"fmt"
+	"huffman-compressor/internal"
+	"io"
+)
+
+// UnsupportedVersionError is returned by NewReader for data written with a
+// newer format version
+type UnsupportedVersionError = internal.UnsupportedVersionError
+
+// UnsupportedFeatureError is returned by NewReader for data that uses
+// features this version of the package can't decode
+type UnsupportedFeatureError = internal.UnsupportedFeatureError
+
+// ChecksumError is returned by Read when the decompressed data doesn't match
+// the checksums stored with it
+type ChecksumError = internal.ChecksumError
+
+// Reader is an io.Reader that decompresses a .hf stream read from an
+// underlying reader. Both framed streams and single-table .hf files are
+// supported.
+type Reader struct {
+	decoder io.Reader
+}
+
+// LimitError is returned by Read once the decompressed data breaks the
+// Limits given to NewReaderLimits
+type LimitError = internal.LimitError
+
+// Limits bound how much a Reader decompresses, see NewReaderLimits
+type Limits = internal.DecodeLimits
+
+// NewReader reads the header from r and returns a Reader that decompresses
+// the data following it. The Reader may read more data than necessary from r.
+func NewReader(r io.Reader) (*Reader, error) {
+	return NewReaderLimits(r, Limits{})
+}
+
+// NewReaderLimits is like NewReader for untrusted input. Reads fail with a
+// *LimitError once the output exceeds limits.MaxOutputSize bytes or
+// limits.MaxRatio times the compressed bytes read so far. A .hf file whose
+// header claims too much output is refused right away.
+func NewReaderLimits(r io.Reader, limits Limits) (*Reader, error) {
+	decoder, err := internal.NewLimitedReader(r, limits)
+	if err != nil {
+		return nil, fmt.Errorf("huffman: %w", err)
+	}
+	return &Reader{decoder: decoder}, nil
+}
+
+// Read decompresses up to len(p) bytes into p. Checksums are verified when
+// the end of the data is reached, so a corrupted stream fails at the latest
+// with the final Read.
+func (z *Reader) Read(p []byte) (int, error) {
+	n, err := z.decoder.Read(p)
+	if err != nil && err != io.EOF {
+		return n, fmt.Errorf("huffman: %w", err)
+	}
+	return n, err
+}
+
+// SeekableReader decompresses a stream on demand: it implements
+// io.ReaderAt, io.Reader and io.Seeker over the decompressed data and only
+// decodes the blocks a read touches. Checksums are not verified.
+type SeekableReader = internal.SeekableReader
+
+// NewSeekableReader opens the size byte stream in r for random access.
+// Streams written by NewSeekableWriter are opened from their index, others
+// by reading every block header once.
+func NewSeekableReader(r io.ReaderAt, size int64) (*SeekableReader, error) {
+	reader, err := internal.NewSeekableReader(r, size)
+	if err != nil {
+		return nil, fmt.Errorf("huffman: %w", err)
+	}
+	return reader, nil
+}
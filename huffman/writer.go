@@ -0,0 +1,124 @@
+package huffman
+
+import (
+	"errors"
+	"fmt"
+	"huffman-compressor/internal"
+	"io"
+)
+
+// ErrClosed is returned when writing to a Writer that was already closed
+var ErrClosed = errors.New("huffman: writer is closed")
+
+// DefaultBlockSize is the amount of input encoded with one frequency table
+const DefaultBlockSize = internal.DefaultBlockSize
+
+// Compression levels accepted by NewWriterLevel
+const (
+	BestSpeed          = internal.MinLevel
+	BestCompression    = internal.MaxLevel
+	DefaultCompression = BestSpeed
+)
+
+// Writer is an io.WriteCloser. Writes to a Writer are split into blocks, and
+// each block is compressed and written to the underlying writer as soon as
+// it is full.
+type Writer struct {
+	stream *internal.StreamWriter
+	closed bool
+	err    error // from creating stream, returned by every call
+}
+
+// NewWriter returns a new Writer using DefaultBlockSize. It is the caller's
+// responsibility to call Close on the Writer when done.
+func NewWriter(w io.Writer) *Writer {
+	return NewWriterSize(w, DefaultBlockSize)
+}
+
+// NewWriterSize returns a new Writer that encodes blocks of blockSize bytes.
+// Smaller blocks use less memory, larger blocks usually compress better.
+// An error creating the Writer is returned by Write, Flush and Close.
+func NewWriterSize(w io.Writer, blockSize int) *Writer {
+	stream, err := internal.NewStreamWriter(w, blockSize)
+	return &Writer{stream: stream, err: err}
+}
+
+// NewWriterLevel is like NewWriter but compresses at level, from BestSpeed
+// to BestCompression. Higher levels find repeated strings and pick the
+// smallest coding per block at the cost of speed.
+func NewWriterLevel(w io.Writer, level int) (*Writer, error) {
+	return newWriterLevel(w, level, internal.DefaultFlags)
+}
+
+// NewSeekableWriter is like NewWriterLevel but ends the stream with a block
+// index, so a SeekableReader opens it without reading every block header
+func NewSeekableWriter(w io.Writer, level int) (*Writer, error) {
+	return newWriterLevel(w, level, internal.DefaultFlags|internal.FlagIndex)
+}
+
+func newWriterLevel(w io.Writer, level int, flags uint8) (*Writer, error) {
+	if level < BestSpeed || level > BestCompression {
+		return nil, fmt.Errorf("huffman: invalid compression level %d", level)
+	}
+	stream, err := internal.NewStreamWriterLevel(w, DefaultBlockSize, level, flags)
+	if err != nil {
+		return nil, err
+	}
+	return &Writer{stream: stream}, nil
+}
+
+// NewAdaptiveWriter returns a new Writer using adaptive Huffman codes. The
+// code tree is updated as data is encoded instead of being stored, so short
+// messages and data flushed often carry no table overhead.
+func NewAdaptiveWriter(w io.Writer) (*Writer, error) {
+	stream, err := internal.NewStreamWriterFlags(w, DefaultBlockSize, internal.DefaultFlags|internal.FlagAdaptive)
+	if err != nil {
+		return nil, err
+	}
+	return &Writer{stream: stream}, nil
+}
+
+// SetConcurrency lets z compress up to n blocks at once on separate
+// goroutines. The output is the same for any n. Call it before the first
+// Write.
+func (z *Writer) SetConcurrency(n int) {
+	if z.err == nil {
+		z.stream.SetConcurrency(n)
+	}
+}
+
+// Write compresses p, writing out every block that fills up
+func (z *Writer) Write(p []byte) (int, error) {
+	if z.err != nil {
+		return 0, z.err
+	}
+	if z.closed {
+		return 0, ErrClosed
+	}
+	return z.stream.Write(p)
+}
+
+// Flush compresses any pending data as a short block and flushes it to the
+// underlying writer, so a reader can decode everything written so far
+func (z *Writer) Flush() error {
+	if z.err != nil {
+		return z.err
+	}
+	if z.closed {
+		return ErrClosed
+	}
+	return z.stream.Flush()
+}
+
+// Close flushes pending data and writes the end-of-stream marker. It does
+// not close the underlying writer.
+func (z *Writer) Close() error {
+	if z.err != nil {
+		return z.err
+	}
+	if z.closed {
+		return nil
+	}
+	z.closed = true
+	return z.stream.Close()
+}
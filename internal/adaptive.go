@@ -0,0 +1,203 @@
+package internal
+
+import (
+	"fmt"
+	"io"
+)
+
+// FlagAdaptive marks a framed stream whose blocks are coded with adaptive
+// (FGK) Huffman codes. Encoder and decoder start from the same empty tree
+// and update it after every symbol, so blocks carry no code table at all.
+const FlagAdaptive uint8 = 1 << 2
+
+// AdaptiveTree is an FGK Huffman tree. It starts with a single NYT ("not
+// yet transmitted") leaf. A character seen for the first time is sent as
+// the code of the NYT leaf followed by its 8 raw bits, after that as the
+// code of its own leaf.
+//
+// nodes lists every node by decreasing weight, root first. Nodes of equal
+// weight are contiguous, and updates keep it that way by swapping a node
+// with the first node of its weight (its block leader) before incrementing
+// it. That is the sibling property, so the tree stays a Huffman tree for the
+// counts seen so far.
+type AdaptiveTree struct {
+	root   *HuffmanNode
+	nyt    *HuffmanNode
+	leaves [256]*HuffmanNode
+	nodes  []*HuffmanNode
+	path   []uint64 // scratch space for Encode
+}
+
+func NewAdaptiveTree() *AdaptiveTree {
+	nyt := &HuffmanNode{isLeaf: true}
+	return &AdaptiveTree{
+		root:  nyt,
+		nyt:   nyt,
+		nodes: []*HuffmanNode{nyt},
+	}
+}
+
+// Encode writes the current code of char and updates the tree
+func (t *AdaptiveTree) Encode(bitBuffer *BitBuffer, char byte) error {
+	leaf := t.leaves[char]
+	if leaf == nil {
+		leaf = t.nyt
+	}
+
+	// Collect the path leaf to root, then write it root first
+	t.path = t.path[:0]
+	for node := leaf; node.parent != nil; node = node.parent {
+		if node.parent.right == node {
+			t.path = append(t.path, 1)
+		} else {
+			t.path = append(t.path, 0)
+		}
+	}
+	for i := len(t.path) - 1; i >= 0; i-- {
+		err := bitBuffer.WriteBit(t.path[i])
+		if err != nil {
+			return err
+		}
+	}
+
+	if leaf == t.nyt {
+		// New character, send it raw (WriteBits takes the first bit from the LSB)
+		err := bitBuffer.WriteBits(reverseCode(uint64(char), 8), 8)
+		if err != nil {
+			return err
+		}
+	}
+
+	t.update(char)
+	return nil
+}
+
+// Decode reads one character and updates the tree the same way Encode did.
+// io.EOF is returned when the stream runs out of bits.
+func (t *AdaptiveTree) Decode(bitReader *BitReader) (byte, error) {
+	node := t.root
+	for !node.isLeaf {
+		bit, err := bitReader.ReadBit()
+		if err != nil {
+			return 0, err
+		}
+		if bit == 0 {
+			node = node.left
+		} else {
+			node = node.right
+		}
+	}
+
+	char := node.char
+	if node == t.nyt {
+		raw, available := bitReader.PeekBits(8)
+		if available < 8 {
+			if err := bitReader.Err(); err != nil {
+				return 0, err
+			}
+			return 0, io.EOF
+		}
+		bitReader.SkipBits(8)
+		char = byte(raw)
+	}
+
+	t.update(char)
+	return char, nil
+}
+
+// update increments the count of char, adding a leaf for it when needed
+func (t *AdaptiveTree) update(char byte) {
+	node := t.leaves[char]
+	if node == nil {
+		// Split the NYT leaf: it becomes the parent of a new NYT and the
+		// new character, both with weight 0
+		parent := t.nyt
+		leaf := &HuffmanNode{char: char, isLeaf: true, parent: parent}
+		nyt := &HuffmanNode{isLeaf: true, parent: parent}
+
+		parent.isLeaf = false
+		parent.left = nyt
+		parent.right = leaf
+
+		leaf.order = len(t.nodes)
+		nyt.order = len(t.nodes) + 1
+		t.nodes = append(t.nodes, leaf, nyt)
+
+		t.nyt = nyt
+		t.leaves[char] = leaf
+		node = leaf
+	}
+
+	for node != nil {
+		leader := t.blockLeader(node)
+		if leader != node && leader != node.parent {
+			t.swap(node, leader)
+		}
+		node.frequency++
+		node = node.parent
+	}
+}
+
+// blockLeader returns the first node in nodes with the same weight as node
+func (t *AdaptiveTree) blockLeader(node *HuffmanNode) *HuffmanNode {
+	i := node.order
+	for i > 0 && t.nodes[i-1].frequency == node.frequency {
+		i--
+	}
+	return t.nodes[i]
+}
+
+// swap exchanges two subtrees, neither of which contains the other
+func (t *AdaptiveTree) swap(a, b *HuffmanNode) {
+	parentA, parentB := a.parent, b.parent
+	if parentA == parentB {
+		parentA.left, parentA.right = parentA.right, parentA.left
+	} else {
+		if parentA.left == a {
+			parentA.left = b
+		} else {
+			parentA.right = b
+		}
+		if parentB.left == b {
+			parentB.left = a
+		} else {
+			parentB.right = a
+		}
+		a.parent, b.parent = parentB, parentA
+	}
+
+	t.nodes[a.order], t.nodes[b.order] = b, a
+	a.order, b.order = b.order, a.order
+}
+
+// EncodeAdaptive codes data with a fresh AdaptiveTree and returns the
+// number of padding bits in the last byte
+func EncodeAdaptive(writer io.Writer, data []byte) (int, error) {
+	tree := NewAdaptiveTree()
+	bitBuffer := NewBitBuffer(writer)
+	for _, char := range data {
+		err := tree.Encode(bitBuffer, char)
+		if err != nil {
+			return 0, err
+		}
+	}
+	return bitBuffer.Close()
+}
+
+// DecodeAdaptive decodes length characters coded by EncodeAdaptive
+func DecodeAdaptive(reader io.Reader, length int) ([]byte, error) {
+	tree := NewAdaptiveTree()
+	bitReader := NewBitReader(reader)
+	data := make([]byte, length)
+	for i := range data {
+		char, err := tree.Decode(bitReader)
+		if err == io.EOF {
+			return nil, fmt.Errorf("payload ended after %d of %d bytes", i, length)
+		}
+		if err != nil {
+			return nil, err
+		}
+		data[i] = char
+	}
+	return data, nil
+}
@@ -0,0 +1,168 @@
+package internal
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"os"
+)
+
+// Analysis compares the codes built for a frequency table with the Shannon
+// entropy of the data, the fewest bits per symbol any code for single bytes
+// can reach. Header and trailer are counted apart from the payload, so a
+// poor ratio can be told apart from a poor code. The sizes are those of a
+// single-table .hf file, StreamSize is that of the framed stream hf compress
+// writes by default.
+type Analysis struct {
+	Format            string  `json:"format"` // AnalysisFormat, what the sizes describe
+	OriginalSize      uint64  `json:"original_size"`
+	Symbols           int     `json:"symbols"`             // distinct byte values
+	Entropy           float64 `json:"entropy"`             // bits per symbol
+	AverageCodeLength float64 `json:"average_code_length"` // bits per symbol
+	Redundancy        float64 `json:"redundancy"`          // AverageCodeLength - Entropy
+	Efficiency        float64 `json:"efficiency"`          // Entropy / AverageCodeLength, in percent
+	EntropySize       uint64  `json:"entropy_size"`        // payload bytes at exactly Entropy bits per symbol
+	PayloadSize       uint64  `json:"payload_size"`
+	HeaderSize        uint64  `json:"header_size"` // version 2 .hf header with its frequency table
+	TrailerSize       uint64  `json:"trailer_size"`
+	CompressedSize    uint64  `json:"compressed_size"` // header, payload and trailer
+	StreamSize        uint64  `json:"stream_size"`     // framed stream with the default options, 0 if not measured
+}
+
+// AnalysisFormat names the format Analyze computes sizes for: a version 2
+// .hf file with one code table and DefaultFlags, as CompressFile writes
+const AnalysisFormat = ".hf single-table"
+
+// Ratio is the compressed size as a percentage of the original size
+func (a Analysis) Ratio() float64 {
+	if a.OriginalSize == 0 {
+		return 0
+	}
+	return float64(a.CompressedSize) / float64(a.OriginalSize) * 100
+}
+
+// StreamRatio is the stream size as a percentage of the original size
+func (a Analysis) StreamRatio() float64 {
+	if a.OriginalSize == 0 {
+		return 0
+	}
+	return float64(a.StreamSize) / float64(a.OriginalSize) * 100
+}
+
+// HeaderOverhead is the share of the compressed size taken by header and
+// trailer, in percent
+func (a Analysis) HeaderOverhead() float64 {
+	if a.CompressedSize == 0 {
+		return 0
+	}
+	return float64(a.HeaderSize+a.TrailerSize) / float64(a.CompressedSize) * 100
+}
+
+// Total returns the number of symbols counted in the table
+func (ft FrequencyTable) Total() uint64 {
+	total := uint64(0)
+	for _, freq := range ft {
+		total += uint64(freq)
+	}
+	return total
+}
+
+// Entropy returns the Shannon entropy of the table in bits per symbol
+func (ft FrequencyTable) Entropy() float64 {
+	total := float64(ft.Total())
+	entropy := 0.0
+	for _, freq := range ft {
+		if freq > 0 {
+			p := float64(freq) / total
+			entropy -= p * math.Log2(p)
+		}
+	}
+	return entropy
+}
+
+// AverageCodeLength returns the bits per symbol spent coding every
+// character of freqTable with codeTable
+func AverageCodeLength(freqTable FrequencyTable, codeTable CodeTable) float64 {
+	total := freqTable.Total()
+	if total == 0 {
+		return 0
+	}
+	bits := uint64(0)
+	for char, freq := range freqTable {
+		bits += uint64(freq) * uint64(codeTable[char].length)
+	}
+	return float64(bits) / float64(total)
+}
+
+// Analyze computes the Analysis of coding freqTable with codeTable into a
+// .hf file with DefaultFlags
+func Analyze(freqTable FrequencyTable, codeTable CodeTable) Analysis {
+	total := freqTable.Total()
+	a := Analysis{
+		Format:            AnalysisFormat,
+		OriginalSize:      total,
+		Symbols:           len(freqTable),
+		Entropy:           freqTable.Entropy(),
+		AverageCodeLength: AverageCodeLength(freqTable, codeTable),
+		PayloadSize:       CalculatePayloadSize(freqTable, codeTable),
+		HeaderSize:        uint64(CalculateHeaderSizeV2(freqTable, total)),
+		TrailerSize:       uint64(TrailerSize(DefaultFlags)),
+	}
+	a.Redundancy = a.AverageCodeLength - a.Entropy
+	if a.AverageCodeLength > 0 {
+		a.Efficiency = a.Entropy / a.AverageCodeLength * 100
+	}
+	a.EntropySize = uint64(math.Ceil(a.Entropy * float64(total) / 8))
+	a.CompressedSize = a.HeaderSize + a.PayloadSize + a.TrailerSize
+	return a
+}
+
+// AnalyzeFile analyzes the codes CompressFile would use for the file at
+// path, without writing anything. StreamSize is measured by compressing the
+// file as hf compress does by default and counting the bytes.
+func AnalyzeFile(path string) (Analysis, error) {
+	return AnalyzeFileWorkers(path, 1)
+}
+
+// AnalyzeFileWorkers is like AnalyzeFile, encoding up to workers blocks at
+// once to measure the stream size
+func AnalyzeFileWorkers(path string, workers int) (Analysis, error) {
+	freqTable, err := AnalyzeFrequencies(path)
+	if err != nil {
+		return Analysis{}, err
+	}
+
+	var analysis Analysis
+	if len(freqTable) == 0 {
+		analysis = Analyze(freqTable, nil)
+	} else {
+		_, codeTable, err := buildCodes(freqTable)
+		if err != nil {
+			return Analysis{}, err
+		}
+		analysis = Analyze(freqTable, codeTable)
+	}
+
+	analysis.StreamSize, err = streamSize(path, workers)
+	if err != nil {
+		return Analysis{}, err
+	}
+	return analysis, nil
+}
+
+// streamSize compresses the file at path into a framed stream with the
+// default block size, level and flags, and returns its size
+func streamSize(path string, workers int) (uint64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open input file: %w", err)
+	}
+	defer file.Close()
+
+	counter := &countingWriter{writer: io.Discard}
+	err = CompressStreamWorkers(file, counter, DefaultBlockSize, 0, DefaultFlags, workers)
+	if err != nil {
+		return 0, err
+	}
+	return counter.count, nil
+}
@@ -0,0 +1,476 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Archive layout:
+//
+//	[HA:2][Version:1][EntryData]...[Directory][Footer]
+//
+//	EntryData: the contents of a regular file as a framed stream (see
+//	           CompressStreamLevel), so every entry can be decoded on its own
+//	Directory: [Count:uvarint][Entry]...
+//	Entry:     [PathLen:uvarint][Path][Type:1][Mode:4][ModTime:varint][ModTimeNanos:uvarint]
+//	           [Size:uvarint][Offset:uvarint][CompressedSize:uvarint][LinkLen:uvarint][Link]
+//	Footer:    [DirectoryOffset:8][DirectoryCRC:4][HA:2]
+//
+// The directory lists every entry with where its data starts, so an archive
+// is listed without decoding anything and a single entry is extracted by
+// seeking straight to it. Paths are relative and use forward slashes.
+const ArchiveMagic = "HA"
+
+const (
+	ArchiveVersion    = 1
+	archiveHeaderSize = 3  // magic and version
+	archiveFooterSize = 14 // directory offset, directory CRC and magic
+)
+
+// EntryType tells what kind of file an archive entry holds
+type EntryType uint8
+
+const (
+	EntryFile EntryType = iota
+	EntryDir
+	EntrySymlink
+)
+
+func (t EntryType) String() string {
+	switch t {
+	case EntryFile:
+		return "file"
+	case EntryDir:
+		return "dir"
+	case EntrySymlink:
+		return "symlink"
+	default:
+		return fmt.Sprintf("EntryType(%d)", uint8(t))
+	}
+}
+
+// ArchiveEntry describes one file in an archive
+type ArchiveEntry struct {
+	Path           string // relative, slash separated
+	Type           EntryType
+	Mode           fs.FileMode // permission bits
+	ModTime        time.Time
+	Size           uint64 // original size, regular files only
+	Link           string // target of a symlink
+	Offset         uint64 // start of the entry data
+	CompressedSize uint64 // size of the entry data
+}
+
+// ArchiveWriter writes an archive entry by entry. Close writes the
+// directory, nothing can be added after that.
+type ArchiveWriter struct {
+	writer  io.Writer
+	offset  uint64 // bytes written so far
+	level   int
+	entries []ArchiveEntry
+	paths   map[string]bool
+	closed  bool
+}
+
+// NewArchiveWriter writes the archive header and returns a writer that
+// compresses entries at level (MinLevel to MaxLevel)
+func NewArchiveWriter(writer io.Writer, level int) (*ArchiveWriter, error) {
+	_, err := getLevelConfig(level)
+	if err != nil {
+		return nil, err
+	}
+
+	aw := &ArchiveWriter{writer: writer, level: level, paths: make(map[string]bool)}
+	_, err = aw.Write(append([]byte(ArchiveMagic), ArchiveVersion))
+	if err != nil {
+		return nil, err
+	}
+	return aw, nil
+}
+
+// Write writes p to the underlying writer, counting it towards the offset
+// of the next entry
+func (aw *ArchiveWriter) Write(p []byte) (int, error) {
+	n, err := aw.writer.Write(p)
+	aw.offset += uint64(n)
+	return n, err
+}
+
+// Add adds entry to the archive. The contents of regular files are read
+// from reader until EOF, reader is ignored for other entries. Size, Offset
+// and CompressedSize are filled in by Add.
+func (aw *ArchiveWriter) Add(entry ArchiveEntry, reader io.Reader) error {
+	if aw.closed {
+		return fmt.Errorf("archive writer is closed")
+	}
+	if entry.Path == "" {
+		return fmt.Errorf("archive entry has an empty path")
+	}
+	if aw.paths[entry.Path] {
+		return fmt.Errorf("duplicate archive entry %q", entry.Path)
+	}
+
+	entry.Size, entry.Offset, entry.CompressedSize = 0, aw.offset, 0
+	switch entry.Type {
+	case EntryFile:
+		counter := &countingReader{reader: reader}
+		err := CompressStreamLevel(counter, aw, 0, aw.level, DefaultFlags)
+		if err != nil {
+			return fmt.Errorf("failed to compress %s: %w", entry.Path, err)
+		}
+		entry.Size = counter.count
+		entry.CompressedSize = aw.offset - entry.Offset
+	case EntryDir, EntrySymlink:
+	default:
+		return fmt.Errorf("unknown archive entry type %d", entry.Type)
+	}
+
+	aw.paths[entry.Path] = true
+	aw.entries = append(aw.entries, entry)
+	return nil
+}
+
+// AddPath adds the file at path, without following symlinks, as an entry
+// called name. Directories are added on their own, not their contents.
+func (aw *ArchiveWriter) AddPath(path, name string) error {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return err
+	}
+
+	entry := ArchiveEntry{
+		Path:    name,
+		Mode:    info.Mode().Perm(),
+		ModTime: info.ModTime(),
+	}
+	switch {
+	case info.Mode().IsRegular():
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		entry.Type = EntryFile
+		return aw.Add(entry, file)
+	case info.IsDir():
+		entry.Type = EntryDir
+	case info.Mode()&fs.ModeSymlink != 0:
+		entry.Type = EntrySymlink
+		entry.Link, err = os.Readlink(path)
+		if err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("%s: unsupported file type %v", path, info.Mode().Type())
+	}
+	return aw.Add(entry, nil)
+}
+
+// Close writes the directory and footer. It does not close the underlying
+// writer.
+func (aw *ArchiveWriter) Close() error {
+	if aw.closed {
+		return nil
+	}
+	aw.closed = true
+
+	directoryOffset := aw.offset
+	directory := binary.AppendUvarint(nil, uint64(len(aw.entries)))
+	for _, entry := range aw.entries {
+		directory = appendArchiveEntry(directory, entry)
+	}
+
+	footer := binary.BigEndian.AppendUint64(nil, directoryOffset)
+	footer = binary.BigEndian.AppendUint32(footer, crc32.ChecksumIEEE(directory))
+	footer = append(footer, ArchiveMagic...)
+
+	_, err := aw.Write(append(directory, footer...))
+	return err
+}
+
+func appendArchiveEntry(buf []byte, entry ArchiveEntry) []byte {
+	buf = binary.AppendUvarint(buf, uint64(len(entry.Path)))
+	buf = append(buf, entry.Path...)
+	buf = append(buf, byte(entry.Type))
+	buf = binary.BigEndian.AppendUint32(buf, uint32(entry.Mode.Perm()))
+	buf = binary.AppendVarint(buf, entry.ModTime.Unix())
+	buf = binary.AppendUvarint(buf, uint64(entry.ModTime.Nanosecond()))
+	buf = binary.AppendUvarint(buf, entry.Size)
+	buf = binary.AppendUvarint(buf, entry.Offset)
+	buf = binary.AppendUvarint(buf, entry.CompressedSize)
+	buf = binary.AppendUvarint(buf, uint64(len(entry.Link)))
+	return append(buf, entry.Link...)
+}
+
+type countingReader struct {
+	reader io.Reader
+	count  uint64
+}
+
+func (cr *countingReader) Read(p []byte) (int, error) {
+	n, err := cr.reader.Read(p)
+	cr.count += uint64(n)
+	return n, err
+}
+
+// countingWriter counts the bytes written through it
+type countingWriter struct {
+	writer io.Writer
+	count  uint64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.writer.Write(p)
+	cw.count += uint64(n)
+	return n, err
+}
+
+// ArchiveReader reads the directory of an archive and decodes its entries
+type ArchiveReader struct {
+	reader  io.ReaderAt
+	entries []ArchiveEntry
+}
+
+// NewArchiveReader reads and checks the directory of the size byte archive
+// in reader. No entry data is read.
+func NewArchiveReader(reader io.ReaderAt, size int64) (*ArchiveReader, error) {
+	if size < int64(archiveHeaderSize+archiveFooterSize) {
+		return nil, fmt.Errorf("invalid archive: too short")
+	}
+
+	header := make([]byte, archiveHeaderSize)
+	_, err := reader.ReadAt(header, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read archive header: %w", err)
+	}
+	if string(header[:len(ArchiveMagic)]) != ArchiveMagic {
+		return nil, fmt.Errorf("invalid archive: bad magic number")
+	}
+	if version := header[len(ArchiveMagic)]; version != ArchiveVersion {
+		return nil, &UnsupportedVersionError{Format: "archive", Version: version}
+	}
+
+	footer := make([]byte, archiveFooterSize)
+	_, err = reader.ReadAt(footer, size-archiveFooterSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read archive footer: %w", err)
+	}
+	if string(footer[12:]) != ArchiveMagic {
+		return nil, fmt.Errorf("invalid archive: bad footer")
+	}
+	directoryOffset := binary.BigEndian.Uint64(footer[0:8])
+	directoryEnd := uint64(size - archiveFooterSize)
+	if directoryOffset < archiveHeaderSize || directoryOffset > directoryEnd {
+		return nil, fmt.Errorf("invalid archive: directory offset %d out of range", directoryOffset)
+	}
+
+	directory := make([]byte, directoryEnd-directoryOffset)
+	_, err = reader.ReadAt(directory, int64(directoryOffset))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read archive directory: %w", err)
+	}
+	if crc := crc32.ChecksumIEEE(directory); crc != binary.BigEndian.Uint32(footer[8:12]) {
+		return nil, crcMismatch("archive directory", binary.BigEndian.Uint32(footer[8:12]), crc)
+	}
+
+	entries, err := parseArchiveDirectory(directory, directoryOffset)
+	if err != nil {
+		return nil, err
+	}
+	return &ArchiveReader{reader: reader, entries: entries}, nil
+}
+
+// parseArchiveDirectory decodes the directory, checking that all entry data
+// lies between the header and dataEnd
+func parseArchiveDirectory(directory []byte, dataEnd uint64) ([]ArchiveEntry, error) {
+	reader := bytes.NewReader(directory)
+	count, err := binary.ReadUvarint(reader)
+	if err != nil {
+		return nil, fmt.Errorf("invalid archive directory: %w", unexpectedEOF(err))
+	}
+	// Every entry takes well over one byte, don't trust count for the
+	// allocation
+	if count > uint64(len(directory)) {
+		return nil, fmt.Errorf("invalid archive directory: %d entries in %d bytes", count, len(directory))
+	}
+
+	entries := make([]ArchiveEntry, 0, count)
+	for i := uint64(0); i < count; i++ {
+		entry, err := readArchiveEntry(reader)
+		if err != nil {
+			return nil, fmt.Errorf("invalid archive directory entry %d: %w", i, err)
+		}
+		if entry.Offset < archiveHeaderSize || entry.CompressedSize > dataEnd-entry.Offset || entry.Offset > dataEnd {
+			return nil, fmt.Errorf("invalid archive directory entry %q: data out of range", entry.Path)
+		}
+		entries = append(entries, entry)
+	}
+	if reader.Len() != 0 {
+		return nil, fmt.Errorf("invalid archive directory: %d trailing bytes", reader.Len())
+	}
+	return entries, nil
+}
+
+func readArchiveEntry(reader *bytes.Reader) (ArchiveEntry, error) {
+	var entry ArchiveEntry
+
+	path, err := readArchiveString(reader)
+	if err != nil {
+		return entry, err
+	}
+	entry.Path = path
+
+	var fixed [5]byte
+	_, err = io.ReadFull(reader, fixed[:])
+	if err != nil {
+		return entry, unexpectedEOF(err)
+	}
+	entry.Type = EntryType(fixed[0])
+	if entry.Type > EntrySymlink {
+		return entry, fmt.Errorf("unknown entry type %d", entry.Type)
+	}
+	entry.Mode = fs.FileMode(binary.BigEndian.Uint32(fixed[1:])).Perm()
+
+	seconds, err := binary.ReadVarint(reader)
+	if err != nil {
+		return entry, unexpectedEOF(err)
+	}
+	var fields [4]uint64 // nanoseconds, size, offset, compressed size
+	for i := range fields {
+		fields[i], err = binary.ReadUvarint(reader)
+		if err != nil {
+			return entry, unexpectedEOF(err)
+		}
+	}
+	if fields[0] >= uint64(time.Second) {
+		return entry, fmt.Errorf("invalid modification time")
+	}
+	entry.ModTime = time.Unix(seconds, int64(fields[0]))
+	entry.Size, entry.Offset, entry.CompressedSize = fields[1], fields[2], fields[3]
+
+	entry.Link, err = readArchiveString(reader)
+	return entry, err
+}
+
+func readArchiveString(reader *bytes.Reader) (string, error) {
+	length, err := binary.ReadUvarint(reader)
+	if err != nil {
+		return "", unexpectedEOF(err)
+	}
+	if length > uint64(reader.Len()) {
+		return "", io.ErrUnexpectedEOF
+	}
+	buf := make([]byte, length)
+	_, err = io.ReadFull(reader, buf)
+	return string(buf), err
+}
+
+// Entries returns the directory of the archive in the order entries were
+// added
+func (ar *ArchiveReader) Entries() []ArchiveEntry {
+	return ar.entries
+}
+
+// Open returns a reader for the contents of a regular file entry. The
+// entry's checksums are verified when the reader reaches EOF.
+func (ar *ArchiveReader) Open(entry ArchiveEntry) (io.Reader, error) {
+	if entry.Type != EntryFile {
+		return nil, fmt.Errorf("%s is a %s, not a file", entry.Path, entry.Type)
+	}
+	section := io.NewSectionReader(ar.reader, int64(entry.Offset), int64(entry.CompressedSize))
+	stream, err := NewStreamReader(section)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", entry.Path, err)
+	}
+	return stream, nil
+}
+
+// CreateArchive writes the files at paths, and everything below the
+// directories among them, to a new archive at archivePath. Entries are
+// named after the paths as given, without leading "/" or "../".
+func CreateArchive(archivePath string, paths []string, level int) error {
+	archiveFile, err := CreateAtomic(archivePath, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to create archive: %w", err)
+	}
+	defer archiveFile.Abort()
+	archiveInfo, err := archiveFile.Stat()
+	if err != nil {
+		return err
+	}
+	// An archive being replaced isn't archived either
+	replacedInfo, _ := os.Stat(archivePath)
+
+	writer, err := NewArchiveWriter(archiveFile, level)
+	if err != nil {
+		return err
+	}
+
+	for _, root := range paths {
+		err = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			name := ArchiveName(path)
+			if name == "" {
+				return nil
+			}
+			// Don't archive the archive itself
+			if info, err := d.Info(); err == nil && (os.SameFile(info, archiveInfo) || replacedInfo != nil && os.SameFile(info, replacedInfo)) {
+				return nil
+			}
+			return writer.AddPath(path, name)
+		})
+		if err != nil {
+			return fmt.Errorf("failed to archive %s: %w", root, err)
+		}
+	}
+
+	err = writer.Close()
+	if err != nil {
+		return fmt.Errorf("failed to write archive directory: %w", err)
+	}
+	return archiveFile.Commit()
+}
+
+// ArchiveName turns a file system path into the entry path CreateArchive
+// uses for it, "" when nothing is left of it
+func ArchiveName(path string) string {
+	path = filepath.Clean(path)
+	path = path[len(filepath.VolumeName(path)):]
+	name := strings.TrimLeft(filepath.ToSlash(path), "/")
+	for strings.HasPrefix(name, "../") {
+		name = name[len("../"):]
+	}
+	if name == "." || name == ".." {
+		return ""
+	}
+	return name
+}
+
+// ListArchive returns the directory of the archive at archivePath
+func ListArchive(archivePath string) ([]ArchiveEntry, error) {
+	archiveFile, err := os.Open(archivePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open archive: %w", err)
+	}
+	defer archiveFile.Close()
+
+	info, err := archiveFile.Stat()
+	if err != nil {
+		return nil, err
+	}
+	reader, err := NewArchiveReader(archiveFile, info.Size())
+	if err != nil {
+		return nil, err
+	}
+	return reader.Entries(), nil
+}
@@ -0,0 +1,123 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// AtomicFile is an output file written under a temporary name next to its
+// destination. Commit syncs it to disk and renames it into place, so the
+// destination never holds a partial file: it keeps its old contents, or
+// doesn't exist, until the new file is complete.
+//
+// A destination that exists but isn't a regular file, such as a device or a
+// symlink, is opened and written directly instead, since renaming over it
+// would replace it.
+type AtomicFile struct {
+	*os.File
+	path   string
+	direct bool // writing to path itself, there is no temporary file
+	done   bool
+}
+
+// CreateAtomic creates a temporary file in the directory of path, which
+// Commit renames to path. The file gets the mode of the regular file it
+// replaces, or perm less the umask if path doesn't exist yet.
+func CreateAtomic(path string, perm os.FileMode) (*AtomicFile, error) {
+	info, err := os.Lstat(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if err == nil && !info.Mode().IsRegular() {
+		file, err := os.OpenFile(path, os.O_WRONLY|os.O_TRUNC, 0)
+		if err != nil {
+			return nil, err
+		}
+		return &AtomicFile{File: file, path: path, direct: true}, nil
+	}
+
+	file, err := createTemp(filepath.Dir(path), filepath.Base(path), perm)
+	if err != nil {
+		return nil, err
+	}
+	if info != nil {
+		err = file.Chmod(info.Mode().Perm())
+		if err != nil {
+			file.Close()
+			os.Remove(file.Name())
+			return nil, err
+		}
+	}
+	return &AtomicFile{File: file, path: path}, nil
+}
+
+// createTemp is os.CreateTemp with permissions perm, which the umask
+// applies to like it does for any new file
+func createTemp(dir, base string, perm os.FileMode) (*os.File, error) {
+	for range 10000 {
+		name := filepath.Join(dir, "."+base+"."+strconv.FormatUint(uint64(rand.Uint32()), 10)+".tmp")
+		file, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_EXCL, perm)
+		if !os.IsExist(err) {
+			return file, err
+		}
+	}
+	return nil, fmt.Errorf("failed to create a temporary file for %s in %s", base, dir)
+}
+
+// Commit flushes the file to disk and renames it to its destination. The
+// temporary file is removed if that fails.
+func (af *AtomicFile) Commit() error {
+	if af.done {
+		return fmt.Errorf("%s: already committed or aborted", af.path)
+	}
+	af.done = true
+
+	if af.direct {
+		// Devices and pipes may not support Sync, only files are synced
+		var err error
+		if info, statErr := af.File.Stat(); statErr == nil && info.Mode().IsRegular() {
+			err = af.File.Sync()
+		}
+		err = errors.Join(err, af.File.Close())
+		if err != nil {
+			return fmt.Errorf("failed to write %s: %w", af.path, err)
+		}
+		return nil
+	}
+
+	err := af.File.Sync()
+	err = errors.Join(err, af.File.Close())
+	if err == nil {
+		err = os.Rename(af.File.Name(), af.path)
+	}
+	if err != nil {
+		os.Remove(af.File.Name())
+		return fmt.Errorf("failed to write %s: %w", af.path, err)
+	}
+
+	// The rename is only durable once the directory is synced. Not every
+	// platform can sync a directory, the file itself is safe either way.
+	if dir, err := os.Open(filepath.Dir(af.path)); err == nil {
+		dir.Sync()
+		dir.Close()
+	}
+	return nil
+}
+
+// Abort removes the temporary file, unless Commit was called. Deferring it
+// right after CreateAtomic cleans up on every error path. A destination
+// written directly only gets closed, what was written to it stays.
+func (af *AtomicFile) Abort() {
+	if af.done {
+		return
+	}
+	af.done = true
+	af.File.Close()
+	if !af.direct {
+		os.Remove(af.File.Name())
+	}
+}
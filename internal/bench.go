@@ -0,0 +1,75 @@
+package internal
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"time"
+)
+
+// BenchResult holds the sizes and timings of one compression level on one
+// input
+type BenchResult struct {
+	Level          int
+	OriginalSize   int
+	CompressedSize int
+	CompressTime   time.Duration
+	DecompressTime time.Duration
+}
+
+// Ratio is the compressed size as a percentage of the original size
+func (r BenchResult) Ratio() float64 {
+	if r.OriginalSize == 0 {
+		return 0
+	}
+	return float64(r.CompressedSize) / float64(r.OriginalSize) * 100
+}
+
+// CompressSpeed is the compression throughput in MB/s of original data
+func (r BenchResult) CompressSpeed() float64 {
+	return megabytesPerSecond(r.OriginalSize, r.CompressTime)
+}
+
+// DecompressSpeed is the decompression throughput in MB/s of original data
+func (r BenchResult) DecompressSpeed() float64 {
+	return megabytesPerSecond(r.OriginalSize, r.DecompressTime)
+}
+
+func megabytesPerSecond(size int, elapsed time.Duration) float64 {
+	if elapsed <= 0 {
+		return 0
+	}
+	return float64(size) / 1e6 / elapsed.Seconds()
+}
+
+// Benchmark compresses data in memory at level, decodes it again and checks
+// the round trip, coding up to workers blocks at once. Only the codec is
+// timed, no file I/O.
+func Benchmark(data []byte, level, blockSize, workers int) (BenchResult, error) {
+	result := BenchResult{Level: level, OriginalSize: len(data)}
+
+	var compressed bytes.Buffer
+	start := time.Now()
+	err := CompressStreamWorkers(bytes.NewReader(data), &compressed, blockSize, level, DefaultFlags, workers)
+	result.CompressTime = time.Since(start)
+	if err != nil {
+		return result, err
+	}
+	result.CompressedSize = compressed.Len()
+
+	start = time.Now()
+	reader, err := NewStreamReader(&compressed)
+	if err != nil {
+		return result, err
+	}
+	reader.SetConcurrency(workers)
+	decoded, err := io.ReadAll(reader)
+	result.DecompressTime = time.Since(start)
+	if err != nil {
+		return result, err
+	}
+	if !bytes.Equal(decoded, data) {
+		return result, fmt.Errorf("level %d: decoded data differs from the input", level)
+	}
+	return result, nil
+}
@@ -1,70 +1,111 @@
 package internal
 
-import (
-	"io"
-)
+import "io"
+
+// bitBufferSize is how many complete bytes are collected before they are
+// handed to the writer
+const bitBufferSize = 4096
 
 type BitBuffer struct {
-	currentByte byte      // Current byte being built
-	bitPosition int       // Position in current byte (0-7)
-	writer      io.Writer // Where to write complete bytes
-	totalBits   int       // For statistics
+	acc       uint64    // Pending bits, first bit in the MSB
+	accBits   int       // Number of pending bits in acc (0-63)
+	buffer    []byte    // Complete bytes not yet written
+	writer    io.Writer // Where to write complete bytes
+	totalBits int       // For statistics
+	err       error     // First write error, returned by every later call
 }
 
 func NewBitBuffer(writer io.Writer) *BitBuffer {
 	return &BitBuffer{
-		currentByte: 0,
-		bitPosition: 0,
-		writer:      writer,
-		totalBits:   0,
+		buffer:    make([]byte, 0, bitBufferSize),
+		writer:    writer,
+		totalBits: 0,
 	}
 }
 
-// WriteBit writes a single bit and flushes when byte is full
-func (bb *BitBuffer) WriteBit(bit uint64) {
-	// Set bit in current byte
-	if bit == 1 {
-		mask := byte(1 << (7 - bb.bitPosition))
-		bb.currentByte |= mask
+// WriteBit writes a single bit
+func (bb *BitBuffer) WriteBit(bit uint64) error {
+	return bb.WriteBits(bit&1, 1)
+}
+
+// WriteBits writes the low length bits of bits in one step. Bits are taken
+// from LSB (position 0) to MSB (position length-1), matching how appendBit
+// stores them.
+func (bb *BitBuffer) WriteBits(bits uint64, length int) error {
+	if bb.err != nil {
+		return bb.err
+	}
+	if length <= 0 {
+		return nil
 	}
 
-	bb.bitPosition++
-	bb.totalBits++
+	// Reverse so the first bit of the code becomes the most significant
+	code := reverseCode(bits, length)
+	bb.totalBits += length
 
-	// if byte is complete, write it to file immediately
-	if bb.bitPosition == 8 {
-		bb.Flush()
+	// Codes may be up to 64 bits, split the ones that don't fit
+	free := 64 - bb.accBits
+	if length > free {
+		rest := length - free
+		bb.acc |= code >> rest
+		bb.accBits = 64
+		bb.drain()
+		code &= 1<<rest - 1
+		length = rest
 	}
 
+	bb.acc |= code << (64 - bb.accBits - length)
+	bb.accBits += length
+	bb.drain()
+
+	return bb.err
 }
 
-func (bb *BitBuffer) WriteBits(bits uint64, length int) {
-	// Write bits from LSB (position 0) to MSB (position length-1)
-	// This matches how appendBit() stores them
-	for i := 0; i < length; i++ {
-		bit := (bits >> i) & 1
-		bb.WriteBit(bit)
+// drain moves complete bytes from the accumulator into the byte buffer
+func (bb *BitBuffer) drain() {
+	for bb.accBits >= 8 {
+		bb.buffer = append(bb.buffer, byte(bb.acc>>56))
+		bb.acc <<= 8
+		bb.accBits -= 8
+	}
+
+	if len(bb.buffer) >= bitBufferSize {
+		bb.writeBuffer()
 	}
 }
 
-func (bb *BitBuffer) Flush() {
-	// Write byte to file
-	bb.writer.Write([]byte{bb.currentByte})
+func (bb *BitBuffer) writeBuffer() {
+	if bb.err != nil || len(bb.buffer) == 0 {
+		return
+	}
+	_, err := bb.writer.Write(bb.buffer)
+	if err != nil {
+		bb.err = err
+	}
+	bb.buffer = bb.buffer[:0]
+}
 
-	// Reset for next byte
-	bb.currentByte = 0
-	bb.bitPosition = 0
+// Flush writes every complete byte to the writer. Bits of an incomplete
+// byte stay pending until more bits arrive or Close is called.
+func (bb *BitBuffer) Flush() error {
+	bb.writeBuffer()
+	return bb.err
 }
 
+// Close pads the last byte with zeros, writes everything out and returns the
+// number of padding bits
 func (bb *BitBuffer) Close() (int, error) {
 	paddingBits := bb.GetPaddingBits()
 	// if there are incomplete bits, pad and flush
-	if bb.bitPosition > 0 {
-		// currentByte already has the bits, just write it
-		bb.writer.Write([]byte{bb.currentByte})
+	if bb.accBits > 0 {
+		// acc already has the bits with zeros after them, just take the byte
+		bb.buffer = append(bb.buffer, byte(bb.acc>>56))
+		bb.acc = 0
+		bb.accBits = 0
 	}
 
-	return paddingBits, nil
+	bb.writeBuffer()
+	return paddingBits, bb.err
 }
 
 func (bb *BitBuffer) GetTotalBits() int {
@@ -72,8 +113,8 @@ func (bb *BitBuffer) GetTotalBits() int {
 }
 
 func (bb *BitBuffer) GetPaddingBits() int {
-	if bb.bitPosition == 0 {
+	if bb.accBits%8 == 0 {
 		return 0
 	}
-	return 8 - bb.bitPosition
+	return 8 - bb.accBits%8
 }
@@ -3,48 +3,99 @@ package internal
 import "io"
 
 type BitReader struct {
-	reader      io.Reader // where to read bytes from
-	currentByte byte      // Current byte being read
-	bitPosition int       // position in current byte (0-7)
-	finished    bool      // No more data to read
+	reader   io.Reader // where to read bytes from
+	buffer   []byte    // bytes read from reader but not yet used
+	readBuf  []byte    // backing storage for buffer
+	acc      uint64    // unread bits, next bit is the MSB
+	accBits  int       // number of valid bits in acc
+	finished bool      // No more data to read
+	err      error     // read error other than EOF
 }
 
+// MaxPeekBits is the most bits PeekBits can return at once
+const MaxPeekBits = 56
+
 func NewBitReader(reader io.Reader) *BitReader {
 	return &BitReader{
-		reader:      reader,
-		currentByte: 0,
-		bitPosition: 8, // Start at 8 to trigger first read
-		finished:    false,
+		reader:   reader,
+		readBuf:  make([]byte, 4096),
+		finished: false,
+	}
+}
+
+// fill tops up the accumulator to at least n bits if the stream has them
+func (br *BitReader) fill(n int) {
+	for br.accBits < n {
+		if len(br.buffer) == 0 {
+			if br.err != nil || br.reader == nil {
+				return
+			}
+			// Read next chunk from stream
+			count, err := br.reader.Read(br.readBuf)
+			br.buffer = br.readBuf[:count]
+			if err != nil && err != io.EOF {
+				br.err = err
+			}
+			if count == 0 {
+				if err == nil {
+					// Treat an empty read like the end of the stream
+					err = io.EOF
+				}
+				if err == io.EOF {
+					br.reader = nil
+				}
+				return
+			}
+		}
+
+		br.acc |= uint64(br.buffer[0]) << (56 - br.accBits)
+		br.buffer = br.buffer[1:]
+		br.accBits += 8
 	}
 }
 
 func (br *BitReader) ReadBit() (uint8, error) {
 	// Reads a single bit (0 or 1)
-	// If we've read all bits from current byte, get next byte
-	if br.bitPosition >= 8 {
-		// Read next byte from stream
-		buf := make([]byte, 1)
-		n, err := br.reader.Read(buf)
-		if err == io.EOF || n == 0 {
+	if br.accBits == 0 {
+		br.fill(1)
+		if br.accBits == 0 {
+			if br.err != nil {
+				return 0, br.err
+			}
 			br.finished = true
 			return 0, io.EOF
 		}
-		if err != nil {
-			return 0, err
-		}
-
-		br.currentByte = buf[0]
-		br.bitPosition = 0 // Reset to read from MSB
 	}
 
-	// Extract bit at current position
-	// MSB is position 0, LSB is position 7
-	bitValue := (br.currentByte >> (7 - br.bitPosition)) & 1
-	br.bitPosition++
+	// MSB of the accumulator is the next bit in the stream
+	bitValue := uint8(br.acc >> 63)
+	br.acc <<= 1
+	br.accBits--
 
 	return bitValue, nil
 }
 
+// PeekBits returns the next n bits (n <= MaxPeekBits) without consuming
+// them, first bit in the most significant position. Near the end of the
+// stream fewer bits may be available: the missing ones are zero and the
+// second result tells how many are real.
+func (br *BitReader) PeekBits(n int) (uint64, int) {
+	br.fill(n)
+	available := min(n, br.accBits)
+	return br.acc >> (64 - n), available
+}
+
+// SkipBits consumes n bits previously returned by PeekBits
+func (br *BitReader) SkipBits(n int) {
+	br.acc <<= n
+	br.accBits -= n
+}
+
+// Err returns the first read error other than io.EOF
+func (br *BitReader) Err() error {
+	return br.err
+}
+
 func (br *BitReader) IsFinished() bool {
 	return br.finished
 }
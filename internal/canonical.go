@@ -0,0 +1,132 @@
+package internal
+
+import (
+	"fmt"
+	"math/bits"
+)
+
+// Canonical Huffman codes are fully determined by the code length of every
+// symbol: codes are handed out in order of (length, symbol), each one being
+// the previous code plus one, shifted left whenever the length grows. This
+// means a header only has to store lengths, not frequencies or the tree.
+
+// MaxCanonicalLength is the longest code length a canonical table may use
+const MaxCanonicalLength = 63
+
+// CodeLengths returns the code length of every byte value (0 for unused
+// bytes) as assigned by the tree rooted at root
+func CodeLengths(root *HuffmanNode) []uint8 {
+	lengths := make([]uint8, 256)
+	for char, code := range GenerateCodes(root) {
+		lengths[char] = uint8(code.length)
+	}
+	return lengths
+}
+
+// GenerateCanonicalCodes returns canonical codes with the same lengths as
+// the codes GenerateCodes would produce for root
+func GenerateCanonicalCodes(root *HuffmanNode) (CodeTable, error) {
+	if root == nil {
+		return nil, nil
+	}
+	return CodeTableFromLengths(CodeLengths(root))
+}
+
+// CodeTableFromLengths rebuilds the canonical code table for a 256 entry
+// length table
+func CodeTableFromLengths(lengths []uint8) (CodeTable, error) {
+	codes, err := CanonicalCodes(lengths)
+	if err != nil {
+		return nil, err
+	}
+
+	codeTable := make(CodeTable)
+	for symbol, code := range codes {
+		if code.length > 0 {
+			codeTable[byte(symbol)] = code
+		}
+	}
+	return codeTable, nil
+}
+
+// CanonicalCodes assigns canonical codes for lengths, indexed by symbol.
+// Symbols with length 0 get an empty code. The returned bits use the same
+// LSB-first layout as appendBit so they can be passed to WriteBits.
+func CanonicalCodes(lengths []uint8) ([]HuffmanCode, error) {
+	err := ValidateCodeLengths(lengths)
+	if err != nil {
+		return nil, err
+	}
+
+	// Count codes of each length
+	var lengthCount [MaxCanonicalLength + 1]uint64
+	for _, length := range lengths {
+		if length > 0 {
+			lengthCount[length]++
+		}
+	}
+
+	// First code of each length
+	var nextCode [MaxCanonicalLength + 1]uint64
+	code := uint64(0)
+	for length := 1; length <= MaxCanonicalLength; length++ {
+		code = (code + lengthCount[length-1]) << 1
+		nextCode[length] = code
+	}
+
+	// Hand out codes in symbol order
+	codes := make([]HuffmanCode, len(lengths))
+	for symbol, length := range lengths {
+		if length == 0 {
+			continue
+		}
+		codes[symbol] = HuffmanCode{
+			bits:   reverseCode(nextCode[length], int(length)),
+			length: int(length),
+		}
+		nextCode[length]++
+	}
+	return codes, nil
+}
+
+// ValidateCodeLengths checks that lengths describe a usable prefix code:
+// at least one symbol, no length above MaxCanonicalLength and no length
+// over-subscribed (Kraft sum above 1)
+func ValidateCodeLengths(lengths []uint8) error {
+	var lengthCount [MaxCanonicalLength + 1]int
+	symbols := 0
+	for symbol, length := range lengths {
+		if length > MaxCanonicalLength {
+			return fmt.Errorf("invalid code lengths: symbol %d has length %d (max %d)", symbol, length, MaxCanonicalLength)
+		}
+		if length > 0 {
+			lengthCount[length]++
+			symbols++
+		}
+	}
+
+	if symbols == 0 {
+		return fmt.Errorf("invalid code lengths: no symbols")
+	}
+
+	// left = number of unused codes at the current length
+	left := 1
+	for length := 1; length <= MaxCanonicalLength; length++ {
+		left <<= 1
+		left -= lengthCount[length]
+		if left < 0 {
+			return fmt.Errorf("invalid code lengths: over-subscribed at length %d", length)
+		}
+		// Once there are more free codes than symbols it can't go negative
+		if left > symbols {
+			left = symbols
+		}
+	}
+	return nil
+}
+
+// reverseCode converts a code written MSB-first (the usual way canonical
+// codes are numbered) into the LSB-first layout of HuffmanCode.bits
+func reverseCode(code uint64, length int) uint64 {
+	return bits.Reverse64(code) >> (64 - length)
+}
@@ -0,0 +1,174 @@
+package internal
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+)
+
+// Checksum flags. Files and streams with either flag end with a trailer:
+//
+//	[CompressedCRC:4][ContentCRC:4]   FlagChecksum, CRC-32 (IEEE), big-endian
+//	[ContentSHA256:32]                FlagSHA256
+//
+// CompressedCRC covers the bytes after the header: the payload of a file, or
+// every block and the end-of-stream marker of a framed stream. It can be
+// checked without decoding. ContentCRC and ContentSHA256 cover the original
+// data.
+const (
+	FlagChecksum uint8 = 1 << 0
+	FlagSHA256   uint8 = 1 << 1
+)
+
+// DefaultFlags are the flags used when the caller doesn't choose any
+const DefaultFlags = FlagChecksum
+
+// ChecksumError is returned when data doesn't match the checksum stored in
+// its trailer
+type ChecksumError struct {
+	Kind     string // "compressed data", "content", "content SHA-256", "archive directory" or "index"
+	Expected []byte
+	Actual   []byte
+}
+
+func (e *ChecksumError) Error() string {
+	return fmt.Sprintf("%s checksum mismatch: expected %x, got %x", e.Kind, e.Expected, e.Actual)
+}
+
+// Trailer holds the checksums stored after the compressed data
+type Trailer struct {
+	CompressedCRC uint32
+	ContentCRC    uint32
+	ContentSHA256 [sha256.Size]byte
+}
+
+// TrailerSize returns the size of the trailer written for flags
+func TrailerSize(flags uint8) int {
+	size := 0
+	if flags&FlagChecksum != 0 {
+		size += 8
+	}
+	if flags&FlagSHA256 != 0 {
+		size += sha256.Size
+	}
+	return size
+}
+
+// WriteTrailer writes the fields of trailer selected by flags
+func WriteTrailer(writer io.Writer, trailer Trailer, flags uint8) error {
+	buf := make([]byte, 0, TrailerSize(flags))
+	if flags&FlagChecksum != 0 {
+		buf = binary.BigEndian.AppendUint32(buf, trailer.CompressedCRC)
+		buf = binary.BigEndian.AppendUint32(buf, trailer.ContentCRC)
+	}
+	if flags&FlagSHA256 != 0 {
+		buf = append(buf, trailer.ContentSHA256[:]...)
+	}
+	_, err := writer.Write(buf)
+	return err
+}
+
+// ReadTrailer reads the trailer fields selected by flags
+func ReadTrailer(reader io.Reader, flags uint8) (Trailer, error) {
+	trailer := Trailer{}
+	buf := make([]byte, TrailerSize(flags))
+	_, err := io.ReadFull(reader, buf)
+	if err != nil {
+		return trailer, fmt.Errorf("failed to read checksum trailer: %w", unexpectedEOF(err))
+	}
+
+	if flags&FlagChecksum != 0 {
+		trailer.CompressedCRC = binary.BigEndian.Uint32(buf[0:4])
+		trailer.ContentCRC = binary.BigEndian.Uint32(buf[4:8])
+		buf = buf[8:]
+	}
+	if flags&FlagSHA256 != 0 {
+		copy(trailer.ContentSHA256[:], buf)
+	}
+	return trailer, nil
+}
+
+// checksums accumulates the hashes selected by flags while data is written
+// or read
+type checksums struct {
+	flags      uint8
+	compressed hash.Hash32
+	content    hash.Hash32
+	sha        hash.Hash
+}
+
+func newChecksums(flags uint8) *checksums {
+	c := &checksums{flags: flags}
+	if flags&FlagChecksum != 0 {
+		c.compressed = crc32.NewIEEE()
+		c.content = crc32.NewIEEE()
+	}
+	if flags&FlagSHA256 != 0 {
+		c.sha = sha256.New()
+	}
+	return c
+}
+
+// compressedWriter returns the writer compressed bytes should be hashed with
+func (c *checksums) compressedWriter() io.Writer {
+	if c.compressed == nil {
+		return io.Discard
+	}
+	return c.compressed
+}
+
+// addContent hashes original data
+func (c *checksums) addContent(data []byte) {
+	if c.content != nil {
+		c.content.Write(data)
+	}
+	if c.sha != nil {
+		c.sha.Write(data)
+	}
+}
+
+func (c *checksums) trailer() Trailer {
+	trailer := Trailer{}
+	if c.compressed != nil {
+		trailer.CompressedCRC = c.compressed.Sum32()
+		trailer.ContentCRC = c.content.Sum32()
+	}
+	if c.sha != nil {
+		c.sha.Sum(trailer.ContentSHA256[:0])
+	}
+	return trailer
+}
+
+// verify compares the accumulated hashes with the ones read from a trailer.
+// The compressed data is checked first: when it is damaged the content
+// mismatch is only a consequence.
+func (c *checksums) verify(expected Trailer) error {
+	actual := c.trailer()
+	if c.compressed != nil {
+		if actual.CompressedCRC != expected.CompressedCRC {
+			return crcMismatch("compressed data", expected.CompressedCRC, actual.CompressedCRC)
+		}
+		if actual.ContentCRC != expected.ContentCRC {
+			return crcMismatch("content", expected.ContentCRC, actual.ContentCRC)
+		}
+	}
+	if c.sha != nil && actual.ContentSHA256 != expected.ContentSHA256 {
+		return &ChecksumError{
+			Kind:     "content SHA-256",
+			Expected: expected.ContentSHA256[:],
+			Actual:   actual.ContentSHA256[:],
+		}
+	}
+	return nil
+}
+
+func crcMismatch(kind string, expected, actual uint32) error {
+	return &ChecksumError{
+		Kind:     kind,
+		Expected: binary.BigEndian.AppendUint32(nil, expected),
+		Actual:   binary.BigEndian.AppendUint32(nil, actual),
+	}
+}
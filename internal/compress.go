@@ -27,19 +27,12 @@ func CompressFile(inputPath, outputPath string) error {
 
 	// ==================== PHASE 2: Build Tree and Codes ====================
 
-	// Build Huffman Tree
-	root, err := BuildHuffmanTree(freqTable)
+	// Build Huffman Tree and generate the code table from it
+	_, codeTable, err := buildCodes(freqTable)
 	if err != nil {
-		return fmt.Errorf("failed to build huffman tree: %s", err)
+		return err
 	}
 
-	if len(freqTable) > 255 {
-		return fmt.Errorf("file contains %d unique byte values (max 255 supported)", len(freqTable))
-	}
-
-	// Generate code table from tree
-	codeTable := GenerateCodes(root)
-
 	// Optional: verify codes are prefix-free (debug mode)
 	if !VerifyPrefixFree(codeTable) {
 		return fmt.Errorf("generated codes are not prefix-free")
@@ -47,17 +40,19 @@ func CompressFile(inputPath, outputPath string) error {
 
 	// ==================== PHASE 3: Create Output File ====================
 
-	// Create output file
-	outputFile, err := os.Create(outputPath)
+	// Create output file, under a temporary name until it is complete
+	outputFile, err := CreateAtomic(outputPath, 0644)
 	if err != nil {
-		return fmt.Errorf("failed to create the output file")
+		return fmt.Errorf("failed to create the output file: %w", err)
 	}
 
-	defer outputFile.Close()
+	defer outputFile.Abort()
 
 	// ==================== PHASE 4: Write Header (Placeholder) ====================
-	// Write header with padding = 0 (we'll update this later)
-	err = WriteHeader(outputFile, freqTable, originalSize, 0)
+	// Write header with padding = 0 (we'll update this later).
+	// Version 2 handles all 256 byte values and frequencies above 4 GiB.
+	flags := DefaultFlags
+	err = WriteHeaderV2(outputFile, freqTable, originalSize, 0, flags)
 	if err != nil {
 		return fmt.Errorf("failed to write header: %s", err)
 	}
@@ -69,20 +64,25 @@ func CompressFile(inputPath, outputPath string) error {
 		return fmt.Errorf("failed to open input file: %s", err)
 	}
 	defer inputFile.Close()
-	// Create bit buffer that writes to the file
-	bitBuffer := NewBitBuffer(outputFile)
+	// Create bit buffer that writes to the file, hashing the payload on the way
+	sums := newChecksums(flags)
+	bitBuffer := NewBitBuffer(io.MultiWriter(outputFile, sums.compressedWriter()))
 
 	// Read and encode file in chunks (streaming approach)
 	buffer := make([]byte, 1024)
 	// Encode each byte in the input data
 	for {
 		count, err := inputFile.Read(buffer)
+		sums.addContent(buffer[:count])
 
 		// Encode each byte in this chunk
 		for i := 0; i < count; i++ {
 			char := buffer[i]
 			code := codeTable[char]
-			bitBuffer.WriteBits(code.bits, code.length)
+			writeErr := bitBuffer.WriteBits(code.bits, code.length)
+			if writeErr != nil {
+				return fmt.Errorf("failed to write compressed data: %w", writeErr)
+			}
 		}
 
 		if err == io.EOF {
@@ -100,16 +100,22 @@ func CompressFile(inputPath, outputPath string) error {
 	// Close Buffer (flushes remaining bits with padding)
 	_, err = bitBuffer.Close()
 	if err != nil {
-		return fmt.Errorf("failed to close bit buffer: %s", err)
+		return fmt.Errorf("failed to close bit buffer: %w", err)
+	}
+
+	// Checksums go after the payload
+	err = WriteTrailer(outputFile, sums.trailer(), flags)
+	if err != nil {
+		return fmt.Errorf("failed to write checksum trailer: %w", err)
 	}
 
 	// ==================== PHASE 6: Update Padding in Header ====================
 
 	// Seek to padding byte position in header
-	// Header structure: [HF:2][OrigSize:8][NumChars:1][PaddingBits:1][FreqEntries...]
-	// Padding byte is at offset 11 (2 + 8 + 1)
+	// Header structure: [HF:2][Version:1][Flags:1][PaddingBits:1][OrigSize][NumChars:2][FreqEntries...]
+	// Padding byte is at offset 4 (2 + 1 + 1)
 
-	paddingByteOffset := int64(11)
+	paddingByteOffset := int64(HeaderV2PaddingOffset)
 
 	_, err = outputFile.Seek(paddingByteOffset, io.SeekStart)
 	if err != nil {
@@ -122,7 +128,9 @@ func CompressFile(inputPath, outputPath string) error {
 		return fmt.Errorf("failed to update padding byte: %s", err)
 	}
 
-	return nil
+	// Sync and rename into place, a failed close can mean data never
+	// reached the disk
+	return outputFile.Commit()
 }
 
 type CompressionStats struct {
@@ -1,12 +1,28 @@
 package internal
 
 import (
+	"bufio"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 )
 
 func Decompress(inputPath, outputPath string) error {
+	return DecompressLimits(inputPath, outputPath, DecodeLimits{})
+}
+
+// DecompressLimits is like Decompress but fails with a *LimitError when the
+// output would break limits. Output is written to a temporary file renamed
+// into place on success, so no partial output is left behind on errors.
+func DecompressLimits(inputPath, outputPath string, limits DecodeLimits) error {
+	return DecompressWorkers(inputPath, outputPath, limits, 1)
+}
+
+// DecompressWorkers is like DecompressLimits, decoding up to workers blocks
+// of a framed stream at once (see StreamReader.SetConcurrency). A .hf file
+// is a single bit stream and is always decoded on one goroutine.
+func DecompressWorkers(inputPath, outputPath string, limits DecodeLimits, workers int) error {
 	// ==================== PHASE 1: Open Compressed File ====================
 	inputFile, err := os.Open(inputPath)
 	if err != nil {
@@ -14,10 +30,24 @@ func Decompress(inputPath, outputPath string) error {
 	}
 	defer inputFile.Close()
 
+	inputInfo, err := inputFile.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to stat compressed file: %w", err)
+	}
+
+	input := &countingReader{reader: inputFile}
+	reader := bufio.NewReader(input)
+
+	// Framed streams carry a table per block and are decoded block by block
+	magic, err := reader.Peek(len(StreamMagic))
+	if err == nil && string(magic) == StreamMagic {
+		return decompressStreamFile(reader, input, outputPath, limits, workers)
+	}
+
 	// ==================== PHASE 2: Read and parse Header ====================
-	header, err := ReadHeader(inputFile)
+	header, err := ReadHeader(reader)
 	if err != nil {
-		return fmt.Errorf("failed to read header: %s", err)
+		return fmt.Errorf("failed to read header: %w", err)
 	}
 	// Extract info from header
 	originalSize := header.OriginalSize
@@ -33,6 +63,17 @@ func Decompress(inputPath, outputPath string) error {
 		return fmt.Errorf("invalid header: freq table is empty")
 	}
 
+	err = header.checkFrequencies()
+	if err != nil {
+		return err
+	}
+
+	// Decoding stops at OriginalSize, so checking it covers both limits
+	err = limits.check(originalSize, uint64(inputInfo.Size()))
+	if err != nil {
+		return err
+	}
+
 	// ==================== PHASE 3: Rebuild Huffman Tree ====================
 	// Rebuild the tree from frequencies (same as compression)
 	root, err := BuildHuffmanTree(freqTable)
@@ -43,18 +84,26 @@ func Decompress(inputPath, outputPath string) error {
 	// ==================== PHASE 4: Create Output File ====================
 
 	// Create output file for decompressed data
-	outputFile, err := os.Create(outputPath)
+	outputFile, err := CreateAtomic(outputPath, 0644)
 	if err != nil {
 
 		return fmt.Errorf("failed to create output file: %w", err)
 	}
 
-	defer outputFile.Close()
+	defer outputFile.Abort()
 
 	// ==================== PHASE 5: Decode Bit Stream ====================
 	// Create bit reader for the compressed data
-	// (inputFile is already positioned after header)
-	bitReader := NewBitReader(inputFile)
+	// (reader is already positioned after header)
+	// With a trailer the reader has to stop at the end of the payload, the
+	// bit reader reads ahead and would swallow the checksums otherwise
+	sums := newChecksums(header.Flags)
+	var payload io.Reader = reader
+	if TrailerSize(header.Flags) > 0 {
+		payloadSize := CalculatePayloadSize(freqTable, GenerateCodes(root))
+		payload = io.TeeReader(io.LimitReader(reader, int64(payloadSize)), sums.compressedWriter())
+	}
+	bitReader := NewBitReader(payload)
 
 	// Buffer for writing decoded bytes for efficiency
 	writeBuffer := make([]byte, 0, 1024)
@@ -62,13 +111,12 @@ func Decompress(inputPath, outputPath string) error {
 	// track how many bytes we decoded
 	bytesDecoded := uint64(0)
 
-	// Start at root of tree
-	currentNode := root
+	// Lookup tables decode a whole code per step instead of one bit
+	decoder := NewDecoder(root)
 
-	// Read bits until we decoded all bytes
+	// Read symbols until we decoded all bytes
 	for bytesDecoded < originalSize {
-		// Read next bit
-		bit, err := bitReader.ReadBit()
+		char, err := decoder.DecodeByte(bitReader)
 
 		// Handle EOF or errors
 		if err == io.EOF {
@@ -77,45 +125,28 @@ func Decompress(inputPath, outputPath string) error {
 			break
 		}
 		if err != nil {
-			return fmt.Errorf("failed to read bit: %s", err)
+			return fmt.Errorf("failed to decode data: %s", err)
 		}
 
-		// Traverse tree based on bit value
-		if bit == 0 {
-			currentNode = currentNode.left
-		} else {
-			currentNode = currentNode.right
-		}
+		// Add to write buffer
+		writeBuffer = append(writeBuffer, char)
+		bytesDecoded++
 
-		// Safety check: if not at leaf, must have children
-		if !currentNode.IsLeaf() && currentNode.left == nil {
-			return fmt.Errorf("corrupted data: invalid tree traversal")
-		}
-		// Check if we hit a leaf node
-		if currentNode.IsLeaf() {
-			// Found a character
-			char := currentNode.GetChar()
-
-			// Add to write buffer
-			writeBuffer = append(writeBuffer, char)
-			bytesDecoded++
-
-			// Flush buffer when it gets large (for efficiency)
-			if len(writeBuffer) >= 1024 {
-				_, err := outputFile.Write(writeBuffer)
-				if err != nil {
-					return fmt.Errorf("failed to write output: %s", err)
-				}
-				writeBuffer = writeBuffer[:0] // Reset Buffer
+		// Flush buffer when it gets large (for efficiency)
+		if len(writeBuffer) >= 1024 {
+			sums.addContent(writeBuffer)
+			_, err := outputFile.Write(writeBuffer)
+			if err != nil {
+				return fmt.Errorf("failed to write output: %s", err)
 			}
-			// Reset to root for next character
-			currentNode = root
+			writeBuffer = writeBuffer[:0] // Reset Buffer
 		}
 	}
 
 	// ==================== PHASE 6: Flush Remaining Data ====================
 	/// Write any remaining bytes in buffer
 	if len(writeBuffer) > 0 {
+		sums.addContent(writeBuffer)
 		_, err := outputFile.Write(writeBuffer)
 		if err != nil {
 			return fmt.Errorf("failed to write final output: %s", err)
@@ -128,7 +159,116 @@ func Decompress(inputPath, outputPath string) error {
 	if bytesDecoded != originalSize {
 		return fmt.Errorf("decoded %d bytes, expected %d", bytesDecoded, originalSize)
 	}
-	return nil
+
+	// ==================== PHASE 8: Verify Checksums ====================
+	if TrailerSize(header.Flags) > 0 {
+		// Hash payload bytes the decoder didn't need to read
+		_, err = io.Copy(io.Discard, payload)
+		if err != nil {
+			return fmt.Errorf("failed to read compressed data: %w", err)
+		}
+
+		trailer, err := ReadTrailer(reader, header.Flags)
+		if err != nil {
+			return err
+		}
+		err = sums.verify(trailer)
+		if err != nil {
+			return fmt.Errorf("corrupted file: %w", err)
+		}
+	}
+
+	return outputFile.Commit()
+}
+
+func decompressStreamFile(reader io.Reader, input *countingReader, outputPath string, limits DecodeLimits, workers int) error {
+	streamReader, err := NewStreamReader(reader)
+	if err != nil {
+		return err
+	}
+	streamReader.SetConcurrency(workers)
+	streamReader.limits = limits
+
+	outputFile, err := CreateAtomic(outputPath, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to create output file: %w", err)
+	}
+	defer outputFile.Abort()
+
+	writer := bufio.NewWriter(outputFile)
+	_, err = io.Copy(writer, newLimitedReader(streamReader, input, limits))
+	var limitErr *LimitError
+	if errors.As(err, &limitErr) {
+		return limitErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to decompress stream: %w", err)
+	}
+
+	err = writer.Flush()
+	if err != nil {
+		return fmt.Errorf("failed to write output: %w", err)
+	}
+	return outputFile.Commit()
+}
+
+// DecodeSymbol walks the tree from root one bit at a time until it reaches a
+// leaf and returns that leaf's character. io.EOF is returned when the stream
+// runs out of bits.
+func DecodeSymbol(bitReader *BitReader, root *HuffmanNode) (byte, error) {
+	currentNode := root
+	for {
+		bit, err := bitReader.ReadBit()
+		if err != nil {
+			return 0, err
+		}
+
+		// Traverse tree based on bit value
+		if bit == 0 {
+			currentNode = currentNode.left
+		} else {
+			currentNode = currentNode.right
+		}
+
+		// Safety check: bits must follow an existing branch
+		if currentNode == nil {
+			return 0, fmt.Errorf("corrupted data: invalid tree traversal")
+		}
+
+		// The dummy leaf of a single character tree has no code
+		if currentNode.IsDummy() {
+			return 0, fmt.Errorf("corrupted data: invalid code")
+		}
+
+		// Check if we hit a leaf node
+		if currentNode.IsLeaf() {
+			return currentNode.GetChar(), nil
+		}
+	}
+}
+
+// VerifyCompressedFile decodes inputPath without writing the output and
+// checks it against its stored checksums. Files without checksums are only
+// checked for decoding errors.
+func VerifyCompressedFile(inputPath string) error {
+	return VerifyCompressedFileLimits(inputPath, DecodeLimits{})
+}
+
+// VerifyCompressedFileLimits is like VerifyCompressedFile but fails with a
+// *LimitError once decoding breaks limits
+func VerifyCompressedFileLimits(inputPath string, limits DecodeLimits) error {
+	inputFile, err := os.Open(inputPath)
+	if err != nil {
+		return fmt.Errorf("failed to open compressed file: %w", err)
+	}
+	defer inputFile.Close()
+
+	reader, err := NewLimitedReader(inputFile, limits)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(io.Discard, reader)
+	return err
 }
 
 func VerifyDecompression(originalPath, decompressedPath string) error {
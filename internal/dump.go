@@ -0,0 +1,546 @@
+package internal
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// dumpField is a header or trailer field and where it sits in the file
+type dumpField struct {
+	offset int64
+	size   int
+	name   string
+	value  string
+}
+
+// DumpFile writes an annotated dump of the .hf file or framed stream at
+// path, see Dump
+func DumpFile(path string, writer io.Writer, start, end uint64) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return Dump(file, writer, start, end)
+}
+
+// Dump decodes the .hf file or framed stream in reader and writes what
+// every part of it holds: the header fields with their byte offsets, each
+// symbol with the bit its code starts at and its path in the tree, the
+// padding bits and the trailer. Streams show the fields and code table of
+// every block, and their index. Only symbols start <= i < end are listed,
+// counted over the whole original data. The ones before are decoded to find
+// where the listed ones start, the ones after are skipped. Blocks that
+// aren't Huffman coded are shown without their symbols. A decoding error
+// ends the dump at the symbol it happened in.
+func Dump(reader io.Reader, writer io.Writer, start, end uint64) error {
+	buffered := bufio.NewReader(reader)
+	out := bufio.NewWriter(writer)
+
+	var err error
+	magic, _ := buffered.Peek(len(StreamMagic))
+	if string(magic) == StreamMagic {
+		err = dumpStream(out, buffered, start, end)
+	} else {
+		err = dumpFile(out, buffered, start, end)
+	}
+	flushErr := out.Flush()
+	if err == nil {
+		err = flushErr
+	}
+	return err
+}
+
+func dumpFile(out *bufio.Writer, reader io.Reader, start, end uint64) error {
+	// ReadHeader reads byte by byte, so raw ends up holding the header only
+	var raw bytes.Buffer
+	header, err := ReadHeader(io.TeeReader(reader, &raw))
+	if err == nil {
+		err = header.checkFrequencies()
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read header: %w", err)
+	}
+
+	headerSize := int64(raw.Len())
+	fmt.Fprintf(out, "Header: version %d, %d bytes\n", header.Version, headerSize)
+	writeDumpFields(out, headerFields(raw.Bytes(), header))
+
+	payloadSize, err := dumpPayload(out, reader, header, headerSize, start, end)
+	if err != nil {
+		return err
+	}
+
+	offset, err := dumpTrailer(out, reader, header.Flags, headerSize+int64(payloadSize))
+	if err != nil {
+		return err
+	}
+	return dumpExtra(out, reader, offset)
+}
+
+func dumpStream(out *bufio.Writer, reader io.Reader, start, end uint64) error {
+	counted := &countingReader{reader: reader}
+	version, flags, level, err := readStreamHeader(counted)
+	if err != nil {
+		return fmt.Errorf("failed to read stream header: %w", err)
+	}
+
+	fields := []dumpField{
+		{0, len(StreamMagic), "magic", strconv.Quote(StreamMagic)},
+		{2, 1, "version", fmt.Sprint(version)},
+		{3, 1, "flags", fmt.Sprintf("%08b (%s)", flags, FlagNames(flags))},
+	}
+	if version != streamVersion1 {
+		fields = append(fields, dumpField{4, 1, "level", fmt.Sprint(level)})
+	}
+	fmt.Fprintf(out, "Stream header: version %d, %d bytes\n", version, counted.count)
+	writeDumpFields(out, fields)
+	fmt.Fprintf(out, "\nBlocks: each one has its own code table\n")
+	fmt.Fprintf(out, "  Symbols are numbered over the whole original data, bits from the start of\n")
+	fmt.Fprintf(out, "  the payload of their block.\n")
+	writeSymbolLegend(out)
+
+	blocks, size := 0, uint64(0)
+	for {
+		blockStart := int64(counted.count)
+		header, err := readBlockHeader(counted)
+		if err == io.EOF {
+			fmt.Fprintf(out, "\nEnd of stream: %d blocks, %d bytes of data\n", blocks, size)
+			writeDumpFields(out, []dumpField{{blockStart, 4, "end marker", "0"}})
+			break
+		}
+		if err == nil {
+			err = dumpBlock(out, counted, blocks, blockStart, header, flags, size, start, end)
+		}
+		if err != nil {
+			return fmt.Errorf("block %d at byte %d: %w", blocks, blockStart, err)
+		}
+		blocks++
+		size += uint64(header.originalLen)
+	}
+
+	offset, err := dumpTrailer(out, counted, flags, int64(counted.count))
+	if err != nil {
+		return err
+	}
+	if flags&FlagIndex != 0 {
+		offset, err = dumpIndex(out, counted, blocks, offset)
+		if err != nil {
+			return err
+		}
+	}
+	return dumpExtra(out, counted, offset)
+}
+
+// dumpBlock writes the fields of the block of header, which starts at byte
+// blockStart, and its code table and symbols if it is Huffman coded. first
+// is where its data starts in the original data.
+func dumpBlock(out *bufio.Writer, counted *countingReader, block int, blockStart int64, header blockHeader, flags uint8, first, start, end uint64) error {
+	mode, err := readBlockMode(counted, flags)
+	if err != nil {
+		return err
+	}
+
+	fields := []dumpField{
+		{blockStart, 4, "original size", fmt.Sprint(header.originalLen)},
+		{blockStart + 4, 4, "compressed size", fmt.Sprint(header.compressedLen)},
+		{blockStart + 8, 1, "padding bits", fmt.Sprint(header.paddingBits)},
+	}
+	if flags&FlagBlockModes != 0 {
+		fields = append(fields, dumpField{blockStart + blockHeaderSize, 1, "mode", fmt.Sprintf("%d (%s)", mode, blockModeName(mode))})
+	}
+
+	if mode != BlockHuffman {
+		fmt.Fprintf(out, "\nBlock %d: %s, data %d-%d\n", block, blockModeName(mode), first, first+uint64(header.originalLen)-1)
+		writeDumpFields(out, fields)
+		payloadStart := counted.count
+		err = skipBytes(counted, uint64(header.compressedLen))
+		if err != nil {
+			return err
+		}
+		if mode == BlockStored {
+			fmt.Fprintf(out, "  The %d bytes from byte %d are the data as is.\n", header.compressedLen, payloadStart)
+		} else {
+			fmt.Fprintf(out, "  The %d bytes from byte %d are %s coded, only blocks with a code table\n",
+				header.compressedLen, payloadStart, blockModeName(mode))
+			fmt.Fprintf(out, "  list their symbols.\n")
+		}
+		return nil
+	}
+
+	lengthsStart := int64(counted.count)
+	lengths, err := ReadCodeLengths(counted)
+	if err != nil {
+		return unexpectedEOF(err)
+	}
+	codeTable, err := CodeTableFromLengths(lengths)
+	if err != nil {
+		return fmt.Errorf("invalid block: %w", err)
+	}
+	root, err := BuildTreeFromCodes(codeTable)
+	if err != nil {
+		return fmt.Errorf("invalid block: %w", err)
+	}
+	payloadStart := int64(counted.count)
+	fields = append(fields, dumpField{lengthsStart, int(payloadStart - lengthsStart), "code lengths", fmt.Sprintf("%d symbols", len(codeTable))})
+
+	fmt.Fprintf(out, "\nBlock %d: huffman, data %d-%d\n", block, first, first+uint64(header.originalLen)-1)
+	writeDumpFields(out, fields)
+
+	// Canonical codes are handed out in order of length and symbol
+	chars := make([]byte, 0, len(codeTable))
+	for char := range codeTable {
+		chars = append(chars, char)
+	}
+	sort.Slice(chars, func(i, j int) bool {
+		if lengths[chars[i]] != lengths[chars[j]] {
+			return lengths[chars[i]] < lengths[chars[j]]
+		}
+		return chars[i] < chars[j]
+	})
+	fmt.Fprintf(out, "\nBlock %d codes: canonical, rebuilt from the code lengths\n", block)
+	fmt.Fprintf(out, "  %-6s %6s  %s\n", "char", "length", "path")
+	for _, char := range chars {
+		fmt.Fprintf(out, "  %-6s %6d  %s\n", "'"+SymbolName(char)+"'", lengths[char], pathNames.Replace(CodeBits(codeTable[char])))
+	}
+
+	payloadBits := uint64(header.compressedLen) * 8
+	padding := uint64(header.paddingBits)
+	if padding > payloadBits {
+		return fmt.Errorf("invalid block: %d padding bits in %d bytes", padding, header.compressedLen)
+	}
+	coded := codedSymbols{
+		root:      root,
+		codeTable: codeTable,
+		offset:    payloadStart,
+		first:     first,
+		count:     uint64(header.originalLen),
+		codeBits:  payloadBits - padding,
+	}
+	fmt.Fprintf(out, "\nBlock %d payload: %d bytes from byte %d, %d bits of codes and %d padding bits\n",
+		block, header.compressedLen, payloadStart, coded.codeBits, padding)
+
+	payload := io.LimitReader(counted, int64(header.compressedLen))
+	bitReader := NewBitReader(payload)
+	err = dumpCodes(out, bitReader, coded, start, end)
+	if err == nil {
+		err = dumpPadding(out, bitReader, fmt.Sprintf("Block %d padding", block), coded, padding)
+	}
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(io.Discard, payload)
+	if err != nil {
+		return fmt.Errorf("failed to read compressed data: %w", err)
+	}
+	return nil
+}
+
+// pathNames spells code bits as the path they take from the root
+var pathNames = strings.NewReplacer("0", "L", "1", "R")
+
+// dumpPayload lists the symbols in [start, end) and the padding bits, and
+// returns the payload size in bytes
+func dumpPayload(out *bufio.Writer, reader io.Reader, header FileHeader, headerSize int64, start, end uint64) (uint64, error) {
+	if len(header.FreqTable) == 0 {
+		fmt.Fprintf(out, "\nPayload: empty\n")
+		return 0, nil
+	}
+
+	root, codeTable, err := buildCodes(header.FreqTable)
+	if err != nil {
+		return 0, err
+	}
+
+	codeBits := uint64(0)
+	for char, freq := range header.FreqTable {
+		codeBits += uint64(freq) * uint64(codeTable[char].length)
+	}
+	payloadSize := (codeBits + 7) / 8
+	padding := payloadSize*8 - codeBits
+
+	fmt.Fprintf(out, "\nPayload: %d bytes from byte %d, %d bits of codes and %d padding bits\n",
+		payloadSize, headerSize, codeBits, padding)
+	fmt.Fprintf(out, "  Bits are numbered from the start of the payload.\n")
+	writeSymbolLegend(out)
+
+	coded := codedSymbols{
+		root:      root,
+		codeTable: codeTable,
+		offset:    headerSize,
+		count:     header.OriginalSize,
+		codeBits:  codeBits,
+	}
+	payload := io.LimitReader(reader, int64(payloadSize))
+	bitReader := NewBitReader(payload)
+	err = dumpCodes(out, bitReader, coded, start, end)
+	if err == nil {
+		err = dumpPadding(out, bitReader, "Padding", coded, padding)
+	}
+	if err != nil {
+		return 0, err
+	}
+	if uint64(header.PaddingBits) != padding {
+		fmt.Fprintf(out, "  The header says %d padding bits, the frequencies give %d.\n", header.PaddingBits, padding)
+	}
+
+	// The bit reader may have stopped short of the payload end
+	_, err = io.Copy(io.Discard, payload)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read compressed data: %w", err)
+	}
+	return payloadSize, nil
+}
+
+// codedSymbols is a run of count symbols coded with codeTable in codeBits
+// bits, from byte offset of the file. first is the offset of the first
+// symbol in the original data.
+type codedSymbols struct {
+	root      *HuffmanNode
+	codeTable CodeTable
+	offset    int64
+	first     uint64
+	count     uint64
+	codeBits  uint64
+}
+
+func writeSymbolLegend(out *bufio.Writer) {
+	fmt.Fprintf(out, "  byte.bit is the file byte and the bit in it counted from the highest. The\n")
+	fmt.Fprintf(out, "  path is the code as read from the stream, L for 0 and R for 1. The code\n")
+	fmt.Fprintf(out, "  column is CodeToString of the stored code, which prints the bits in reverse.\n")
+}
+
+// dumpCodes lists the symbols of coded in [start, end) and reads past the
+// bits of the others
+func dumpCodes(out *bufio.Writer, bitReader *BitReader, coded codedSymbols, start, end uint64) error {
+	// The listed symbols counted from the first of the run
+	to := min(max(end, coded.first)-coded.first, coded.count)
+	from := min(max(start, coded.first)-coded.first, to)
+	if from < to {
+		fmt.Fprintf(out, "  %10s %12s %12s  %-6s %-16s %s\n", "symbol", "bit", "byte.bit", "char", "code", "path")
+	} else {
+		fmt.Fprintf(out, "  no symbols listed\n")
+	}
+
+	decoder := NewDecoder(coded.root)
+	position := func(bit uint64) string {
+		return fmt.Sprintf("%d.%d", uint64(coded.offset)+bit/8, bit%8)
+	}
+
+	bit := uint64(0)
+	for i := uint64(0); i < to; i++ {
+		symbol := coded.first + i
+		if i < from {
+			char, err := decoder.DecodeByte(bitReader)
+			if err != nil {
+				return fmt.Errorf("symbol %d at bit %d: %w", symbol, bit, unexpectedEOF(err))
+			}
+			bit += uint64(coded.codeTable[char].length)
+			continue
+		}
+
+		char, path, err := readCodePath(bitReader, coded.root)
+		if err != nil {
+			fmt.Fprintf(out, "  %10d %12d %12s  %-6s %-16s %s\n", symbol, bit, position(bit), "?", "?", path)
+			return fmt.Errorf("symbol %d at bit %d: %w", symbol, bit, err)
+		}
+		fmt.Fprintf(out, "  %10d %12d %12s  %-6s %-16s %s\n",
+			symbol, bit, position(bit), "'"+SymbolName(char)+"'", CodeToString(coded.codeTable[char]), path)
+		bit += uint64(len(path))
+	}
+
+	// The symbols after the range don't need decoding, only their bits
+	// have to be passed to reach the padding
+	for bit < coded.codeBits {
+		n := int(min(coded.codeBits-bit, MaxPeekBits))
+		_, available := bitReader.PeekBits(n)
+		if available < n {
+			return fmt.Errorf("payload ends at bit %d, expected %d bits of codes: %w", bit+uint64(available), coded.codeBits, io.ErrUnexpectedEOF)
+		}
+		bitReader.SkipBits(n)
+		bit += uint64(n)
+	}
+	return nil
+}
+
+// dumpPadding reads and explains the padding bits after the codes of coded
+func dumpPadding(out *bufio.Writer, bitReader *BitReader, title string, coded codedSymbols, padding uint64) error {
+	fmt.Fprintf(out, "\n%s: %d bits\n", title, padding)
+	if padding == 0 {
+		fmt.Fprintf(out, "  The codes fill the last byte exactly.\n")
+		return nil
+	}
+
+	var bits []byte
+	for range padding {
+		b, err := bitReader.ReadBit()
+		if err != nil {
+			return fmt.Errorf("failed to read padding bits: %w", unexpectedEOF(err))
+		}
+		bits = append(bits, '0'+b)
+	}
+	lastByte := uint64(coded.offset) + (coded.codeBits+padding)/8 - 1
+	fmt.Fprintf(out, "  bits %d-%d, byte %d bits %d-7: %s\n",
+		coded.codeBits, coded.codeBits+padding-1, lastByte, 8-padding, bits)
+	fmt.Fprintf(out, "  The codes end %d bits into the last byte and the rest is filled up.\n", 8-padding)
+	fmt.Fprintf(out, "  Decoding stops after %d symbols, so these bits are never read as a code.\n", coded.count)
+	if bytes.IndexByte(bits, '1') >= 0 {
+		fmt.Fprintf(out, "  The encoder writes zeros here, set bits point at a damaged last byte.\n")
+	}
+	return nil
+}
+
+// dumpTrailer writes the trailer of flags starting at offset, and returns
+// the offset after it
+func dumpTrailer(out *bufio.Writer, reader io.Reader, flags uint8, offset int64) (int64, error) {
+	if TrailerSize(flags) == 0 {
+		fmt.Fprintf(out, "\nTrailer: none, flags %s\n", FlagNames(flags))
+		return offset, nil
+	}
+	trailer, err := ReadTrailer(reader, flags)
+	if err != nil {
+		return offset, err
+	}
+	fmt.Fprintf(out, "\nTrailer: %d bytes\n", TrailerSize(flags))
+	writeDumpFields(out, trailerFields(trailer, flags, offset))
+	return offset + int64(TrailerSize(flags)), nil
+}
+
+// dumpIndex writes the index of a stream of blocks blocks starting at
+// offset, and returns the offset after it
+func dumpIndex(out *bufio.Writer, reader io.Reader, blocks int, offset int64) (int64, error) {
+	var raw bytes.Buffer
+	entries, err := readIndex(io.TeeReader(reader, &raw), blocks)
+	if err != nil {
+		return offset, err
+	}
+
+	var fields []dumpField
+	for i, entry := range entries {
+		value := fmt.Sprintf("block %d: data from %d, block at byte %d", i, entry.OriginalOffset, entry.CompressedOffset)
+		if i == blocks {
+			value = fmt.Sprintf("end: data size %d, end marker at byte %d", entry.OriginalOffset, entry.CompressedOffset)
+		}
+		fields = append(fields, dumpField{offset, indexEntrySize, "entry", value})
+		offset += indexEntrySize
+	}
+	footer := raw.Bytes()[raw.Len()-indexFooterSize:]
+	fields = append(fields,
+		dumpField{offset, 4, "entries", fmt.Sprint(binary.BigEndian.Uint32(footer[0:4]))},
+		dumpField{offset + 4, 4, "index crc", fmt.Sprintf("%08x", binary.BigEndian.Uint32(footer[4:8]))},
+		dumpField{offset + 8, len(IndexMagic), "magic", strconv.Quote(IndexMagic)},
+	)
+	fmt.Fprintf(out, "\nIndex: %d entries, %d bytes\n", len(entries), raw.Len())
+	writeDumpFields(out, fields)
+	return offset + indexFooterSize, nil
+}
+
+// dumpExtra reports bytes following the end of the file at offset
+func dumpExtra(out *bufio.Writer, reader io.Reader, offset int64) error {
+	extra, err := io.Copy(io.Discard, reader)
+	if err != nil {
+		return err
+	}
+	if extra > 0 {
+		fmt.Fprintf(out, "  %d unexpected bytes follow from byte %d\n", extra, offset)
+	}
+	return nil
+}
+
+// readCodePath reads one code a bit at a time and returns its symbol and
+// the path it took from root. On error the path read so far is returned.
+func readCodePath(bitReader *BitReader, root *HuffmanNode) (byte, string, error) {
+	var path []byte
+	node := root
+	for {
+		bit, err := bitReader.ReadBit()
+		if err != nil {
+			return 0, string(path), unexpectedEOF(err)
+		}
+		if bit == 0 {
+			node = node.left
+			path = append(path, 'L')
+		} else {
+			node = node.right
+			path = append(path, 'R')
+		}
+
+		if node == nil || node.IsDummy() {
+			return 0, string(path), fmt.Errorf("corrupted data: invalid code")
+		}
+		if node.IsLeaf() {
+			return node.GetChar(), string(path), nil
+		}
+	}
+}
+
+// headerFields splits the raw bytes of a header that ReadHeader accepted
+// into its fields
+func headerFields(raw []byte, header FileHeader) []dumpField {
+	fields := []dumpField{{0, len(MagicNumber), "magic", strconv.Quote(MagicNumber)}}
+	if header.Version == HeaderVersion1 {
+		fields = append(fields,
+			dumpField{2, 8, "original size", fmt.Sprint(header.OriginalSize)},
+			dumpField{10, 1, "symbols", fmt.Sprint(header.NumChars)},
+			dumpField{11, 1, "padding bits", fmt.Sprint(header.PaddingBits)},
+		)
+		for offset := 12; offset+5 <= len(raw); offset += 5 {
+			freq := binary.BigEndian.Uint32(raw[offset+1:])
+			fields = append(fields, freqField(int64(offset), 5, raw[offset], uint64(freq)))
+		}
+		return fields
+	}
+
+	fields = append(fields,
+		dumpField{2, 1, "version", fmt.Sprint(header.Version)},
+		dumpField{3, 1, "flags", fmt.Sprintf("%08b (%s)", header.Flags, FlagNames(header.Flags))},
+		dumpField{HeaderV2PaddingOffset, 1, "padding bits", fmt.Sprint(header.PaddingBits)},
+	)
+	offset := HeaderV2PaddingOffset + 1
+	_, n := binary.Uvarint(raw[offset:])
+	fields = append(fields, dumpField{int64(offset), n, "original size", fmt.Sprint(header.OriginalSize)})
+	offset += n
+	fields = append(fields, dumpField{int64(offset), 2, "symbols", fmt.Sprint(header.NumChars)})
+	offset += 2
+	for offset < len(raw) {
+		freq, n := binary.Uvarint(raw[offset+1:])
+		fields = append(fields, freqField(int64(offset), 1+n, raw[offset], freq))
+		offset += 1 + n
+	}
+	return fields
+}
+
+func freqField(offset int64, size int, char byte, freq uint64) dumpField {
+	return dumpField{offset, size, "entry", fmt.Sprintf("'%s' (%d) frequency %d", SymbolName(char), char, freq)}
+}
+
+// trailerFields lists the checksums of trailer stored for flags, starting
+// at offset
+func trailerFields(trailer Trailer, flags uint8, offset int64) []dumpField {
+	var fields []dumpField
+	if flags&FlagChecksum != 0 {
+		fields = append(fields,
+			dumpField{offset, 4, "compressed crc", fmt.Sprintf("%08x", trailer.CompressedCRC)},
+			dumpField{offset + 4, 4, "content crc", fmt.Sprintf("%08x", trailer.ContentCRC)},
+		)
+		offset += 8
+	}
+	if flags&FlagSHA256 != 0 {
+		fields = append(fields, dumpField{offset, len(trailer.ContentSHA256), "content sha256", fmt.Sprintf("%x", trailer.ContentSHA256)})
+	}
+	return fields
+}
+
+func writeDumpFields(out *bufio.Writer, fields []dumpField) {
+	fmt.Fprintf(out, "  %8s %5s  %s\n", "offset", "size", "field")
+	for _, field := range fields {
+		fmt.Fprintf(out, "  %8d %5d  %-15s %s\n", field.offset, field.size, field.name, field.value)
+	}
+}
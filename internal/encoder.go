@@ -2,7 +2,7 @@ package internal
 
 import (
 	"fmt"
-	"unicode"
+	"sort"
 )
 
 type HuffmanCode struct {
@@ -31,10 +31,10 @@ func GenerateCodes(root *HuffmanNode) CodeTable {
 	leftIsDummy := root.left != nil && root.left.IsDummy()
 	rightIsDummy := root.right != nil && root.right.IsDummy()
 
-	if leftIsDummy && !rightIsDummy && root.right.IsLeaf() {
+	if leftIsDummy && !rightIsDummy && root.right != nil && root.right.IsLeaf() {
 		codeTable[root.right.char] = HuffmanCode{bits: 1, length: 1}
 		return codeTable
-	} else if rightIsDummy && !leftIsDummy && root.left.IsLeaf() {
+	} else if rightIsDummy && !leftIsDummy && root.left != nil && root.left.IsLeaf() {
 		codeTable[root.left.char] = HuffmanCode{bits: 0, length: 1}
 		return codeTable
 	}
@@ -63,26 +63,48 @@ func buildCodesRecursive(node *HuffmanNode, currentCode HuffmanCode, codeTable C
 	buildCodesRecursive(node.right, rightCode, codeTable)
 }
 
+// CalculatePayloadSize returns how many bytes encoding every character in
+// freqTable with codeTable takes, including the padded last byte
+func CalculatePayloadSize(freqTable FrequencyTable, codeTable CodeTable) uint64 {
+	totalBits := uint64(0)
+	for char, freq := range freqTable {
+		totalBits += uint64(freq) * uint64(codeTable[char].length)
+	}
+	return (totalBits + 7) / 8
+}
+
+// CalculatePaddingBits returns how many zero bits are needed to fill the last
+// byte when every character in freqTable is encoded with codeTable
+func CalculatePaddingBits(freqTable FrequencyTable, codeTable CodeTable) uint8 {
+	totalBits := uint64(0)
+	for char, freq := range freqTable {
+		totalBits += uint64(freq) * uint64(codeTable[char].length)
+	}
+
+	if totalBits%8 == 0 {
+		return 0
+	}
+	return uint8(8 - totalBits%8)
+}
+
+// PrintCodeTable prints the code of every character, in byte order
 func PrintCodeTable(codeTable CodeTable) {
-	for char, code := range codeTable {
-		switch char {
-		case ' ':
-			fmt.Printf("Space: %v\n", code)
-		case '\n':
-			fmt.Printf("Newline: %v\n", code)
-		case '\t':
-			fmt.Printf("Tab: %v\n", code)
-		default:
-			if unicode.IsPrint(rune(char)) {
-				fmt.Printf("' %v ': %v\n", string(char), code)
-			} else {
-				fmt.Printf("(0x%02x): %v\n", char, CodeToString(code))
-			}
+	chars := make([]byte, 0, len(codeTable))
+	for char := range codeTable {
+		chars = append(chars, char)
+	}
+	sort.Slice(chars, func(i, j int) bool {
+		return chars[i] < chars[j]
+	})
 
-		}
+	for _, char := range chars {
+		code := codeTable[char]
+		fmt.Printf("'%s': %s (%d bits)\n", SymbolName(char), CodeBits(code), code.length)
 	}
 }
 
+// appendBit only works for codes shorter than MaxCodeLength, callers check
+// TreeDepth (or cap lengths with CodeLengthsWithLimit) before generating codes
 func appendBit(code HuffmanCode, bit uint8) HuffmanCode {
 	newCode := code
 	if bit != 0 {
@@ -116,6 +138,17 @@ func CodeToString(code HuffmanCode) string {
 	return string(result)
 }
 
+// CodeBits returns the bits of code in the order they are written to the
+// stream, which is also the path from the root (0 left, 1 right).
+// CodeToString shows the stored value instead, so its string is reversed.
+func CodeBits(code HuffmanCode) string {
+	result := make([]byte, code.length)
+	for i := range result {
+		result[i] = '0' + byte(code.bits>>i&1)
+	}
+	return string(result)
+}
+
 func VerifyPrefixFree(codeTable CodeTable) bool {
 	// for each pair of codes, verify neither is prefix of other
 	codes := make([]HuffmanCode, 0, len(codeTable))
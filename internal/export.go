@@ -0,0 +1,287 @@
+package internal
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// CodeEntry is one row of an exported code table
+type CodeEntry struct {
+	Symbol    string `json:"symbol"` // see SymbolName
+	Byte      byte   `json:"byte"`
+	Frequency int    `json:"frequency"`
+	Code      string `json:"code"` // see CodeBits
+	Length    int    `json:"length"`
+}
+
+// TreeNode is the JSON form of a HuffmanNode. Leaves have a symbol,
+// internal nodes children: left for bit 0, right for bit 1.
+type TreeNode struct {
+	Frequency int       `json:"frequency"`
+	Symbol    *string   `json:"symbol,omitempty"`
+	Byte      *byte     `json:"byte,omitempty"`
+	Left      *TreeNode `json:"left,omitempty"`
+	Right     *TreeNode `json:"right,omitempty"`
+}
+
+// SymbolName shows a byte as a Go escape without the quotes: a, \n, \x00
+func SymbolName(char byte) string {
+	quoted := strconv.Quote(string([]byte{char}))
+	return quoted[1 : len(quoted)-1]
+}
+
+// CodeEntries lists the codes of codeTable with the frequencies of the
+// leaves of root, most frequent first
+func CodeEntries(root *HuffmanNode, codeTable CodeTable) []CodeEntry {
+	frequencies := make(map[byte]int)
+	collectLeaves(root, frequencies)
+
+	entries := make([]CodeEntry, 0, len(codeTable))
+	for char, code := range codeTable {
+		entries = append(entries, CodeEntry{
+			Symbol:    SymbolName(char),
+			Byte:      char,
+			Frequency: frequencies[char],
+			Code:      CodeBits(code),
+			Length:    code.length,
+		})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Frequency != entries[j].Frequency {
+			return entries[i].Frequency > entries[j].Frequency
+		}
+		return entries[i].Byte < entries[j].Byte
+	})
+	return entries
+}
+
+func collectLeaves(node *HuffmanNode, frequencies map[byte]int) {
+	if node == nil || node.IsDummy() {
+		return
+	}
+	if node.isLeaf {
+		frequencies[node.char] = node.frequency
+		return
+	}
+	collectLeaves(node.left, frequencies)
+	collectLeaves(node.right, frequencies)
+}
+
+// ExportTree converts root to its JSON form. The dummy leaf of a single
+// symbol tree is left out, it has no code.
+func ExportTree(root *HuffmanNode) *TreeNode {
+	if root == nil || root.IsDummy() {
+		return nil
+	}
+	node := &TreeNode{Frequency: root.frequency}
+	if root.isLeaf {
+		symbol, char := SymbolName(root.char), root.char
+		node.Symbol, node.Byte = &symbol, &char
+		return node
+	}
+	node.Left = ExportTree(root.left)
+	node.Right = ExportTree(root.right)
+	return node
+}
+
+// WriteCodesJSON writes the code table and the tree as one JSON document
+func WriteCodesJSON(writer io.Writer, root *HuffmanNode, codeTable CodeTable) error {
+	encoder := json.NewEncoder(writer)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(struct {
+		Codes []CodeEntry `json:"codes"`
+		Tree  *TreeNode   `json:"tree"`
+	}{CodeEntries(root, codeTable), ExportTree(root)})
+}
+
+// WriteCodesCSV writes the code table as CSV with a header row
+func WriteCodesCSV(writer io.Writer, root *HuffmanNode, codeTable CodeTable) error {
+	csvWriter := csv.NewWriter(writer)
+	csvWriter.Write([]string{"symbol", "byte", "frequency", "code", "length"})
+	for _, entry := range CodeEntries(root, codeTable) {
+		csvWriter.Write([]string{
+			entry.Symbol,
+			strconv.Itoa(int(entry.Byte)),
+			strconv.Itoa(entry.Frequency),
+			entry.Code,
+			strconv.Itoa(entry.Length),
+		})
+	}
+	csvWriter.Flush()
+	return csvWriter.Error()
+}
+
+// WriteTreeDOT writes root as a Graphviz digraph: internal nodes show
+// their frequency, leaves their symbol and frequency, edges the code bit
+func WriteTreeDOT(writer io.Writer, root *HuffmanNode) error {
+	var dot strings.Builder
+	dot.WriteString("digraph huffman {\n")
+	dot.WriteString("  node [fontname=\"monospace\"];\n")
+	if root != nil {
+		id := 0
+		writeDOTNode(&dot, root, &id)
+	}
+	dot.WriteString("}\n")
+	_, err := io.WriteString(writer, dot.String())
+	return err
+}
+
+// writeDOTNode writes node and the nodes below it, numbering them in
+// preorder, and returns the id of node
+func writeDOTNode(dot *strings.Builder, node *HuffmanNode, nextID *int) int {
+	id := *nextID
+	*nextID++
+	if node.isLeaf {
+		// \n breaks the label line, any other backslash is the symbol's
+		symbol := dotEscaper.Replace("'" + SymbolName(node.char) + "'")
+		fmt.Fprintf(dot, "  n%d [shape=box, label=\"%s\\n%d\"];\n", id, symbol, node.frequency)
+		return id
+	}
+
+	fmt.Fprintf(dot, "  n%d [shape=circle, label=\"%d\"];\n", id, node.frequency)
+	for bit, child := range []*HuffmanNode{node.left, node.right} {
+		if child == nil || child.IsDummy() {
+			continue
+		}
+		childID := writeDOTNode(dot, child, nextID)
+		fmt.Fprintf(dot, "  n%d -> n%d [label=\"%d\"];\n", id, childID, bit)
+	}
+	return id
+}
+
+var dotEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+
+// BlockModeError is returned for a block that has no code table to show:
+// adaptive blocks change their codes as they go, LZ77 blocks code matches
+// and stored blocks aren't coded at all
+type BlockModeError struct {
+	Block int
+	Mode  byte
+}
+
+func (e *BlockModeError) Error() string {
+	return fmt.Sprintf("block %d is coded with %s, only huffman blocks have a code table", e.Block, blockModeName(e.Mode))
+}
+
+// FileCodes returns the tree and codes stored in the header of the .hf file
+// at path, those of block of a framed stream (see StreamCodes), or the ones
+// CompressFile would build for any other file. block must be 0 for files
+// other than streams.
+func FileCodes(path string, block int) (*HuffmanNode, CodeTable, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer file.Close()
+
+	var freqTable FrequencyTable
+	reader := bufio.NewReader(file)
+	magic, _ := reader.Peek(len(MagicNumber))
+	switch string(magic) {
+	case StreamMagic:
+		return StreamCodes(reader, block)
+	case MagicNumber:
+		header, err := ReadHeader(reader)
+		if err == nil {
+			err = header.checkFrequencies()
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read header: %w", err)
+		}
+		freqTable = header.FreqTable
+	default:
+		freqTable, err = AnalyzeFrequencies(path)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if block != 0 {
+		return nil, nil, fmt.Errorf("block %d out of range, only framed streams have more than one code table", block)
+	}
+	return buildCodes(freqTable)
+}
+
+// StreamCodes returns the codes of block, counted from 0, of the framed
+// stream in reader. They are rebuilt from the code lengths the block
+// stores, and the block is decoded to give the tree the frequencies of its
+// symbols. Blocks that aren't Huffman coded return a *BlockModeError.
+func StreamCodes(reader io.Reader, block int) (*HuffmanNode, CodeTable, error) {
+	if block < 0 {
+		return nil, nil, fmt.Errorf("invalid block %d", block)
+	}
+	_, flags, _, err := readStreamHeader(reader)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read stream header: %w", err)
+	}
+
+	for i := 0; i < block; i++ {
+		_, err = readRawBlock(reader, flags, func(blockHeader) error { return nil })
+		if err == io.EOF {
+			return nil, nil, fmt.Errorf("block %d out of range, the stream has %d blocks", block, i)
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("block %d: %w", i, err)
+		}
+	}
+
+	header, err := readBlockHeader(reader)
+	if err == io.EOF {
+		return nil, nil, fmt.Errorf("block %d out of range, the stream has %d blocks", block, block)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("block %d: %w", block, err)
+	}
+	mode, err := readBlockMode(reader, flags)
+	if err != nil {
+		return nil, nil, fmt.Errorf("block %d: %w", block, err)
+	}
+	if mode != BlockHuffman {
+		return nil, nil, &BlockModeError{Block: block, Mode: mode}
+	}
+
+	// Keep the code lengths, decoding the block reads them again
+	var stored bytes.Buffer
+	lengths, err := ReadCodeLengths(io.TeeReader(reader, &stored))
+	if err != nil {
+		return nil, nil, fmt.Errorf("block %d: %w", block, unexpectedEOF(err))
+	}
+	data, err := readHuffmanBody(io.MultiReader(&stored, reader), header)
+	if err != nil {
+		return nil, nil, fmt.Errorf("block %d: %w", block, err)
+	}
+
+	codeTable, err := CodeTableFromLengths(lengths)
+	if err != nil {
+		return nil, nil, fmt.Errorf("block %d: %w", block, err)
+	}
+	root, err := BuildTreeFromCodes(codeTable)
+	if err != nil {
+		return nil, nil, fmt.Errorf("block %d: %w", block, err)
+	}
+	setFrequencies(root, CountFrequencies(data))
+	return root, codeTable, nil
+}
+
+// setFrequencies gives the leaves below node their frequency in freqTable
+// and every internal node the sum of its children, and returns the
+// frequency of node
+func setFrequencies(node *HuffmanNode, freqTable FrequencyTable) int {
+	if node == nil {
+		return 0
+	}
+	if node.isLeaf {
+		node.frequency = freqTable[node.char]
+		return node.frequency
+	}
+	node.frequency = setFrequencies(node.left, freqTable) + setFrequencies(node.right, freqTable)
+	return node.frequency
+}
@@ -0,0 +1,479 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// ExtractPolicy decides what happens to an archive entry that can't be
+// extracted as is: a path leaving the destination, a symlink pointing out
+// of it, or a second entry with the same path
+type ExtractPolicy int
+
+const (
+	// ExtractError stops at the first such entry. Unsafe paths are caught
+	// before anything is written.
+	ExtractError ExtractPolicy = iota
+	// ExtractSkip leaves the entry out and carries on
+	ExtractSkip
+	// ExtractRename extracts the entry under another name: unsafe paths
+	// lose their leading "/" and "../" like tar does, duplicates get a
+	// ".1", ".2"... suffix. Symlinks pointing outside are skipped.
+	ExtractRename
+)
+
+func (p ExtractPolicy) String() string {
+	switch p {
+	case ExtractError:
+		return "error"
+	case ExtractSkip:
+		return "skip"
+	case ExtractRename:
+		return "rename"
+	default:
+		return fmt.Sprintf("ExtractPolicy(%d)", int(p))
+	}
+}
+
+// ParseExtractPolicy returns the policy called name ("error", "skip" or
+// "rename")
+func ParseExtractPolicy(name string) (ExtractPolicy, error) {
+	for _, policy := range []ExtractPolicy{ExtractError, ExtractSkip, ExtractRename} {
+		if policy.String() == name {
+			return policy, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown extract policy %q, want error, skip or rename", name)
+}
+
+// ExtractOptions configure ExtractArchive
+type ExtractOptions struct {
+	Policy ExtractPolicy
+	// Notify, when set, is called for every entry skipped or renamed by the
+	// policy. name is where the entry went, "" when it was skipped.
+	Notify func(entry ArchiveEntry, name string, err error)
+}
+
+// UnsafePathError is returned for an archive entry that would be written,
+// or would point, outside the destination directory
+type UnsafePathError struct {
+	Path   string
+	Reason string
+}
+
+func (e *UnsafePathError) Error() string {
+	return fmt.Sprintf("unsafe archive entry %q: %s", e.Path, e.Reason)
+}
+
+// DuplicateEntryError is returned when an archive has more than one entry
+// with the same path
+type DuplicateEntryError struct {
+	Path string
+}
+
+func (e *DuplicateEntryError) Error() string {
+	return fmt.Sprintf("duplicate archive entry %q", e.Path)
+}
+
+// maxSymlinkHops bounds symlink resolution, like the OS limit on loops
+const maxSymlinkHops = 255
+
+// ExtractArchive extracts the archive at archivePath into destDir. With
+// names, only those entries and everything below the directories among
+// them are extracted.
+//
+// Nothing is written outside destDir: entries with absolute paths or ".."
+// components, symlinks resolving outside destDir and paths through such
+// symlinks are handled by options.Policy. Symlinks are created after all
+// other entries, so no file is ever written through a link from the same
+// archive.
+func ExtractArchive(archivePath, destDir string, names []string, options ExtractOptions) error {
+	archiveFile, err := os.Open(archivePath)
+	if err != nil {
+		return fmt.Errorf("failed to open archive: %w", err)
+	}
+	defer archiveFile.Close()
+
+	info, err := archiveFile.Stat()
+	if err != nil {
+		return err
+	}
+	reader, err := NewArchiveReader(archiveFile, info.Size())
+	if err != nil {
+		return err
+	}
+
+	entries, err := selectEntries(reader.Entries(), names)
+	if err != nil {
+		return err
+	}
+
+	x := &extractor{reader: reader, destDir: destDir, options: options}
+	planned, err := x.plan(entries)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(destDir, 0o755)
+	if err != nil {
+		return err
+	}
+	return x.extract(planned)
+}
+
+type extractor struct {
+	reader  *ArchiveReader
+	destDir string
+	options ExtractOptions
+}
+
+// plannedEntry is an entry with the slash separated path, relative to the
+// destination, it is extracted to
+type plannedEntry struct {
+	entry ArchiveEntry
+	name  string
+}
+
+// plan checks every entry path and symlink target without touching the file
+// system, and applies the policy to the entries that fail
+func (x *extractor) plan(entries []ArchiveEntry) ([]plannedEntry, error) {
+	var planned []plannedEntry
+	taken := make(map[string]bool)
+
+	for _, entry := range entries {
+		name := path.Clean(entry.Path)
+		if err := checkEntryPath(entry.Path); err != nil {
+			if x.options.Policy != ExtractRename {
+				if err := x.skip(entry, err); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			name = ArchiveName(filepath.FromSlash(entry.Path))
+			if name == "" || checkEntryPath(name) != nil {
+				x.notify(entry, "", err)
+				continue
+			}
+			x.notify(entry, name, err)
+		}
+
+		if entry.Type == EntrySymlink {
+			if err := checkLinkTarget(entry.Path, name, entry.Link); err != nil {
+				if err := x.skip(entry, err); err != nil {
+					return nil, err
+				}
+				continue
+			}
+		}
+
+		if taken[name] {
+			err := &DuplicateEntryError{Path: name}
+			if x.options.Policy != ExtractRename {
+				if err := x.skip(entry, err); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			name = uniqueName(name, taken)
+			x.notify(entry, name, err)
+		}
+
+		taken[name] = true
+		planned = append(planned, plannedEntry{entry: entry, name: name})
+	}
+	return planned, nil
+}
+
+// skip returns err under ExtractError, otherwise it reports the entry as
+// skipped and returns nil
+func (x *extractor) skip(entry ArchiveEntry, err error) error {
+	if x.options.Policy == ExtractError {
+		return err
+	}
+	x.notify(entry, "", err)
+	return nil
+}
+
+func (x *extractor) notify(entry ArchiveEntry, name string, err error) {
+	if x.options.Notify != nil {
+		x.options.Notify(entry, name, err)
+	}
+}
+
+// extract writes the planned entries: directories and files in archive
+// order, then symlinks, then directory modes and times
+func (x *extractor) extract(planned []plannedEntry) error {
+	var dirs, links []plannedEntry
+	for _, p := range planned {
+		var err error
+		switch p.entry.Type {
+		case EntryDir:
+			err = x.checkResolvesInside(p.entry, p.name)
+			if err == nil {
+				err = os.MkdirAll(x.target(p.name), 0o755)
+				dirs = append(dirs, p)
+			}
+		case EntryFile:
+			err = x.checkResolvesInside(p.entry, path.Dir(p.name))
+			if err == nil {
+				err = x.extractFile(p)
+			}
+		case EntrySymlink:
+			links = append(links, p)
+		}
+		if err != nil {
+			if skipErr := x.skipUnsafe(p.entry, err); skipErr != nil {
+				return skipErr
+			}
+		}
+	}
+
+	for _, p := range links {
+		// Not cleaned, resolvesInside needs to see every ".."
+		err := x.checkResolvesInside(p.entry, path.Dir(p.name)+"/"+filepath.ToSlash(p.entry.Link))
+		if err == nil {
+			err = x.extractSymlink(p)
+		}
+		if err != nil {
+			if skipErr := x.skipUnsafe(p.entry, err); skipErr != nil {
+				return skipErr
+			}
+		}
+	}
+
+	// Directory times change while their contents are written, so set them
+	// last, deepest first
+	for i := len(dirs) - 1; i >= 0; i-- {
+		target := x.target(dirs[i].name)
+		if _, err := os.Lstat(target); err != nil {
+			continue // not created, skipped by the policy
+		}
+		err := os.Chmod(target, dirs[i].entry.Mode)
+		if err != nil {
+			return err
+		}
+		err = os.Chtimes(target, dirs[i].entry.ModTime, dirs[i].entry.ModTime)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// skipUnsafe applies the policy to an entry found unsafe while extracting.
+// Other errors always stop the extraction.
+func (x *extractor) skipUnsafe(entry ArchiveEntry, err error) error {
+	var unsafe *UnsafePathError
+	if !errors.As(err, &unsafe) {
+		return fmt.Errorf("failed to extract %s: %w", entry.Path, err)
+	}
+	return x.skip(entry, err)
+}
+
+func (x *extractor) target(name string) string {
+	return filepath.Join(x.destDir, filepath.FromSlash(name))
+}
+
+// checkResolvesInside returns an *UnsafePathError for entry when name,
+// following the symlinks already in the destination, leads outside of it
+func (x *extractor) checkResolvesInside(entry ArchiveEntry, name string) error {
+	if !resolvesInside(x.destDir, name) {
+		return &UnsafePathError{Path: entry.Path, Reason: "resolves outside the destination through a symlink"}
+	}
+	return nil
+}
+
+func (x *extractor) extractFile(p plannedEntry) error {
+	target := x.target(p.name)
+	err := os.MkdirAll(filepath.Dir(target), 0o755)
+	if err != nil {
+		return err
+	}
+	// Replace a symlink instead of writing to wherever it points
+	err = removeSymlink(target)
+	if err != nil {
+		return err
+	}
+
+	contents, err := x.reader.Open(p.entry)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, p.entry.Mode)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	written, err := io.Copy(file, contents)
+	if err != nil {
+		return err
+	}
+	if uint64(written) != p.entry.Size {
+		return fmt.Errorf("decoded %d bytes, directory says %d", written, p.entry.Size)
+	}
+
+	err = file.Close()
+	if err != nil {
+		return err
+	}
+	// The mode given to OpenFile is masked by the umask
+	err = os.Chmod(target, p.entry.Mode)
+	if err != nil {
+		return err
+	}
+	return os.Chtimes(target, p.entry.ModTime, p.entry.ModTime)
+}
+
+func (x *extractor) extractSymlink(p plannedEntry) error {
+	target := x.target(p.name)
+	err := os.MkdirAll(filepath.Dir(target), 0o755)
+	if err != nil {
+		return err
+	}
+	err = removeSymlink(target)
+	if err != nil {
+		return err
+	}
+	return os.Symlink(p.entry.Link, target)
+}
+
+func removeSymlink(path string) error {
+	info, err := os.Lstat(path)
+	if err != nil || info.Mode()&fs.ModeSymlink == 0 {
+		return nil
+	}
+	return os.Remove(path)
+}
+
+// checkEntryPath returns an *UnsafePathError unless name is a relative
+// path staying below the directory it is extracted to
+func checkEntryPath(name string) error {
+	reason := ""
+	switch {
+	case name == "":
+		reason = "empty path"
+	case strings.HasPrefix(name, "/") || filepath.IsAbs(filepath.FromSlash(name)) || filepath.VolumeName(filepath.FromSlash(name)) != "":
+		reason = "absolute path"
+	case slices.Contains(strings.Split(name, "/"), ".."):
+		reason = `path contains ".."`
+	case !filepath.IsLocal(filepath.FromSlash(name)):
+		reason = "not a local path"
+	default:
+		return nil
+	}
+	return &UnsafePathError{Path: name, Reason: reason}
+}
+
+// checkLinkTarget returns an *UnsafePathError when the symlink extracted to
+// name points outside the destination on its own, without following
+// other links
+func checkLinkTarget(entryPath, name, link string) error {
+	if link == "" {
+		return &UnsafePathError{Path: entryPath, Reason: "empty symlink target"}
+	}
+	if strings.HasPrefix(link, "/") || filepath.IsAbs(link) || filepath.VolumeName(link) != "" {
+		return &UnsafePathError{Path: entryPath, Reason: "symlink to an absolute path"}
+	}
+	resolved := path.Join(path.Dir(name), filepath.ToSlash(link))
+	if resolved == ".." || strings.HasPrefix(resolved, "../") {
+		return &UnsafePathError{Path: entryPath, Reason: "symlink points outside the destination"}
+	}
+	return nil
+}
+
+// resolvesInside reports whether name, a slash separated path relative to
+// destDir, stays inside destDir when the symlinks already there are
+// followed. Missing components are taken as plain directories, but ".."
+// after one is refused: a later symlink in its place could change where
+// it leads.
+func resolvesInside(destDir, name string) bool {
+	pending := strings.Split(name, "/")
+	var resolved []string
+	missing := false
+
+	for hops := 0; len(pending) > 0; {
+		part := pending[0]
+		pending = pending[1:]
+
+		switch part {
+		case "", ".":
+			continue
+		case "..":
+			if len(resolved) == 0 || missing {
+				return false
+			}
+			resolved = resolved[:len(resolved)-1]
+			continue
+		}
+
+		resolved = append(resolved, part)
+		if missing {
+			continue
+		}
+		current := filepath.Join(destDir, filepath.Join(resolved...))
+		info, err := os.Lstat(current)
+		if err != nil {
+			missing = true
+			continue
+		}
+		if info.Mode()&fs.ModeSymlink == 0 {
+			continue
+		}
+
+		link, err := os.Readlink(current)
+		hops++
+		if err != nil || hops > maxSymlinkHops || filepath.IsAbs(link) || strings.HasPrefix(link, "/") {
+			return false
+		}
+		resolved = resolved[:len(resolved)-1]
+		pending = append(strings.Split(filepath.ToSlash(link), "/"), pending...)
+	}
+	return true
+}
+
+// uniqueName returns name with the first ".N" suffix not in taken
+func uniqueName(name string, taken map[string]bool) string {
+	for i := 1; ; i++ {
+		candidate := fmt.Sprintf("%s.%d", name, i)
+		if !taken[candidate] {
+			return candidate
+		}
+	}
+}
+
+// selectEntries returns the entries named in names, or below a directory
+// named in names, in archive order. Every name must match an entry.
+func selectEntries(entries []ArchiveEntry, names []string) ([]ArchiveEntry, error) {
+	if len(names) == 0 {
+		return entries, nil
+	}
+
+	matched := make(map[string]bool)
+	var selected []ArchiveEntry
+	for _, entry := range entries {
+		for _, name := range names {
+			name = strings.TrimSuffix(name, "/")
+			if entry.Path == name || strings.HasPrefix(entry.Path, name+"/") {
+				matched[name] = true
+				selected = append(selected, entry)
+				break
+			}
+		}
+	}
+
+	for _, name := range names {
+		if !matched[strings.TrimSuffix(name, "/")] {
+			return nil, fmt.Errorf("%s: not found in archive", name)
+		}
+	}
+	return selected, nil
+}
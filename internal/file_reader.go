@@ -0,0 +1,122 @@
+package internal
+
+import (
+	"fmt"
+	"io"
+)
+
+// FileReader is an io.Reader that decodes the single-table format written
+// by CompressFile, verifying the checksum trailer when the header has one
+type FileReader struct {
+	reader    io.Reader // positioned after the payload once decoding is done
+	payload   io.Reader
+	bitReader *BitReader
+	decoder   *Decoder
+	header    FileHeader
+	sums      *checksums
+	remaining uint64 // bytes left to decode
+	err       error  // sticky error, io.EOF once everything was verified
+}
+
+// NewFileReader reads the header from reader and prepares to decode the
+// data following it. It may read more data than necessary from reader.
+func NewFileReader(reader io.Reader) (*FileReader, error) {
+	header, err := ReadHeader(reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read header: %w", err)
+	}
+	err = header.checkFrequencies()
+	if err != nil {
+		return nil, err
+	}
+
+	fr := &FileReader{
+		reader:    reader,
+		payload:   reader,
+		header:    header,
+		sums:      newChecksums(header.Flags),
+		remaining: header.OriginalSize,
+	}
+
+	payloadSize := uint64(0)
+	if header.OriginalSize > 0 {
+		if len(header.FreqTable) == 0 {
+			return nil, fmt.Errorf("invalid header: freq table is empty")
+		}
+
+		root, err := BuildHuffmanTree(header.FreqTable)
+		if err != nil {
+			return nil, fmt.Errorf("failed to build huffman tree: %w", err)
+		}
+		fr.decoder = NewDecoder(root)
+		payloadSize = CalculatePayloadSize(header.FreqTable, GenerateCodes(root))
+	}
+
+	// With a trailer the bit reader has to stop at the end of the payload
+	if TrailerSize(header.Flags) > 0 {
+		fr.payload = io.TeeReader(io.LimitReader(reader, int64(payloadSize)), fr.sums.compressedWriter())
+	}
+	fr.bitReader = NewBitReader(fr.payload)
+
+	return fr, nil
+}
+
+// Header returns the parsed file header
+func (fr *FileReader) Header() FileHeader {
+	return fr.header
+}
+
+func (fr *FileReader) Read(p []byte) (int, error) {
+	if fr.err != nil {
+		return 0, fr.err
+	}
+
+	n := 0
+	for n < len(p) && fr.remaining > 0 {
+		char, err := fr.decoder.DecodeByte(fr.bitReader)
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			fr.err = err
+			fr.sums.addContent(p[:n])
+			return n, err
+		}
+
+		p[n] = char
+		n++
+		fr.remaining--
+	}
+	fr.sums.addContent(p[:n])
+
+	if fr.remaining == 0 {
+		fr.err = fr.finish()
+		if n == 0 || fr.err != io.EOF {
+			return n, fr.err
+		}
+	}
+	return n, nil
+}
+
+// finish verifies the trailer once every byte was decoded
+func (fr *FileReader) finish() error {
+	if TrailerSize(fr.header.Flags) == 0 {
+		return io.EOF
+	}
+
+	// Hash payload bytes the decoder didn't need to read
+	_, err := io.Copy(io.Discard, fr.payload)
+	if err != nil {
+		return err
+	}
+
+	trailer, err := ReadTrailer(fr.reader, fr.header.Flags)
+	if err != nil {
+		return err
+	}
+	err = fr.sums.verify(trailer)
+	if err != nil {
+		return err
+	}
+	return io.EOF
+}
@@ -4,19 +4,81 @@ import (
 	"encoding/binary"
 	"fmt"
 	"io"
+	"math"
 	"sort"
 )
 
 const MagicNumber = "HF"
 
+// Header versions. Version 1 has no version field: the byte after the magic
+// number is the high byte of its 8 byte OriginalSize, which is 0 for any
+// file below 2^56 bytes. Later versions store their number in that byte.
+const (
+	HeaderVersion1 = 1
+	HeaderVersion2 = 2
+)
+
+// HeaderV2PaddingOffset is where PaddingBits sits in a version 2 header
+const HeaderV2PaddingOffset = 4
+
+// SupportedFlags has a bit set for every feature flag this version can
+// decode. Files using any other flag are refused instead of misread.
+const SupportedFlags = FlagChecksum | FlagSHA256 | FlagAdaptive | FlagLZ77 | FlagBlockModes | FlagIndex
+
+// fileHeaderFlags are the flags valid in a version 2 file header. Adaptive
+// and LZ77 coding need the per-block lengths of a framed stream.
+const fileHeaderFlags = FlagChecksum | FlagSHA256
+
+// UnsupportedVersionError is returned for a file or stream written with a
+// format version this build can't read
+type UnsupportedVersionError struct {
+	Format  string // "header", "stream" or "archive"
+	Version uint8
+}
+
+func (e *UnsupportedVersionError) Error() string {
+	return fmt.Sprintf("unsupported %s version %d", e.Format, e.Version)
+}
+
+// UnsupportedFeatureError is returned when a header sets feature flags this
+// build doesn't know
+type UnsupportedFeatureError struct {
+	Flags uint8 // the unknown flags only
+}
+
+func (e *UnsupportedFeatureError) Error() string {
+	return fmt.Sprintf("unsupported feature flags %08b", e.Flags)
+}
+
+// checkFlags rejects flags outside supported
+func checkFlags(flags, supported uint8) error {
+	if unknown := flags &^ supported; unknown != 0 {
+		return &UnsupportedFeatureError{Flags: unknown}
+	}
+	return nil
+}
+
 type FileHeader struct {
+	Version      uint8          // Header layout version
+	Flags        uint8          // Feature flags, always 0 in version 1
 	OriginalSize uint64         // Original uncompressed file size
-	NumChars     uint8          // Number of unique characters
+	NumChars     uint16         // Number of unique characters
 	PaddingBits  uint8          // Number of padding bits in last byte
 	FreqTable    FrequencyTable // Character frequencies
 }
 
+// WriteHeader writes a version 1 header. It can't represent 256 unique
+// characters or frequencies above 4 GiB, use WriteHeaderV2 for those.
 func WriteHeader(writer io.Writer, freqTable FrequencyTable, originalSize uint64, paddingBits uint8) error {
+	if len(freqTable) > 255 {
+		return fmt.Errorf("%d unique characters do not fit a version 1 header (max 255)", len(freqTable))
+	}
+	for char, freq := range freqTable {
+		if freq > math.MaxUint32 {
+			return fmt.Errorf("frequency %d of character %d does not fit a version 1 header", freq, char)
+		}
+	}
+
 	// 1. Write magic number "HF"
 	_, err := writer.Write([]byte(MagicNumber))
 	if err != nil {
@@ -42,33 +104,119 @@ func WriteHeader(writer io.Writer, freqTable FrequencyTable, originalSize uint64
 		return err
 	}
 
-	// ✅ 5. Write frequency entries IN SORTED ORDER
-	// Sort characters to ensure deterministic order
-	chars := make([]byte, 0, len(freqTable))
-	for char := range freqTable {
-		chars = append(chars, char)
+	// 5. Write frequency entries
+	return writeFreqEntries(writer, freqTable)
+}
+
+// WriteHeaderV2 writes a version 2 header:
+// [HF:2][Version:1][Flags:1][PaddingBits:1][OriginalSize:uvarint][NumChars:2][Entries N×(char:1 + freq:uvarint)]
+func WriteHeaderV2(writer io.Writer, freqTable FrequencyTable, originalSize uint64, paddingBits uint8, flags uint8) error {
+	err := checkFlags(flags, fileHeaderFlags)
+	if err != nil {
+		return err
 	}
-	sort.Slice(chars, func(i, j int) bool {
-		return chars[i] < chars[j]
-	})
 
-	// Write in sorted order
-	for _, char := range chars {
-		freq := freqTable[char]
-		_, err = writer.Write([]byte{char})
-		if err != nil {
-			return err
-		}
+	// 1. Magic number, version and flags
+	_, err = writer.Write([]byte{MagicNumber[0], MagicNumber[1], HeaderVersion2, flags, paddingBits})
+	if err != nil {
+		return err
+	}
 
-		err = binary.Write(writer, binary.BigEndian, uint32(freq))
+	// 2. Original size
+	_, err = writer.Write(binary.AppendUvarint(nil, originalSize))
+	if err != nil {
+		return err
+	}
+
+	// 3. Number of unique characters, up to all 256 byte values
+	err = binary.Write(writer, binary.BigEndian, uint16(len(freqTable)))
+	if err != nil {
+		return err
+	}
+
+	// 4. Frequency entries with variable length frequencies
+	entries := make([]byte, 0, len(freqTable)*3)
+	for _, char := range sortedChars(freqTable) {
+		entries = append(entries, char)
+		entries = binary.AppendUvarint(entries, uint64(freqTable[char]))
+	}
+	_, err = writer.Write(entries)
+	return err
+}
+
+// FormatError is returned by ReadHeader and the decoders for a malformed
+// header. Offset is where the offending field starts, counted from the
+// magic number.
+type FormatError struct {
+	Offset int64
+	Reason string
+	Err    error // underlying read error, if any
+}
+
+func (e *FormatError) Error() string {
+	return fmt.Sprintf("invalid header at byte %d: %s", e.Offset, e.Reason)
+}
+
+func (e *FormatError) Unwrap() error {
+	return e.Err
+}
+
+// headerReader counts the bytes read so far, so errors can point at the
+// field they are about
+type headerReader struct {
+	reader io.ByteReader
+	offset int64
+}
+
+func (hr *headerReader) Read(p []byte) (int, error) {
+	n := 0
+	for n < len(p) {
+		b, err := hr.ReadByte()
 		if err != nil {
-			return err
+			return n, err
 		}
+		p[n] = b
+		n++
 	}
-	return nil
+	return n, nil
+}
+
+func (hr *headerReader) ReadByte() (byte, error) {
+	b, err := hr.reader.ReadByte()
+	if err == nil {
+		hr.offset++
+	}
+	return b, err
+}
+
+// fail returns a *FormatError for the field starting at offset
+func (hr *headerReader) fail(offset int64, format string, args ...any) error {
+	return &FormatError{Offset: offset, Reason: fmt.Sprintf(format, args...)}
+}
+
+// readErr turns running out of data into a *FormatError at the current
+// offset, other read errors are returned as they are
+func (hr *headerReader) readErr(err error) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return &FormatError{Offset: hr.offset, Reason: "header is truncated", Err: io.ErrUnexpectedEOF}
+	}
+	return err
 }
 
-// ReadHeader reads and parses the header from reader
+func (hr *headerReader) readUvarint() (uint64, error) {
+	start := hr.offset
+	value, err := binary.ReadUvarint(hr)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return 0, hr.readErr(err)
+	}
+	if err != nil {
+		return 0, &FormatError{Offset: start, Reason: "bad varint", Err: err}
+	}
+	return value, nil
+}
+
+// ReadHeader reads and parses the header from reader. A header that is
+// truncated or inconsistent fails with a *FormatError.
 func ReadHeader(reader io.Reader) (FileHeader, error) {
 	header := FileHeader{}
 	// 1. Read and verify magic number
@@ -82,46 +230,347 @@ func ReadHeader(reader io.Reader) (FileHeader, error) {
 		return header, fmt.Errorf("invalid file format: bad magic number")
 	}
 
-	// 2. Read original size
-	err = binary.Read(reader, binary.BigEndian, &header.OriginalSize)
+	// 2. Version byte (high byte of OriginalSize in version 1)
+	hr := &headerReader{reader: asByteReader(reader), offset: int64(len(magic))}
+	version, err := hr.ReadByte()
+	if err != nil {
+		return header, hr.readErr(err)
+	}
+
+	switch version {
+	case 0:
+		header.Version = HeaderVersion1
+		return readHeaderV1(hr, header)
+	case HeaderVersion2:
+		header.Version = HeaderVersion2
+		return readHeaderV2(hr, header)
+	default:
+		return header, &UnsupportedVersionError{Format: "header", Version: version}
+	}
+}
+
+func readHeaderV1(hr *headerReader, header FileHeader) (FileHeader, error) {
+	// 1. Read the remaining 7 bytes of original size
+	sizeBytes := make([]byte, 8)
+	_, err := io.ReadFull(hr, sizeBytes[1:])
+	if err != nil {
+		return header, hr.readErr(err)
+	}
+	header.OriginalSize = binary.BigEndian.Uint64(sizeBytes)
+
+	// 2. Read number of unique characters
+	numChars, err := hr.ReadByte()
+	if err != nil {
+		return header, hr.readErr(err)
+	}
+	header.NumChars = uint16(numChars)
+
+	// 3. Read padding bits count
+	header.PaddingBits, err = readPaddingBits(hr)
+	if err != nil {
+		return header, err
+	}
+
+	// 4. Read frequency entries
+	header.FreqTable, err = readFreqEntries(hr, int(header.NumChars))
+	if err != nil {
+		return header, err
+	}
+
+	return header, nil
+}
+
+func readHeaderV2(hr *headerReader, header FileHeader) (FileHeader, error) {
+	// 1. Read feature flags, refusing any this build can't decode
+	flags, err := hr.ReadByte()
+	if err != nil {
+		return header, hr.readErr(err)
+	}
+	header.Flags = flags
+	err = checkFlags(flags, fileHeaderFlags)
 	if err != nil {
 		return header, err
 	}
 
-	// 3. Read number of unique characters
-	numChars, err := readByte(reader)
+	// 2. Read padding bits count
+	header.PaddingBits, err = readPaddingBits(hr)
 	if err != nil {
 		return header, err
 	}
-	header.NumChars = numChars
 
-	// 4. Read padding bits count
-	paddingBits, err := readByte(reader)
+	// 3. Read original size
+	header.OriginalSize, err = hr.readUvarint()
 	if err != nil {
 		return header, err
 	}
-	header.PaddingBits = paddingBits
+
+	// 4. Read number of unique characters
+	numCharsOffset := hr.offset
+	err = binary.Read(hr, binary.BigEndian, &header.NumChars)
+	if err != nil {
+		return header, hr.readErr(err)
+	}
+	if header.NumChars > 256 {
+		return header, hr.fail(numCharsOffset, "%d unique characters", header.NumChars)
+	}
 
 	// 5. Read frequency entries
 	header.FreqTable = make(FrequencyTable)
 	for i := 0; i < int(header.NumChars); i++ {
-		char, err := readByte(reader)
+		entryOffset := hr.offset
+		char, err := hr.ReadByte()
 		if err != nil {
-			return header, err
+			return header, hr.readErr(err)
 		}
 
-		var freq uint32
-		err = binary.Read(reader, binary.BigEndian, &freq)
+		freqOffset := hr.offset
+		freq, err := hr.readUvarint()
 		if err != nil {
 			return header, err
 		}
+		if freq > math.MaxInt64 {
+			return header, hr.fail(freqOffset, "frequency %d of character %d is too large", freq, char)
+		}
 
-		header.FreqTable[char] = int(freq)
+		err = addFreqEntry(hr, header.FreqTable, char, freq, entryOffset)
+		if err != nil {
+			return header, err
+		}
 	}
 
 	return header, nil
 }
 
+func readPaddingBits(hr *headerReader) (uint8, error) {
+	paddingBits, err := hr.ReadByte()
+	if err != nil {
+		return 0, hr.readErr(err)
+	}
+	if paddingBits > 7 {
+		return 0, hr.fail(hr.offset-1, "%d padding bits", paddingBits)
+	}
+	return paddingBits, nil
+}
+
+// addFreqEntry adds the entry starting at offset, rejecting characters seen
+// before and zero frequencies, which no encoder writes
+func addFreqEntry(hr *headerReader, freqTable FrequencyTable, char byte, freq uint64, offset int64) error {
+	if _, ok := freqTable[char]; ok {
+		return hr.fail(offset, "duplicate character %d", char)
+	}
+	if freq == 0 {
+		return hr.fail(offset, "character %d has frequency 0", char)
+	}
+	freqTable[char] = int(freq)
+	return nil
+}
+
+// checkFrequencies rejects a header whose frequencies don't add up to
+// OriginalSize. Decoding relies on them agreeing, the payload size and the
+// trailer position follow from the frequencies.
+func (h FileHeader) checkFrequencies() error {
+	sum := uint64(0)
+	for _, freq := range h.FreqTable {
+		if sum+uint64(freq) < sum {
+			sum = math.MaxUint64
+			break
+		}
+		sum += uint64(freq)
+	}
+	if sum == h.OriginalSize {
+		return nil
+	}
+
+	// OriginalSize follows the version byte in version 2, and overlaps it
+	// in version 1
+	offset := int64(len(MagicNumber))
+	if h.Version == HeaderVersion2 {
+		offset = HeaderV2PaddingOffset + 1
+	}
+	return &FormatError{Offset: offset, Reason: fmt.Sprintf("frequencies add up to %d, original size is %d", sum, h.OriginalSize)}
+}
+
+// byteReader adds ReadByte to a plain io.Reader for binary.ReadUvarint
+type byteReader struct {
+	io.Reader
+}
+
+func (br byteReader) ReadByte() (byte, error) {
+	return readByte(br.Reader)
+}
+
+func asByteReader(reader io.Reader) io.ByteReader {
+	if br, ok := reader.(io.ByteReader); ok {
+		return br
+	}
+	return byteReader{reader}
+}
+
+func sortedChars(freqTable FrequencyTable) []byte {
+	// ✅ Sort characters to ensure deterministic order
+	chars := make([]byte, 0, len(freqTable))
+	for char := range freqTable {
+		chars = append(chars, char)
+	}
+	sort.Slice(chars, func(i, j int) bool {
+		return chars[i] < chars[j]
+	})
+	return chars
+}
+
+// writeFreqEntries writes [char:1][freq:4] for every entry, sorted by char
+func writeFreqEntries(writer io.Writer, freqTable FrequencyTable) error {
+	// Write in sorted order
+	for _, char := range sortedChars(freqTable) {
+		freq := freqTable[char]
+		_, err := writer.Write([]byte{char})
+		if err != nil {
+			return err
+		}
+
+		err = binary.Write(writer, binary.BigEndian, uint32(freq))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readFreqEntries reads numChars [char:1][freq:4] entries
+func readFreqEntries(hr *headerReader, numChars int) (FrequencyTable, error) {
+	freqTable := make(FrequencyTable)
+	for i := 0; i < numChars; i++ {
+		entryOffset := hr.offset
+		char, err := hr.ReadByte()
+		if err != nil {
+			return nil, hr.readErr(err)
+		}
+
+		var freq uint32
+		err = binary.Read(hr, binary.BigEndian, &freq)
+		if err != nil {
+			return nil, hr.readErr(err)
+		}
+
+		err = addFreqEntry(hr, freqTable, char, uint64(freq), entryOffset)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return freqTable, nil
+}
+
+// WriteCodeLengths writes a code length table (one entry per byte value) as
+// [Packing:1][First:1][Last:1][Lengths], covering only the range of symbols
+// from the first to the last one in use. Packing is the number of bits per
+// length: 4 (two lengths per byte, high nibble first) when every length fits,
+// otherwise 8.
+func WriteCodeLengths(writer io.Writer, lengths []uint8) error {
+	first, last, maxLength := usedLengthRange(lengths)
+	if first < 0 {
+		return fmt.Errorf("code length table has no symbols")
+	}
+
+	used := lengths[first : last+1]
+	var packed []byte
+	packing := uint8(8)
+	if maxLength <= 15 {
+		packing = 4
+		packed = make([]byte, (len(used)+1)/2)
+		for i, length := range used {
+			if i%2 == 0 {
+				packed[i/2] |= length << 4
+			} else {
+				packed[i/2] |= length
+			}
+		}
+	} else {
+		packed = used
+	}
+
+	_, err := writer.Write([]byte{packing, byte(first), byte(last)})
+	if err != nil {
+		return err
+	}
+	_, err = writer.Write(packed)
+	return err
+}
+
+// ReadCodeLengths reads a table written by WriteCodeLengths and returns the
+// length of every byte value
+func ReadCodeLengths(reader io.Reader) ([]uint8, error) {
+	fields := make([]byte, 3)
+	_, err := io.ReadFull(reader, fields)
+	if err != nil {
+		return nil, err
+	}
+	packing, first, last := fields[0], int(fields[1]), int(fields[2])
+
+	if first > last {
+		return nil, fmt.Errorf("invalid code length table: first symbol %d after last %d", first, last)
+	}
+
+	count := last - first + 1
+	lengths := make([]uint8, 256)
+
+	switch packing {
+	case 4:
+		packed := make([]byte, (count+1)/2)
+		_, err = io.ReadFull(reader, packed)
+		if err != nil {
+			return nil, err
+		}
+		for i := 0; i < count; i++ {
+			if i%2 == 0 {
+				lengths[first+i] = packed[i/2] >> 4
+			} else {
+				lengths[first+i] = packed[i/2] & 0x0f
+			}
+		}
+	case 8:
+		_, err = io.ReadFull(reader, lengths[first:last+1])
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("invalid code length table: unknown packing %d", packing)
+	}
+
+	return lengths, nil
+}
+
+// CalculateCodeLengthsSize returns how many bytes WriteCodeLengths uses
+func CalculateCodeLengthsSize(lengths []uint8) int {
+	first, last, maxLength := usedLengthRange(lengths)
+	if first < 0 {
+		return 3
+	}
+
+	count := last - first + 1
+	if maxLength <= 15 {
+		return 3 + (count+1)/2
+	}
+	return 3 + count
+}
+
+// usedLengthRange returns the first and last symbol with a non-zero length
+// (-1 when there are none) and the longest length
+func usedLengthRange(lengths []uint8) (int, int, uint8) {
+	first, last := -1, -1
+	maxLength := uint8(0)
+	for symbol, length := range lengths {
+		if length == 0 {
+			continue
+		}
+		if first < 0 {
+			first = symbol
+		}
+		last = symbol
+		maxLength = max(maxLength, length)
+	}
+	return first, last, maxLength
+}
+
 func readByte(reader io.Reader) (byte, error) {
 	buf := make([]byte, 1)
 	_, err := io.ReadFull(reader, buf)
@@ -135,3 +584,17 @@ func CalculateHeaderSize(freqTable FrequencyTable) int {
 	// Magic(2) + OriginalSize(8) + NumChars(1) + PaddingBits(1) + Entries(N*5)
 	return 12 + (len(freqTable) * 5)
 }
+
+// CalculateHeaderSizeV2 returns the size of the header WriteHeaderV2 writes
+func CalculateHeaderSizeV2(freqTable FrequencyTable, originalSize uint64) int {
+	// Magic(2) + Version(1) + Flags(1) + PaddingBits(1) + OriginalSize(varint) + NumChars(2) + Entries
+	size := 7 + uvarintSize(originalSize)
+	for _, freq := range freqTable {
+		size += 1 + uvarintSize(uint64(freq))
+	}
+	return size
+}
+
+func uvarintSize(value uint64) int {
+	return len(binary.AppendUvarint(nil, value))
+}
@@ -37,6 +37,15 @@ func AnalyzeFrequencies(filename string) (FrequencyTable, error) {
 	return table, nil
 }
 
+// CountFrequencies builds a frequency table from an in-memory buffer
+func CountFrequencies(data []byte) FrequencyTable {
+	table := make(FrequencyTable)
+	for _, b := range data {
+		table[b]++
+	}
+	return table
+}
+
 func PrintFrequencies(freqTable FrequencyTable) {
 	// Your task: Implement this function
 	// Print the frequency table in a readable format
@@ -0,0 +1,146 @@
+package internal
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+// FlagIndex marks a framed stream followed by a block index, so a reader
+// with random access finds the block holding any original offset without
+// decoding the blocks before it:
+//
+//	[Stream][Entry]...[Entry][EntryCount:4][IndexCRC:4][HI:2]
+//
+//	Entry: [OriginalOffset:8][CompressedOffset:8]
+//
+// There is one entry per block, CompressedOffset being where its block
+// header starts, and a last entry for the end-of-stream marker holding the
+// original size. The index comes after the trailer and isn't covered by the
+// stream checksums, IndexCRC covers the entries.
+const FlagIndex uint8 = 1 << 5
+
+const IndexMagic = "HI"
+
+const (
+	indexEntrySize  = 16
+	indexFooterSize = 10 // entry count, CRC and magic
+)
+
+// IndexEntry maps where a block starts in the original data to where it
+// starts in the stream
+type IndexEntry struct {
+	OriginalOffset   uint64
+	CompressedOffset uint64
+}
+
+// WriteIndex writes entries as the block index footer
+func WriteIndex(writer io.Writer, entries []IndexEntry) error {
+	buf := make([]byte, 0, len(entries)*indexEntrySize+indexFooterSize)
+	for _, entry := range entries {
+		buf = binary.BigEndian.AppendUint64(buf, entry.OriginalOffset)
+		buf = binary.BigEndian.AppendUint64(buf, entry.CompressedOffset)
+	}
+	crc := crc32.ChecksumIEEE(buf)
+	buf = binary.BigEndian.AppendUint32(buf, uint32(len(entries)))
+	buf = binary.BigEndian.AppendUint32(buf, crc)
+	buf = append(buf, IndexMagic...)
+	_, err := writer.Write(buf)
+	return err
+}
+
+// readIndexAt reads the block index at the end of the size byte stream in
+// reader and returns it with its size in bytes
+func readIndexAt(reader io.ReaderAt, size int64) ([]IndexEntry, int64, error) {
+	if size < indexFooterSize {
+		return nil, 0, fmt.Errorf("invalid index: stream too short")
+	}
+	footer := make([]byte, indexFooterSize)
+	_, err := reader.ReadAt(footer, size-indexFooterSize)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to read index footer: %w", unexpectedEOF(err))
+	}
+
+	count := int64(binary.BigEndian.Uint32(footer[0:4]))
+	indexSize := count*indexEntrySize + indexFooterSize
+	if count == 0 || indexSize > size {
+		return nil, 0, fmt.Errorf("invalid index: %d entries in a %d byte stream", count, size)
+	}
+	buf := make([]byte, indexSize-indexFooterSize)
+	_, err = reader.ReadAt(buf, size-indexSize)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to read index: %w", unexpectedEOF(err))
+	}
+
+	entries, err := parseIndex(buf, footer)
+	return entries, indexSize, err
+}
+
+// skipIndex reads the index following the trailer of a stream of blocks
+// blocks and returns its size in bytes
+func skipIndex(reader io.Reader, blocks int) (uint64, error) {
+	entries, err := readIndex(reader, blocks)
+	if err != nil {
+		return 0, err
+	}
+	return uint64(len(entries)*indexEntrySize + indexFooterSize), nil
+}
+
+// readIndex reads and checks the index following the trailer of a stream
+// of blocks blocks
+func readIndex(reader io.Reader, blocks int) ([]IndexEntry, error) {
+	buf := make([]byte, (blocks+1)*indexEntrySize+indexFooterSize)
+	_, err := io.ReadFull(reader, buf)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read index: %w", unexpectedEOF(err))
+	}
+	entries, err := parseIndex(buf[:len(buf)-indexFooterSize], buf[len(buf)-indexFooterSize:])
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) != blocks+1 {
+		return nil, fmt.Errorf("invalid index: %d entries for %d blocks", len(entries), blocks)
+	}
+	return entries, nil
+}
+
+// parseIndex checks footer against the entries in buf and decodes them
+func parseIndex(buf, footer []byte) ([]IndexEntry, error) {
+	if string(footer[8:]) != IndexMagic {
+		return nil, fmt.Errorf("invalid index: bad magic number")
+	}
+	if count := binary.BigEndian.Uint32(footer[0:4]); uint64(count)*indexEntrySize != uint64(len(buf)) {
+		return nil, fmt.Errorf("invalid index: %d entries in %d bytes", count, len(buf))
+	}
+	if crc := crc32.ChecksumIEEE(buf); crc != binary.BigEndian.Uint32(footer[4:8]) {
+		return nil, crcMismatch("index", binary.BigEndian.Uint32(footer[4:8]), crc)
+	}
+
+	entries := make([]IndexEntry, len(buf)/indexEntrySize)
+	for i := range entries {
+		entry := buf[i*indexEntrySize:]
+		entries[i].OriginalOffset = binary.BigEndian.Uint64(entry[0:8])
+		entries[i].CompressedOffset = binary.BigEndian.Uint64(entry[8:16])
+	}
+	return entries, nil
+}
+
+// checkIndex checks that entries describe blocks laid out one after the
+// other from headerSize, ending with the end-of-stream marker at end
+func checkIndex(entries []IndexEntry, headerSize, end uint64) error {
+	if len(entries) == 0 || entries[0] != (IndexEntry{0, headerSize}) {
+		return fmt.Errorf("invalid index: doesn't start at the first block")
+	}
+	for i := 1; i < len(entries); i++ {
+		original := entries[i].OriginalOffset - entries[i-1].OriginalOffset
+		if entries[i].OriginalOffset <= entries[i-1].OriginalOffset || original > MaxBlockSize ||
+			entries[i].CompressedOffset <= entries[i-1].CompressedOffset {
+			return fmt.Errorf("invalid index: entry %d out of order", i)
+		}
+	}
+	if last := entries[len(entries)-1].CompressedOffset; last != end {
+		return fmt.Errorf("invalid index: end-of-stream marker at %d, expected %d", last, end)
+	}
+	return nil
+}
@@ -0,0 +1,212 @@
+package internal
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strings"
+)
+
+// CompressedInfo describes a .hf file or framed stream as far as its
+// headers tell, without decoding any data
+type CompressedInfo struct {
+	Format         string // "file" or "stream"
+	Version        uint8
+	Flags          uint8
+	Level          int    // streams only, 0 when not recorded
+	OriginalSize   uint64 // bytes after decoding
+	CompressedSize uint64 // bytes read, the whole file when it is intact
+	HeaderSize     uint64 // headers, code tables and block headers
+	PayloadSize    uint64 // coded data
+	TrailerSize    uint64
+	IndexSize      uint64 // block index of streams with FlagIndex
+	Symbols        int    // unique byte values, files only
+	PaddingBits    uint8  // files only, streams pad every block
+	Blocks         int    // streams only
+}
+
+// Ratio is the compressed size as a percentage of the original size, like
+// CompressionStats.CompressionRatio
+func (info CompressedInfo) Ratio() float64 {
+	if info.OriginalSize == 0 {
+		return 0
+	}
+	return float64(info.CompressedSize) / float64(info.OriginalSize) * 100
+}
+
+// Overhead is the share of the compressed size taken by headers, trailer
+// and index, in percent
+func (info CompressedInfo) Overhead() float64 {
+	if info.CompressedSize == 0 {
+		return 0
+	}
+	return float64(info.HeaderSize+info.TrailerSize+info.IndexSize) / float64(info.CompressedSize) * 100
+}
+
+var flagNames = []struct {
+	flag uint8
+	name string
+}{
+	{FlagChecksum, "crc32"},
+	{FlagSHA256, "sha256"},
+	{FlagAdaptive, "adaptive"},
+	{FlagLZ77, "lz77"},
+	{FlagBlockModes, "block-modes"},
+	{FlagIndex, "index"},
+}
+
+// FlagNames lists the feature flags set in flags, "none" when there are none
+func FlagNames(flags uint8) string {
+	var names []string
+	for _, f := range flagNames {
+		if flags&f.flag != 0 {
+			names = append(names, f.name)
+			flags &^= f.flag
+		}
+	}
+	if flags != 0 {
+		names = append(names, fmt.Sprintf("%#02x", flags))
+	}
+	if len(names) == 0 {
+		return "none"
+	}
+	return strings.Join(names, ",")
+}
+
+// ReadCompressedInfo parses the headers of a .hf file or framed stream and
+// skips over the coded data. When the data doesn't match its headers, e.g.
+// in a truncated file, the fields read so far are returned with the error.
+func ReadCompressedInfo(reader io.Reader) (CompressedInfo, error) {
+	buffered := bufio.NewReader(reader)
+	counted := &countingReader{reader: buffered}
+
+	var info CompressedInfo
+	var err error
+	magic, peekErr := buffered.Peek(len(StreamMagic))
+	if peekErr == nil && string(magic) == StreamMagic {
+		info, err = readStreamInfo(counted)
+	} else {
+		info, err = readFileInfo(counted)
+	}
+	if err != nil {
+		info.CompressedSize = counted.count
+		return info, err
+	}
+
+	// Anything after the trailer isn't part of the file
+	extra, err := io.Copy(io.Discard, counted)
+	info.CompressedSize = counted.count
+	if err != nil {
+		return info, err
+	}
+	if extra > 0 {
+		return info, fmt.Errorf("%d bytes of unexpected data after the trailer", extra)
+	}
+	return info, nil
+}
+
+// GetCompressedInfo is ReadCompressedInfo for the file at path
+func GetCompressedInfo(path string) (CompressedInfo, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return CompressedInfo{}, err
+	}
+	defer file.Close()
+	return ReadCompressedInfo(file)
+}
+
+func readFileInfo(counted *countingReader) (CompressedInfo, error) {
+	info := CompressedInfo{Format: "file"}
+
+	header, err := ReadHeader(counted)
+	if err != nil {
+		return info, err
+	}
+	info.Version = header.Version
+	info.Flags = header.Flags
+	info.OriginalSize = header.OriginalSize
+	info.Symbols = len(header.FreqTable)
+	info.PaddingBits = header.PaddingBits
+	info.HeaderSize = counted.count
+	info.TrailerSize = uint64(TrailerSize(header.Flags))
+
+	// The payload size follows from the codes, which follow from the
+	// frequencies
+	err = header.checkFrequencies()
+	if err != nil {
+		return info, err
+	}
+	if header.OriginalSize > 0 {
+		root, err := BuildHuffmanTree(header.FreqTable)
+		if err != nil {
+			return info, err
+		}
+		info.PayloadSize = CalculatePayloadSize(header.FreqTable, GenerateCodes(root))
+	}
+
+	return info, skipBytes(counted, info.PayloadSize+info.TrailerSize)
+}
+
+func readStreamInfo(counted *countingReader) (CompressedInfo, error) {
+	info := CompressedInfo{Format: "stream"}
+
+	version, flags, level, err := readStreamHeader(counted)
+	info.Version, info.Flags, info.Level = version, flags, int(level)
+	if err != nil {
+		return info, err
+	}
+	info.HeaderSize = counted.count
+	info.TrailerSize = uint64(TrailerSize(info.Flags))
+
+	for {
+		start := counted.count
+		block, err := readBlockHeader(counted)
+		if err == io.EOF {
+			info.HeaderSize += counted.count - start
+			break
+		}
+		if err != nil {
+			return info, fmt.Errorf("block %d: %w", info.Blocks, err)
+		}
+		mode, err := readBlockMode(counted, info.Flags)
+		if err != nil {
+			return info, fmt.Errorf("block %d: %w", info.Blocks, err)
+		}
+		if mode == BlockHuffman {
+			_, err = ReadCodeLengths(counted)
+			if err != nil {
+				return info, fmt.Errorf("block %d: %w", info.Blocks, unexpectedEOF(err))
+			}
+		}
+		info.HeaderSize += counted.count - start
+
+		err = skipBytes(counted, uint64(block.compressedLen))
+		if err != nil {
+			return info, fmt.Errorf("block %d: %w", info.Blocks, err)
+		}
+		info.Blocks++
+		info.OriginalSize += uint64(block.originalLen)
+		info.PayloadSize += uint64(block.compressedLen)
+	}
+
+	err = skipBytes(counted, info.TrailerSize)
+	if err != nil || info.Flags&FlagIndex == 0 {
+		return info, err
+	}
+	info.IndexSize, err = skipIndex(counted, info.Blocks)
+	return info, err
+}
+
+// skipBytes reads and discards n bytes, which have to be there
+func skipBytes(reader io.Reader, n uint64) error {
+	if n > math.MaxInt64 {
+		return fmt.Errorf("invalid size %d", n)
+	}
+	skipped, err := io.CopyN(io.Discard, reader, int64(n))
+	if err == io.EOF {
+		return fmt.Errorf("file ends %d bytes early: %w", n-uint64(skipped), io.ErrUnexpectedEOF)
+	}
+	return err
+}
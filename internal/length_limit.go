@@ -0,0 +1,136 @@
+package internal
+
+import (
+	"fmt"
+	"sort"
+)
+
+// MaxCodeLength is the longest code HuffmanCode can hold (bits is a uint64)
+const MaxCodeLength = 64
+
+// DefaultMaxCodeLength caps codes in framed streams. 15 keeps every length
+// in a nibble of the code length table and keeps decode tables small.
+const DefaultMaxCodeLength = 15
+
+// CodeLengthsWithLimit returns code lengths for every byte value with no
+// code longer than maxLength. When the regular Huffman tree already fits,
+// its lengths are used as is, otherwise the lengths are recomputed with
+// PackageMerge.
+func CodeLengthsWithLimit(freqTable FrequencyTable, maxLength int) ([]uint8, error) {
+	root, err := BuildHuffmanTree(freqTable)
+	if err != nil {
+		return nil, err
+	}
+
+	if TreeDepth(root) <= maxLength {
+		return CodeLengths(root), nil
+	}
+
+	freqs := make([]int, 256)
+	for char, freq := range freqTable {
+		freqs[char] = freq
+	}
+	return PackageMerge(freqs, maxLength)
+}
+
+// GenerateLimitedCodes returns canonical codes for freqTable with no code
+// longer than maxLength
+func GenerateLimitedCodes(freqTable FrequencyTable, maxLength int) (CodeTable, error) {
+	lengths, err := CodeLengthsWithLimit(freqTable, maxLength)
+	if err != nil {
+		return nil, err
+	}
+	return CodeTableFromLengths(lengths)
+}
+
+// packageItem is either a single symbol or a package of two cheaper items
+type packageItem struct {
+	weight int
+	symbol int // -1 for packages
+	left   *packageItem
+	right  *packageItem
+}
+
+// PackageMerge computes optimal code lengths (indexed by symbol, 0 for
+// symbols with zero frequency) under the constraint that no code is longer
+// than maxLength, using the package-merge algorithm of Larmore and Hirschberg.
+func PackageMerge(freqs []int, maxLength int) ([]uint8, error) {
+	if maxLength < 1 || maxLength > MaxCanonicalLength {
+		return nil, fmt.Errorf("max code length %d out of range 1-%d", maxLength, MaxCanonicalLength)
+	}
+
+	// Leaves sorted by frequency, ties broken by symbol for determinism
+	leaves := make([]*packageItem, 0, len(freqs))
+	for symbol, freq := range freqs {
+		if freq < 0 {
+			return nil, fmt.Errorf("negative frequency %d for symbol %d", freq, symbol)
+		}
+		if freq > 0 {
+			leaves = append(leaves, &packageItem{weight: freq, symbol: symbol})
+		}
+	}
+	sort.SliceStable(leaves, func(i, j int) bool {
+		return leaves[i].weight < leaves[j].weight
+	})
+
+	lengths := make([]uint8, len(freqs))
+	n := len(leaves)
+	switch {
+	case n == 0:
+		return nil, fmt.Errorf("frequency table has no entries to process")
+	case n == 1:
+		// A single symbol still needs one bit per occurrence
+		lengths[leaves[0].symbol] = 1
+		return lengths, nil
+	case maxLength < 63 && n > 1<<maxLength:
+		return nil, fmt.Errorf("%d symbols cannot be coded with codes of at most %d bits", n, maxLength)
+	}
+
+	// Each round packages adjacent pairs of the current list and merges
+	// the packages back into the original leaves
+	current := leaves
+	for round := 1; round < maxLength; round++ {
+		packages := make([]*packageItem, 0, len(current)/2)
+		for i := 0; i+1 < len(current); i += 2 {
+			packages = append(packages, &packageItem{
+				weight: current[i].weight + current[i+1].weight,
+				symbol: -1,
+				left:   current[i],
+				right:  current[i+1],
+			})
+		}
+		current = mergeItems(leaves, packages)
+	}
+
+	// Every time a symbol appears in the 2n-2 cheapest items its code gets
+	// one bit longer
+	for _, item := range current[:2*n-2] {
+		countLeaves(item, lengths)
+	}
+	return lengths, nil
+}
+
+// mergeItems merges two weight-sorted lists, leaves first on ties
+func mergeItems(leaves, packages []*packageItem) []*packageItem {
+	merged := make([]*packageItem, 0, len(leaves)+len(packages))
+	i, j := 0, 0
+	for i < len(leaves) || j < len(packages) {
+		if j == len(packages) || (i < len(leaves) && leaves[i].weight <= packages[j].weight) {
+			merged = append(merged, leaves[i])
+			i++
+		} else {
+			merged = append(merged, packages[j])
+			j++
+		}
+	}
+	return merged
+}
+
+func countLeaves(item *packageItem, lengths []uint8) {
+	if item.symbol >= 0 {
+		lengths[item.symbol]++
+		return
+	}
+	countLeaves(item.left, lengths)
+	countLeaves(item.right, lengths)
+}
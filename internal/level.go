@@ -0,0 +1,197 @@
+package internal
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+)
+
+// Compression levels map to block pipelines, from fastest to smallest:
+//
+//	1    order-0 Huffman codes per block
+//	2-3  LZ77 with greedy matching, short hash chains
+//	4-8  LZ77 with lazy matching, longer hash chains
+//	9    optimal LZ77 parsing, and every block picks the smallest of
+//	     Huffman, LZ77 or stored
+//
+// The level goes into the stream header. Decoding only depends on the flags
+// and block modes, so any level can be decoded the same way.
+const (
+	MinLevel = 1
+	MaxLevel = 9
+)
+
+// FlagBlockModes marks a framed stream where every block has a Mode byte
+// after PaddingBits telling how the rest of the block is coded
+const FlagBlockModes uint8 = 1 << 4
+
+// Block modes
+const (
+	BlockHuffman  = 0 // code lengths and payload, see WriteBlock
+	BlockLZ77     = 1 // see WriteLZ77Block
+	BlockStored   = 2 // the original bytes
+	BlockAdaptive = 3 // see WriteAdaptiveBlock
+)
+
+var blockModeNames = [...]string{
+	BlockHuffman:  "huffman",
+	BlockLZ77:     "lz77",
+	BlockStored:   "stored",
+	BlockAdaptive: "adaptive",
+}
+
+// blockModeName names a block mode, unknown ones by number
+func blockModeName(mode byte) string {
+	if int(mode) < len(blockModeNames) {
+		return blockModeNames[mode]
+	}
+	return fmt.Sprintf("mode %d", mode)
+}
+
+// codingModeFlags pick how blocks are coded, at most one may be set
+const codingModeFlags = FlagAdaptive | FlagLZ77 | FlagBlockModes
+
+// blockHeaderSize is the size of the fields written by writeBlockHeader
+const blockHeaderSize = 9
+
+type levelConfig struct {
+	flags  uint8
+	params LZParams
+}
+
+var levelConfigs = [MaxLevel + 1]levelConfig{
+	1: {},
+	2: {FlagLZ77, LZParams{MaxChain: 4}},
+	3: {FlagLZ77, LZParams{MaxChain: 8}},
+	4: {FlagLZ77, LZParams{MaxChain: 16, Lazy: true}},
+	5: {FlagLZ77, LZParams{MaxChain: 32, Lazy: true}},
+	6: {FlagLZ77, LZParams{MaxChain: 64, Lazy: true}},
+	7: {FlagLZ77, LZParams{MaxChain: 128, Lazy: true}},
+	8: {FlagLZ77, LZParams{MaxChain: 256, Lazy: true}},
+	9: {FlagBlockModes, LZParams{MaxChain: 256, Lazy: true, Optimal: true}},
+}
+
+func getLevelConfig(level int) (levelConfig, error) {
+	if level < MinLevel || level > MaxLevel {
+		return levelConfig{}, fmt.Errorf("compression level %d out of range %d-%d", level, MinLevel, MaxLevel)
+	}
+	return levelConfigs[level], nil
+}
+
+// writeStreamBlock writes data as a block coded the way flags ask for
+func writeStreamBlock(writer io.Writer, data []byte, flags uint8, params LZParams) error {
+	switch {
+	case flags&FlagBlockModes != 0:
+		return WriteSmallestBlock(writer, data, params)
+	case flags&FlagAdaptive != 0:
+		return WriteAdaptiveBlock(writer, data)
+	case flags&FlagLZ77 != 0:
+		return WriteLZ77Block(writer, data, params)
+	default:
+		return WriteBlock(writer, data)
+	}
+}
+
+// readStreamBlock reads the next block of a stream with flags. It returns
+// io.EOF once the end-of-stream marker has been read.
+func readStreamBlock(reader io.Reader, flags uint8) ([]byte, error) {
+	header, err := readBlockHeader(reader)
+	if err != nil {
+		return nil, err
+	}
+	return readStreamBody(reader, header, flags)
+}
+
+// readStreamBody reads and decodes the rest of the block of header
+func readStreamBody(reader io.Reader, header blockHeader, flags uint8) ([]byte, error) {
+	mode, err := readBlockMode(reader, flags)
+	if err != nil {
+		return nil, err
+	}
+
+	switch mode {
+	case BlockHuffman:
+		return readHuffmanBody(reader, header)
+	case BlockLZ77:
+		return readLZ77Body(reader, header)
+	case BlockStored:
+		if header.compressedLen != header.originalLen {
+			return nil, fmt.Errorf("invalid block: stored block of %d bytes holds %d", header.compressedLen, header.originalLen)
+		}
+		return readPayload(reader, header)
+	case BlockAdaptive:
+		return readAdaptiveBody(reader, header)
+	default:
+		return nil, fmt.Errorf("invalid block: unknown mode %d", mode)
+	}
+}
+
+// readBlockMode reads the Mode byte of a block, or derives the mode from
+// the flags of streams without one
+func readBlockMode(reader io.Reader, flags uint8) (byte, error) {
+	switch {
+	case flags&FlagBlockModes != 0:
+		mode, err := readByte(reader)
+		return mode, unexpectedEOF(err)
+	case flags&FlagAdaptive != 0:
+		return BlockAdaptive, nil
+	case flags&FlagLZ77 != 0:
+		return BlockLZ77, nil
+	default:
+		return BlockHuffman, nil
+	}
+}
+
+// WriteSmallestBlock codes data with Huffman codes and with LZ77, and
+// writes whichever is smaller with a Mode byte, falling back to storing
+// data as is when neither saves anything
+func WriteSmallestBlock(writer io.Writer, data []byte, params LZParams) error {
+	err := checkBlockSize(data)
+	if err != nil {
+		return err
+	}
+
+	var huffman, lz bytes.Buffer
+	err = WriteBlock(&huffman, data)
+	if err != nil {
+		return err
+	}
+	err = WriteLZ77Block(&lz, data, params)
+	if err != nil {
+		return err
+	}
+
+	best, mode := &huffman, byte(BlockHuffman)
+	if lz.Len() < best.Len() {
+		best, mode = &lz, BlockLZ77
+	}
+
+	if best.Len() >= blockHeaderSize+len(data) {
+		err = writeBlockHeader(writer, blockHeader{
+			originalLen:   uint32(len(data)),
+			compressedLen: uint32(len(data)),
+		})
+		if err != nil {
+			return err
+		}
+		_, err = writer.Write([]byte{BlockStored})
+		if err != nil {
+			return err
+		}
+		_, err = writer.Write(data)
+		return err
+	}
+
+	// Insert the mode between the block header and the rest of the block
+	block := best.Bytes()
+	_, err = writer.Write(block[:blockHeaderSize])
+	if err != nil {
+		return err
+	}
+	_, err = writer.Write([]byte{mode})
+	if err != nil {
+		return err
+	}
+	_, err = writer.Write(block[blockHeaderSize:])
+	return err
+}
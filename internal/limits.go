@@ -0,0 +1,114 @@
+package internal
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+)
+
+// DecodeLimits guard a decoder against decompression bombs: a header
+// claiming a huge OriginalSize, or a tiny payload that expands enormously.
+// Zero fields mean no limit.
+type DecodeLimits struct {
+	MaxOutputSize uint64  // decoded bytes
+	MaxRatio      float64 // decoded bytes per compressed byte read
+}
+
+// LimitError is returned when decoding would break a DecodeLimits
+type LimitError struct {
+	Limit  string // "output size" or "expansion ratio"
+	Max    float64
+	Actual float64
+}
+
+func (e *LimitError) Error() string {
+	if e.Limit == "output size" {
+		return fmt.Sprintf("decompression limit exceeded: output size %.0f bytes over the limit of %.0f", e.Actual, e.Max)
+	}
+	return fmt.Sprintf("decompression limit exceeded: expansion ratio %.1f over the limit of %.1f", e.Actual, e.Max)
+}
+
+// check returns a *LimitError when output decoded bytes break the limits.
+// The ratio is only checked once input, the compressed bytes read so far,
+// is known.
+func (l DecodeLimits) check(output, input uint64) error {
+	if l.MaxOutputSize > 0 && output > l.MaxOutputSize {
+		return &LimitError{Limit: "output size", Max: float64(l.MaxOutputSize), Actual: float64(output)}
+	}
+	if l.MaxRatio > 0 && input > 0 && float64(output) > l.MaxRatio*float64(input) {
+		return &LimitError{Limit: "expansion ratio", Max: l.MaxRatio, Actual: float64(output) / float64(input)}
+	}
+	return nil
+}
+
+// limitedReader fails with a *LimitError as soon as the decoded bytes read
+// through it break the limits
+type limitedReader struct {
+	decoded io.Reader
+	input   *countingReader // compressed bytes read so far
+	output  uint64
+	limits  DecodeLimits
+	err     error
+}
+
+func newLimitedReader(decoded io.Reader, input *countingReader, limits DecodeLimits) *limitedReader {
+	return &limitedReader{decoded: decoded, input: input, limits: limits}
+}
+
+func (lr *limitedReader) Read(p []byte) (int, error) {
+	if lr.err != nil {
+		return 0, lr.err
+	}
+
+	// Decode at most one byte past the size limit, enough to detect it
+	if limit := lr.limits.MaxOutputSize; limit > 0 && uint64(len(p)) > limit-lr.output+1 {
+		p = p[:limit-lr.output+1]
+	}
+
+	n, err := lr.decoded.Read(p)
+	lr.output += uint64(n)
+	if limitErr := lr.limits.check(lr.output, lr.input.count); limitErr != nil {
+		lr.err = limitErr
+		return 0, limitErr
+	}
+	return n, err
+}
+
+// NewLimitedReader reads the header of a framed stream or a .hf file from
+// reader and returns a reader for the decoded data. Reads fail with a
+// *LimitError once the output breaks limits, a file header claiming too
+// much output fails right away. It may read more data than necessary from
+// reader.
+func NewLimitedReader(reader io.Reader, limits DecodeLimits) (io.Reader, error) {
+	return NewLimitedReaderWorkers(reader, limits, 1)
+}
+
+// NewLimitedReaderWorkers is like NewLimitedReader, decoding up to workers
+// blocks of a framed stream at once. Every block header is checked against
+// limits before the block is decoded, blocks read ahead included, so a
+// block claiming too much output is never allocated.
+func NewLimitedReaderWorkers(reader io.Reader, limits DecodeLimits, workers int) (io.Reader, error) {
+	input := &countingReader{reader: reader}
+	buffered := bufio.NewReader(input)
+
+	magic, err := buffered.Peek(len(StreamMagic))
+	if err == nil && string(magic) == StreamMagic {
+		stream, err := NewStreamReader(buffered)
+		if err != nil {
+			return nil, err
+		}
+		stream.SetConcurrency(workers)
+		stream.limits = limits
+		return newLimitedReader(stream, input, limits), nil
+	}
+
+	file, err := NewFileReader(buffered)
+	if err != nil {
+		return nil, err
+	}
+	err = limits.check(file.Header().OriginalSize, 0)
+	if err != nil {
+		return nil, err
+	}
+	return newLimitedReader(file, input, limits), nil
+}
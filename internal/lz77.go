@@ -0,0 +1,611 @@
+package internal
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+)
+
+// FlagLZ77 marks a framed stream whose blocks are LZ77 compressed before
+// Huffman coding. A block is parsed into literals and (length, distance)
+// matches against the previous 32 KiB of the block, then coded with two
+// canonical code tables: one for literals and match lengths, one for
+// distances. Length and distance symbols are followed by extra bits, using
+// the same symbol ranges as DEFLATE.
+const FlagLZ77 uint8 = 1 << 3
+
+const (
+	lzMinMatch   = 3
+	lzMaxMatch   = 258
+	lzWindowSize = 1 << 15
+	lzHashBits   = 15
+
+	// lzNiceLength is long enough for optimal parsing to take a match
+	// without pricing the positions it covers
+	lzNiceLength = 128
+
+	// lzLiteralSymbols is the size of the literal/length alphabet: byte
+	// values 0-255 followed by one symbol per length range
+	lzLiteralSymbols = 256 + len(lzLengthBase)
+	lzDistSymbols    = len(lzDistBase)
+)
+
+var (
+	lzLengthBase = [...]int{
+		3, 4, 5, 6, 7, 8, 9, 10, 11, 13, 15, 17, 19, 23, 27, 31,
+		35, 43, 51, 59, 67, 83, 99, 115, 131, 163, 195, 227, 258,
+	}
+	lzLengthExtra = [...]int{
+		0, 0, 0, 0, 0, 0, 0, 0, 1, 1, 1, 1, 2, 2, 2, 2,
+		3, 3, 3, 3, 4, 4, 4, 4, 5, 5, 5, 5, 0,
+	}
+	lzDistBase = [...]int{
+		1, 2, 3, 4, 5, 7, 9, 13, 17, 25, 33, 49, 65, 97, 129, 193,
+		257, 385, 513, 769, 1025, 1537, 2049, 3073, 4097, 6145, 8193, 12289, 16385, 24577,
+	}
+	lzDistExtra = [...]int{
+		0, 0, 0, 0, 1, 1, 2, 2, 3, 3, 4, 4, 5, 5, 6, 6,
+		7, 7, 8, 8, 9, 9, 10, 10, 11, 11, 12, 12, 13, 13,
+	}
+)
+
+// lzLengthSymbols maps every match length to its length symbol (0-28)
+var lzLengthSymbols = func() [lzMaxMatch + 1]uint8 {
+	var symbols [lzMaxMatch + 1]uint8
+	symbol := 0
+	for length := lzMinMatch; length <= lzMaxMatch; length++ {
+		for symbol+1 < len(lzLengthBase) && lzLengthBase[symbol+1] <= length {
+			symbol++
+		}
+		symbols[length] = uint8(symbol)
+	}
+	return symbols
+}()
+
+// lzToken is a literal (length 0) or a match
+type lzToken struct {
+	length   uint16
+	distance uint16
+	literal  byte
+}
+
+// LZParams tune the match finder
+type LZParams struct {
+	MaxChain int  // candidates tried per position
+	Lazy     bool // defer a match when the next position has a longer one
+	Optimal  bool // choose matches by their coded size instead (slow)
+}
+
+// DefaultLZParams balance speed and ratio
+var DefaultLZParams = LZParams{MaxChain: 32, Lazy: true}
+
+// lzMatch is a match candidate
+type lzMatch struct {
+	length   int
+	distance int
+}
+
+// lzMatcher finds matches with hash chains over 3-byte prefixes
+type lzMatcher struct {
+	data     []byte
+	head     []int32 // last position with each hash, -1 if none
+	prev     []int32 // previous position with the same hash
+	maxChain int
+	found    []lzMatch // scratch space for longestMatch
+}
+
+func newLZMatcher(data []byte, maxChain int) *lzMatcher {
+	head := make([]int32, 1<<lzHashBits)
+	for i := range head {
+		head[i] = -1
+	}
+	return &lzMatcher{
+		data:     data,
+		head:     head,
+		prev:     make([]int32, len(data)),
+		maxChain: max(maxChain, 1),
+	}
+}
+
+func (m *lzMatcher) hash(pos int) uint32 {
+	v := uint32(m.data[pos])<<16 | uint32(m.data[pos+1])<<8 | uint32(m.data[pos+2])
+	return (v * 2654435761) >> (32 - lzHashBits)
+}
+
+// insert adds pos to the hash chains
+func (m *lzMatcher) insert(pos int) {
+	if pos+lzMinMatch > len(m.data) {
+		return
+	}
+	h := m.hash(pos)
+	m.prev[pos] = m.head[h]
+	m.head[h] = int32(pos)
+}
+
+// matches appends to found[:0] the earlier matches for pos within the
+// window, of at least lzMinMatch bytes. Each one is longer than the one
+// before and has the shortest distance reaching its length.
+func (m *lzMatcher) matches(pos int, found []lzMatch) []lzMatch {
+	found = found[:0]
+	if pos+lzMinMatch > len(m.data) {
+		return found
+	}
+	maxLength := min(lzMaxMatch, len(m.data)-pos)
+	bestLength := lzMinMatch - 1
+
+	candidate := m.head[m.hash(pos)]
+	for chain := 0; candidate >= 0 && chain < m.maxChain; chain++ {
+		distance := pos - int(candidate)
+		if distance > lzWindowSize {
+			break
+		}
+
+		// A candidate can only be longer if it matches one byte past the
+		// best length
+		if bestLength < maxLength && m.data[int(candidate)+bestLength] != m.data[pos+bestLength] {
+			candidate = m.prev[candidate]
+			continue
+		}
+
+		length := 0
+		for length < maxLength && m.data[int(candidate)+length] == m.data[pos+length] {
+			length++
+		}
+		if length > bestLength {
+			bestLength = length
+			found = append(found, lzMatch{length: length, distance: distance})
+			if length == maxLength {
+				break
+			}
+		}
+		candidate = m.prev[candidate]
+	}
+	return found
+}
+
+// longestMatch returns the longest earlier match for pos within the window,
+// length 0 when there is none of at least lzMinMatch bytes
+func (m *lzMatcher) longestMatch(pos int) (int, int) {
+	m.found = m.matches(pos, m.found)
+	if len(m.found) == 0 {
+		return 0, 0
+	}
+	best := m.found[len(m.found)-1]
+	return best.length, best.distance
+}
+
+// lzParse splits data into literals and matches
+func lzParse(data []byte, params LZParams) []lzToken {
+	if params.Optimal {
+		return lzParseOptimal(data, params)
+	}
+
+	matcher := newLZMatcher(data, params.MaxChain)
+	tokens := make([]lzToken, 0, len(data)/2)
+
+	pos := 0
+	for pos < len(data) {
+		length, distance := matcher.longestMatch(pos)
+		matcher.insert(pos)
+
+		if length > 0 && params.Lazy && length < lzMaxMatch && pos+1 < len(data) {
+			// A longer match one byte later is worth a literal
+			nextLength, _ := matcher.longestMatch(pos + 1)
+			if nextLength > length {
+				length = 0
+			}
+		}
+
+		if length == 0 {
+			tokens = append(tokens, lzToken{literal: data[pos]})
+			pos++
+			continue
+		}
+
+		tokens = append(tokens, lzToken{length: uint16(length), distance: uint16(distance)})
+		for i := pos + 1; i < pos+length; i++ {
+			matcher.insert(i)
+		}
+		pos += length
+	}
+	return tokens
+}
+
+// lzParseOptimal picks the literals and matches with the smallest coded
+// size. Symbols are priced with the code lengths a lazy parse of the same
+// data produces, then the cheapest path from the first to the last byte is
+// found with one pass of dynamic programming over all positions.
+func lzParseOptimal(data []byte, params LZParams) []lzToken {
+	costs := newLZCosts(lzParse(data, LZParams{MaxChain: params.MaxChain, Lazy: true}))
+
+	// price[i] is the cheapest cost of coding data[:i], choice[i] the last
+	// token on that path
+	price := make([]uint32, len(data)+1)
+	for i := range price[1:] {
+		price[i+1] = math.MaxUint32
+	}
+	choice := make([]lzToken, len(data)+1)
+
+	matcher := newLZMatcher(data, params.MaxChain)
+	var found []lzMatch
+	for pos := 0; pos < len(data); pos++ {
+		found = matcher.matches(pos, found)
+		matcher.insert(pos)
+
+		literal := data[pos]
+		if cost := price[pos] + costs.literal[literal]; cost < price[pos+1] {
+			price[pos+1] = cost
+			choice[pos+1] = lzToken{literal: literal}
+		}
+
+		prevLength := lzMinMatch - 1
+		for _, match := range found {
+			for length := prevLength + 1; length <= match.length; length++ {
+				// Lengths sharing a symbol cost the same, only the longest
+				// of them and the full match are worth trying
+				if length < match.length && lzLengthSymbols[length] == lzLengthSymbols[length+1] {
+					continue
+				}
+				cost := price[pos] + costs.match(length, match.distance)
+				if cost < price[pos+length] {
+					price[pos+length] = cost
+					choice[pos+length] = lzToken{length: uint16(length), distance: uint16(match.distance)}
+				}
+			}
+			prevLength = match.length
+		}
+
+		// Skip over long matches, pricing every position in long runs is
+		// slow and gains next to nothing
+		if len(found) > 0 && found[len(found)-1].length >= lzNiceLength {
+			end := pos + found[len(found)-1].length
+			for pos++; pos < end; pos++ {
+				matcher.insert(pos)
+			}
+			pos--
+		}
+	}
+
+	// Walk the cheapest path back from the end
+	count := 0
+	for pos := len(data); pos > 0; pos -= max(int(choice[pos].length), 1) {
+		count++
+	}
+	tokens := make([]lzToken, count)
+	for pos := len(data); pos > 0; pos -= max(int(choice[pos].length), 1) {
+		count--
+		tokens[count] = choice[pos]
+	}
+	return tokens
+}
+
+// lzCosts are symbol prices in bits, extra bits included
+type lzCosts struct {
+	literal  [lzLiteralSymbols]uint32
+	distance [lzDistSymbols]uint32
+}
+
+func newLZCosts(tokens []lzToken) *lzCosts {
+	litFreqs, distFreqs := lzFrequencies(tokens)
+	costs := &lzCosts{}
+	fillCosts(costs.literal[:], litFreqs)
+	fillCosts(costs.distance[:], distFreqs)
+
+	for symbol, extra := range lzLengthExtra {
+		costs.literal[256+symbol] += uint32(extra)
+	}
+	for symbol, extra := range lzDistExtra {
+		costs.distance[symbol] += uint32(extra)
+	}
+	return costs
+}
+
+// fillCosts prices every symbol with its code length, symbols without a
+// code get one bit more than the longest code
+func fillCosts(costs []uint32, freqs []int) {
+	lengths, _, err := lzCodes(freqs)
+	for symbol := range costs {
+		costs[symbol] = DefaultMaxCodeLength + 1
+		if err == nil && lengths[symbol] > 0 {
+			costs[symbol] = uint32(lengths[symbol])
+		}
+	}
+}
+
+func (c *lzCosts) match(length, distance int) uint32 {
+	return c.literal[256+lzLengthSymbol(length)] + c.distance[lzDistSymbol(distance)]
+}
+
+// lzFrequencies counts the literal/length and distance symbols of tokens
+func lzFrequencies(tokens []lzToken) ([]int, []int) {
+	litFreqs := make([]int, lzLiteralSymbols)
+	distFreqs := make([]int, lzDistSymbols)
+	for _, token := range tokens {
+		if token.length == 0 {
+			litFreqs[token.literal]++
+			continue
+		}
+		litFreqs[256+lzLengthSymbol(int(token.length))]++
+		distFreqs[lzDistSymbol(int(token.distance))]++
+	}
+	return litFreqs, distFreqs
+}
+
+// lzLengthSymbol returns the literal/length symbol index (0-28) for length
+func lzLengthSymbol(length int) int {
+	return int(lzLengthSymbols[length])
+}
+
+// lzDistSymbol returns the distance symbol for distance
+func lzDistSymbol(distance int) int {
+	symbol := len(lzDistBase) - 1
+	for lzDistBase[symbol] > distance {
+		symbol--
+	}
+	return symbol
+}
+
+// writeExtraBits writes value most significant bit first, like codes
+func writeExtraBits(bitBuffer *BitBuffer, value, count int) error {
+	if count == 0 {
+		return nil
+	}
+	return bitBuffer.WriteBits(reverseCode(uint64(value), count), count)
+}
+
+func readExtraBits(bitReader *BitReader, count int) (int, error) {
+	if count == 0 {
+		return 0, nil
+	}
+	value, available := bitReader.PeekBits(count)
+	if available < count {
+		if err := bitReader.Err(); err != nil {
+			return 0, err
+		}
+		return 0, io.EOF
+	}
+	bitReader.SkipBits(count)
+	return int(value), nil
+}
+
+// lzCodes builds length-limited canonical codes for freqs. An alphabet
+// nothing was counted for gets no codes.
+func lzCodes(freqs []int) ([]uint8, []HuffmanCode, error) {
+	used := false
+	for _, freq := range freqs {
+		used = used || freq > 0
+	}
+	if !used {
+		return make([]uint8, len(freqs)), nil, nil
+	}
+
+	lengths, err := PackageMerge(freqs, DefaultMaxCodeLength)
+	if err != nil {
+		return nil, nil, err
+	}
+	codes, err := CanonicalCodes(lengths)
+	if err != nil {
+		return nil, nil, err
+	}
+	return lengths, codes, nil
+}
+
+// EncodeLZ77 compresses data into writer as
+// [LiteralLengths][DistanceLengths][Payload] and returns the number of
+// padding bits in the last payload byte
+func EncodeLZ77(writer io.Writer, data []byte, params LZParams) (int, error) {
+	tokens := lzParse(data, params)
+	litFreqs, distFreqs := lzFrequencies(tokens)
+
+	litLengths, litCodes, err := lzCodes(litFreqs)
+	if err != nil {
+		return 0, fmt.Errorf("failed to build literal/length codes: %w", err)
+	}
+	distLengths, distCodes, err := lzCodes(distFreqs)
+	if err != nil {
+		return 0, fmt.Errorf("failed to build distance codes: %w", err)
+	}
+
+	err = writeSymbolLengths(writer, litLengths)
+	if err != nil {
+		return 0, err
+	}
+	err = writeSymbolLengths(writer, distLengths)
+	if err != nil {
+		return 0, err
+	}
+
+	bitBuffer := NewBitBuffer(writer)
+	for _, token := range tokens {
+		if token.length == 0 {
+			code := litCodes[token.literal]
+			err = bitBuffer.WriteBits(code.bits, code.length)
+			if err != nil {
+				return 0, err
+			}
+			continue
+		}
+
+		length, distance := int(token.length), int(token.distance)
+		lengthSymbol := lzLengthSymbol(length)
+		code := litCodes[256+lengthSymbol]
+		err = bitBuffer.WriteBits(code.bits, code.length)
+		if err != nil {
+			return 0, err
+		}
+		err = writeExtraBits(bitBuffer, length-lzLengthBase[lengthSymbol], lzLengthExtra[lengthSymbol])
+		if err != nil {
+			return 0, err
+		}
+
+		distSymbol := lzDistSymbol(distance)
+		code = distCodes[distSymbol]
+		err = bitBuffer.WriteBits(code.bits, code.length)
+		if err != nil {
+			return 0, err
+		}
+		err = writeExtraBits(bitBuffer, distance-lzDistBase[distSymbol], lzDistExtra[distSymbol])
+		if err != nil {
+			return 0, err
+		}
+	}
+	return bitBuffer.Close()
+}
+
+// DecodeLZ77 decodes length bytes written by EncodeLZ77
+func DecodeLZ77(reader io.Reader, length int) ([]byte, error) {
+	litLengths, err := readSymbolLengths(reader, lzLiteralSymbols)
+	if err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	distLengths, err := readSymbolLengths(reader, lzDistSymbols)
+	if err != nil {
+		return nil, unexpectedEOF(err)
+	}
+
+	litDecoder, err := lzDecoder(litLengths)
+	if err != nil {
+		return nil, fmt.Errorf("invalid literal/length codes: %w", err)
+	}
+	distDecoder, err := lzDecoder(distLengths)
+	if err != nil {
+		return nil, fmt.Errorf("invalid distance codes: %w", err)
+	}
+	if litDecoder == nil {
+		return nil, fmt.Errorf("invalid literal/length codes: table is empty")
+	}
+
+	bitReader := NewBitReader(reader)
+	data := make([]byte, 0, length)
+	for len(data) < length {
+		symbol, err := litDecoder.Decode(bitReader)
+		if err == io.EOF {
+			return nil, fmt.Errorf("payload ended after %d of %d bytes", len(data), length)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if symbol < 256 {
+			data = append(data, byte(symbol))
+			continue
+		}
+
+		lengthSymbol := symbol - 256
+		extra, err := readExtraBits(bitReader, lzLengthExtra[lengthSymbol])
+		if err == io.EOF {
+			return nil, fmt.Errorf("payload ended inside a match")
+		}
+		if err != nil {
+			return nil, err
+		}
+		matchLength := lzLengthBase[lengthSymbol] + extra
+
+		if distDecoder == nil {
+			return nil, fmt.Errorf("corrupted data: match without distance codes")
+		}
+		distSymbol, err := distDecoder.Decode(bitReader)
+		if err == nil {
+			extra, err = readExtraBits(bitReader, lzDistExtra[distSymbol])
+		}
+		if err == io.EOF {
+			return nil, fmt.Errorf("payload ended inside a match")
+		}
+		if err != nil {
+			return nil, err
+		}
+		distance := lzDistBase[distSymbol] + extra
+
+		if distance > len(data) {
+			return nil, fmt.Errorf("corrupted data: match distance %d before start of block", distance)
+		}
+		if matchLength > length-len(data) {
+			return nil, fmt.Errorf("corrupted data: match of %d bytes overruns block", matchLength)
+		}
+
+		// Byte by byte, a match may overlap the bytes it produces
+		start := len(data) - distance
+		for i := 0; i < matchLength; i++ {
+			data = append(data, data[start+i])
+		}
+	}
+	return data, nil
+}
+
+// lzDecoder returns a table decoder for lengths, nil when no symbol is used
+func lzDecoder(lengths []uint8) (*TableDecoder, error) {
+	_, _, maxLength := usedLengthRange(lengths)
+	if maxLength == 0 {
+		return nil, nil
+	}
+	codes, err := CanonicalCodes(lengths)
+	if err != nil {
+		return nil, err
+	}
+	return NewTableDecoder(codes)
+}
+
+// writeSymbolLengths writes code lengths for an alphabet that may be larger
+// than a byte as [First:2][Count:2][Lengths], two 4-bit lengths per byte
+// with the high nibble first. Count 0 means no symbol is used.
+func writeSymbolLengths(writer io.Writer, lengths []uint8) error {
+	first, last, maxLength := usedLengthRange(lengths)
+	if maxLength > 15 {
+		return fmt.Errorf("code length %d does not fit 4 bits", maxLength)
+	}
+
+	buf := make([]byte, 4)
+	if first < 0 {
+		_, err := writer.Write(buf)
+		return err
+	}
+
+	used := lengths[first : last+1]
+	binary.BigEndian.PutUint16(buf[0:2], uint16(first))
+	binary.BigEndian.PutUint16(buf[2:4], uint16(len(used)))
+	packed := make([]byte, (len(used)+1)/2)
+	for i, length := range used {
+		if i%2 == 0 {
+			packed[i/2] |= length << 4
+		} else {
+			packed[i/2] |= length
+		}
+	}
+	_, err := writer.Write(append(buf, packed...))
+	return err
+}
+
+// readSymbolLengths reads a table written by writeSymbolLengths for an
+// alphabet of alphabetSize symbols
+func readSymbolLengths(reader io.Reader, alphabetSize int) ([]uint8, error) {
+	buf := make([]byte, 4)
+	_, err := io.ReadFull(reader, buf)
+	if err != nil {
+		return nil, err
+	}
+	first := int(binary.BigEndian.Uint16(buf[0:2]))
+	count := int(binary.BigEndian.Uint16(buf[2:4]))
+
+	lengths := make([]uint8, alphabetSize)
+	if count == 0 {
+		return lengths, nil
+	}
+	if first+count > alphabetSize {
+		return nil, fmt.Errorf("invalid code length table: symbols %d-%d outside alphabet of %d", first, first+count-1, alphabetSize)
+	}
+
+	packed := make([]byte, (count+1)/2)
+	_, err = io.ReadFull(reader, packed)
+	if err != nil {
+		return nil, err
+	}
+	for i := 0; i < count; i++ {
+		if i%2 == 0 {
+			lengths[first+i] = packed[i/2] >> 4
+		} else {
+			lengths[first+i] = packed[i/2] & 0x0f
+		}
+	}
+	return lengths, nil
+}
@@ -0,0 +1,156 @@
+package internal
+
+import (
+	"bytes"
+	"io"
+)
+
+// Blocks of a framed stream are independent, each carries its own code
+// table, so they can be coded on separate goroutines. Results are collected
+// in stream order and the checksums are fed from the calling goroutine, so
+// the output is byte for byte the same whatever the number of workers.
+
+// codedBlock is what a worker goroutine hands back for one block
+type codedBlock struct {
+	input  []byte // block given to the worker, reusable once it is done
+	output []byte
+	err    error
+}
+
+// SetConcurrency lets sw encode up to n blocks at once, each on its own
+// goroutine. n <= 1 encodes on the calling goroutine, as by default. Memory
+// grows to about two blocks per worker. Call it before the first Write.
+func (sw *StreamWriter) SetConcurrency(n int) {
+	sw.workers = max(n, 1)
+}
+
+// encodeAsync hands the pending block to a new goroutine, first writing out
+// the oldest one when workers blocks are already being encoded
+func (sw *StreamWriter) encodeAsync() error {
+	err := sw.drain(sw.workers - 1)
+	if err != nil {
+		return err
+	}
+
+	block := sw.block
+	result := make(chan codedBlock, 1)
+	go func() {
+		var output bytes.Buffer
+		err := writeStreamBlock(&output, block, sw.flags, sw.params)
+		result <- codedBlock{input: block, output: output.Bytes(), err: err}
+	}()
+	sw.pending = append(sw.pending, result)
+
+	// Reuse the buffer of a block already written out
+	if n := len(sw.spare); n > 0 {
+		sw.block = sw.spare[n-1]
+		sw.spare = sw.spare[:n-1]
+	} else {
+		sw.block = make([]byte, 0, sw.blockSize)
+	}
+	return nil
+}
+
+// drain writes out encoded blocks in stream order until at most keep are
+// left in flight. A failed block fails the whole stream, the blocks after it
+// are dropped.
+func (sw *StreamWriter) drain(keep int) error {
+	for len(sw.pending) > keep {
+		result := <-sw.pending[0]
+		sw.pending = sw.pending[1:]
+
+		err := result.err
+		if err == nil {
+			sw.addIndexEntry(len(result.input))
+			_, err = sw.body.Write(result.output)
+		}
+		if err != nil {
+			sw.pending = nil
+			sw.err = err
+			return err
+		}
+		sw.spare = append(sw.spare, result.input[:0])
+	}
+	return nil
+}
+
+// SetConcurrency lets sr decode up to n blocks at once, each on its own
+// goroutine, reading ahead of the data returned so far. n <= 1 decodes on
+// the calling goroutine, as by default. Call it before the first Read.
+func (sr *StreamReader) SetConcurrency(n int) {
+	sr.workers = max(n, 1)
+}
+
+// nextBlock returns the next decoded block, or io.EOF once the
+// end-of-stream marker has been read. Every block is admitted against the
+// limits before it is decoded, blocks read ahead included.
+func (sr *StreamReader) nextBlock() ([]byte, error) {
+	if sr.workers <= 1 {
+		header, err := readBlockHeader(sr.reader)
+		if err == nil {
+			err = sr.admit(header)
+		}
+		if err != nil {
+			return nil, err
+		}
+		return readStreamBody(sr.reader, header, sr.flags)
+	}
+
+	// Blocks are read one after the other, only decoding is concurrent.
+	// Read ahead stops at the first block breaking the limits.
+	for !sr.ended && len(sr.pending) < sr.workers {
+		result := make(chan codedBlock, 1)
+		raw, err := readRawBlock(sr.reader, sr.flags, sr.admit)
+		if err != nil {
+			// Reported after the blocks before it, io.EOF included
+			sr.ended = true
+			result <- codedBlock{err: err}
+		} else {
+			go func() {
+				data, err := readStreamBlock(bytes.NewReader(raw), sr.flags)
+				result <- codedBlock{output: data, err: err}
+			}()
+		}
+		sr.pending = append(sr.pending, result)
+	}
+	if len(sr.pending) == 0 {
+		return nil, io.EOF
+	}
+
+	result := <-sr.pending[0]
+	sr.pending = sr.pending[1:]
+	return result.output, result.err
+}
+
+// readRawBlock returns the next block as stored, header included, without
+// decoding it. admit gets the header before the rest is read. It returns
+// io.EOF after the end-of-stream marker.
+func readRawBlock(reader io.Reader, flags uint8, admit func(blockHeader) error) ([]byte, error) {
+	var raw bytes.Buffer
+	tee := io.TeeReader(reader, &raw)
+
+	header, err := readBlockHeader(tee)
+	if err == nil {
+		err = admit(header)
+	}
+	if err != nil {
+		return nil, err
+	}
+	mode, err := readBlockMode(tee, flags)
+	if err != nil {
+		return nil, err
+	}
+	// Code lengths aren't counted in compressedLen
+	if mode == BlockHuffman {
+		_, err = ReadCodeLengths(tee)
+		if err != nil {
+			return nil, unexpectedEOF(err)
+		}
+	}
+
+	_, err = io.CopyN(&raw, reader, int64(header.compressedLen))
+	if err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	return raw.Bytes(), nil
+}
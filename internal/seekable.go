@@ -0,0 +1,228 @@
+package internal
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+)
+
+// SeekableReader gives random access to the original data of a framed
+// stream: it implements io.ReaderAt, io.Reader and io.Seeker and decodes
+// only the blocks a read touches, keeping the last one. Streams written
+// with FlagIndex are opened from their index, others by walking their block
+// headers once. Checksums cover the whole stream and aren't verified, use
+// VerifyCompressedFile for that.
+//
+// ReadAt can be called concurrently, Read and Seek can't.
+type SeekableReader struct {
+	reader io.ReaderAt
+	flags  uint8
+	index  []IndexEntry // one entry per block, then the end-of-stream marker
+	offset int64        // position of Read and Seek
+
+	mu     sync.Mutex
+	cached int // block held in data, -1 for none
+	data   []byte
+}
+
+// endOfStreamSize is the size of the marker written by WriteEndOfStream
+const endOfStreamSize = 4
+
+// NewSeekableReader reads the stream header and the block index of the
+// size byte stream in reader. No block is decoded.
+func NewSeekableReader(reader io.ReaderAt, size int64) (*SeekableReader, error) {
+	version, flags, _, err := readStreamHeader(io.NewSectionReader(reader, 0, size))
+	if err != nil {
+		return nil, err
+	}
+	headerSize := int64(streamHeaderSize(version))
+
+	var index []IndexEntry
+	if flags&FlagIndex != 0 {
+		var indexSize int64
+		index, indexSize, err = readIndexAt(reader, size)
+		if err != nil {
+			return nil, err
+		}
+		// The end-of-stream marker and the trailer sit between the last
+		// block and the index
+		end := size - indexSize - int64(TrailerSize(flags)) - endOfStreamSize
+		if end < headerSize {
+			return nil, fmt.Errorf("invalid index: %d byte stream too short for its index", size)
+		}
+		err = checkIndex(index, uint64(headerSize), uint64(end))
+	} else {
+		index, err = scanBlocks(reader, size, headerSize, flags)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &SeekableReader{reader: reader, flags: flags, index: index, cached: -1}, nil
+}
+
+// scanBlocks builds the index of a stream written without one, reading
+// only the block headers
+func scanBlocks(reader io.ReaderAt, size, headerSize int64, flags uint8) ([]IndexEntry, error) {
+	section := io.NewSectionReader(reader, headerSize, size-headerSize)
+	var index []IndexEntry
+	var original uint64
+	for {
+		position, _ := section.Seek(0, io.SeekCurrent)
+		index = append(index, IndexEntry{OriginalOffset: original, CompressedOffset: uint64(headerSize + position)})
+
+		header, err := readBlockHeader(section)
+		if err == io.EOF {
+			return index, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("block %d: %w", len(index)-1, err)
+		}
+		mode, err := readBlockMode(section, flags)
+		if err != nil {
+			return nil, fmt.Errorf("block %d: %w", len(index)-1, err)
+		}
+		if mode == BlockHuffman {
+			_, err = ReadCodeLengths(section)
+			if err != nil {
+				return nil, fmt.Errorf("block %d: %w", len(index)-1, unexpectedEOF(err))
+			}
+		}
+
+		position, _ = section.Seek(int64(header.compressedLen), io.SeekCurrent)
+		if position > section.Size() {
+			return nil, fmt.Errorf("block %d: %w", len(index)-1, io.ErrUnexpectedEOF)
+		}
+		original += uint64(header.originalLen)
+	}
+}
+
+// OpenSeekable opens the compressed file at path for random access. The
+// reader has to be closed with the returned file.
+func OpenSeekable(path string) (*SeekableReader, *os.File, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	info, err := file.Stat()
+	if err == nil {
+		var reader *SeekableReader
+		reader, err = NewSeekableReader(file, info.Size())
+		if err == nil {
+			return reader, file, nil
+		}
+	}
+	file.Close()
+	return nil, nil, err
+}
+
+// Size returns the size of the original data
+func (r *SeekableReader) Size() int64 {
+	return int64(r.index[len(r.index)-1].OriginalOffset)
+}
+
+// Blocks returns the number of blocks in the stream
+func (r *SeekableReader) Blocks() int {
+	return len(r.index) - 1
+}
+
+// ReadAt reads len(p) bytes of original data starting at off
+func (r *SeekableReader) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errors.New("SeekableReader.ReadAt: negative offset")
+	}
+
+	n := 0
+	for n < len(p) {
+		position := off + int64(n)
+		if position >= r.Size() {
+			return n, io.EOF
+		}
+		// The last block starting at or before position holds it
+		block := sort.Search(len(r.index), func(i int) bool {
+			return int64(r.index[i].OriginalOffset) > position
+		}) - 1
+		data, err := r.block(block)
+		if err != nil {
+			return n, err
+		}
+		n += copy(p[n:], data[position-int64(r.index[block].OriginalOffset):])
+	}
+	return n, nil
+}
+
+// Read reads original data from the current offset
+func (r *SeekableReader) Read(p []byte) (int, error) {
+	n, err := r.ReadAt(p, r.offset)
+	r.offset += int64(n)
+	if err == io.EOF && n > 0 {
+		err = nil
+	}
+	return n, err
+}
+
+// Seek sets the offset of the next Read in the original data
+func (r *SeekableReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += r.offset
+	case io.SeekEnd:
+		offset += r.Size()
+	default:
+		return 0, errors.New("SeekableReader.Seek: invalid whence")
+	}
+	if offset < 0 {
+		return 0, errors.New("SeekableReader.Seek: negative position")
+	}
+	r.offset = offset
+	return offset, nil
+}
+
+// block returns the decoded data of block i
+func (r *SeekableReader) block(i int) ([]byte, error) {
+	r.mu.Lock()
+	if r.cached == i {
+		data := r.data
+		r.mu.Unlock()
+		return data, nil
+	}
+	r.mu.Unlock()
+
+	data, err := r.decodeBlock(i)
+	if err != nil {
+		return nil, fmt.Errorf("block %d: %w", i, err)
+	}
+
+	r.mu.Lock()
+	r.cached, r.data = i, data
+	r.mu.Unlock()
+	return data, nil
+}
+
+// decodeBlock decodes block i, checking it fills exactly the space the
+// index gives it
+func (r *SeekableReader) decodeBlock(i int) ([]byte, error) {
+	start, end := r.index[i], r.index[i+1]
+	section := io.NewSectionReader(r.reader, int64(start.CompressedOffset), int64(end.CompressedOffset-start.CompressedOffset))
+	buffered := bufio.NewReader(section)
+
+	data, err := readStreamBlock(buffered, r.flags)
+	if err == io.EOF {
+		return nil, fmt.Errorf("invalid index: end-of-stream marker instead of a block")
+	}
+	if err != nil {
+		return nil, err
+	}
+	if expected := end.OriginalOffset - start.OriginalOffset; uint64(len(data)) != expected {
+		return nil, fmt.Errorf("invalid index: block holds %d bytes, expected %d", len(data), expected)
+	}
+	if _, err = buffered.ReadByte(); err != io.EOF {
+		return nil, fmt.Errorf("invalid index: block is shorter than its entry")
+	}
+	return data, nil
+}
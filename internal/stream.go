@@ -0,0 +1,801 @@
+package internal
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Framed stream layout:
+//
+//	[HB:2][Version:1][Flags:1][Level:1][Block][Block]...[EndOfStream][Trailer]
+//
+//	Block:       [OriginalLen:4][CompressedLen:4][PaddingBits:1][CodeLengths][Payload]
+//	EndOfStream: [OriginalLen:4] = 0
+//
+// With FlagAdaptive, blocks have no CodeLengths (see WriteAdaptiveBlock).
+// With FlagLZ77, CodeLengths and Payload are replaced by the output of
+// EncodeLZ77. With FlagBlockModes, every block picks its own coding with a
+// Mode byte after PaddingBits (see WriteSmallestBlock).
+//
+// Level is the compression level the stream was written with, 0 when the
+// coding was chosen through flags. Version 1 streams have no Level byte.
+//
+// Blocks use canonical codes, so only the code lengths are stored (see
+// WriteCodeLengths). Every block carries its own table, so a block can be
+// encoded as soon as it is full. The input is read once and memory stays
+// bounded by the block size, which is what makes stdin, pipes and sockets
+// usable as input.
+// The trailer holds the checksums selected by the flags (see WriteTrailer).
+// With FlagIndex a block index follows the trailer (see WriteIndex).
+const StreamMagic = "HB"
+
+const (
+	StreamVersion    = 2
+	StreamHeaderSize = len(StreamMagic) + 3 // magic, version, flags and level
+
+	streamVersion1 = 1 // no Level byte
+)
+
+const (
+	DefaultBlockSize = 1 << 20 // 1 MiB
+	MaxBlockSize     = 1 << 26 // 64 MiB, bounds memory used by a reader
+)
+
+var errStreamClosed = errors.New("stream writer is closed")
+
+// WriteBlock encodes data as a single self-contained block
+func WriteBlock(writer io.Writer, data []byte) error {
+	err := checkBlockSize(data)
+	if err != nil {
+		return err
+	}
+
+	// Build canonical codes for this block only, capped so lengths
+	// always fit in a nibble
+	freqTable := CountFrequencies(data)
+	lengths, err := CodeLengthsWithLimit(freqTable, DefaultMaxCodeLength)
+	if err != nil {
+		return fmt.Errorf("failed to compute code lengths: %w", err)
+	}
+	codeTable, err := CodeTableFromLengths(lengths)
+	if err != nil {
+		return fmt.Errorf("failed to generate canonical codes: %w", err)
+	}
+
+	// Encode payload first, its length goes into the block header
+	var payload bytes.Buffer
+	bitBuffer := NewBitBuffer(&payload)
+	for _, char := range data {
+		code := codeTable[char]
+		err = bitBuffer.WriteBits(code.bits, code.length)
+		if err != nil {
+			return fmt.Errorf("failed to encode block: %w", err)
+		}
+	}
+	paddingBits, err := bitBuffer.Close()
+	if err != nil {
+		return fmt.Errorf("failed to close bit buffer: %w", err)
+	}
+
+	// Block header
+	err = writeBlockHeader(writer, blockHeader{
+		originalLen:   uint32(len(data)),
+		compressedLen: uint32(payload.Len()),
+		paddingBits:   uint8(paddingBits),
+	})
+	if err != nil {
+		return err
+	}
+	err = WriteCodeLengths(writer, lengths)
+	if err != nil {
+		return err
+	}
+
+	// Block payload
+	_, err = writer.Write(payload.Bytes())
+	return err
+}
+
+// WriteAdaptiveBlock encodes data as a single block coded with a fresh
+// AdaptiveTree. The layout is that of WriteBlock without the code lengths.
+func WriteAdaptiveBlock(writer io.Writer, data []byte) error {
+	err := checkBlockSize(data)
+	if err != nil {
+		return err
+	}
+
+	var payload bytes.Buffer
+	paddingBits, err := EncodeAdaptive(&payload, data)
+	if err != nil {
+		return fmt.Errorf("failed to encode block: %w", err)
+	}
+
+	err = writeBlockHeader(writer, blockHeader{
+		originalLen:   uint32(len(data)),
+		compressedLen: uint32(payload.Len()),
+		paddingBits:   uint8(paddingBits),
+	})
+	if err != nil {
+		return err
+	}
+	_, err = writer.Write(payload.Bytes())
+	return err
+}
+
+// WriteLZ77Block encodes data as a single block with EncodeLZ77
+func WriteLZ77Block(writer io.Writer, data []byte, params LZParams) error {
+	err := checkBlockSize(data)
+	if err != nil {
+		return err
+	}
+
+	var payload bytes.Buffer
+	paddingBits, err := EncodeLZ77(&payload, data, params)
+	if err != nil {
+		return fmt.Errorf("failed to encode block: %w", err)
+	}
+
+	err = writeBlockHeader(writer, blockHeader{
+		originalLen:   uint32(len(data)),
+		compressedLen: uint32(payload.Len()),
+		paddingBits:   uint8(paddingBits),
+	})
+	if err != nil {
+		return err
+	}
+	_, err = writer.Write(payload.Bytes())
+	return err
+}
+
+func checkBlockSize(data []byte) error {
+	if len(data) == 0 {
+		return fmt.Errorf("cannot write an empty block")
+	}
+	if len(data) > MaxBlockSize {
+		return fmt.Errorf("block of %d bytes exceeds max block size %d", len(data), MaxBlockSize)
+	}
+	return nil
+}
+
+// WriteEndOfStream writes the marker that terminates a framed stream
+func WriteEndOfStream(writer io.Writer) error {
+	return binary.Write(writer, binary.BigEndian, uint32(0))
+}
+
+// blockHeader holds the fields every block starts with
+type blockHeader struct {
+	originalLen   uint32
+	compressedLen uint32
+	paddingBits   uint8
+}
+
+func writeBlockHeader(writer io.Writer, header blockHeader) error {
+	buf := binary.BigEndian.AppendUint32(nil, header.originalLen)
+	buf = binary.BigEndian.AppendUint32(buf, header.compressedLen)
+	buf = append(buf, header.paddingBits)
+	_, err := writer.Write(buf)
+	return err
+}
+
+// readBlockHeader reads the fields every block starts with. It returns
+// io.EOF when it reads the end-of-stream marker instead.
+func readBlockHeader(reader io.Reader) (blockHeader, error) {
+	header := blockHeader{}
+	err := binary.Read(reader, binary.BigEndian, &header.originalLen)
+	if err == io.EOF {
+		// Stream ended without its end marker
+		return header, io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return header, err
+	}
+
+	if header.originalLen == 0 {
+		return header, io.EOF
+	}
+	if header.originalLen > MaxBlockSize {
+		return header, fmt.Errorf("invalid block: length %d exceeds max block size %d", header.originalLen, MaxBlockSize)
+	}
+
+	err = binary.Read(reader, binary.BigEndian, &header.compressedLen)
+	if err != nil {
+		return header, unexpectedEOF(err)
+	}
+
+	header.paddingBits, err = readByte(reader)
+	if err != nil {
+		return header, unexpectedEOF(err)
+	}
+	if header.paddingBits > 7 {
+		return header, fmt.Errorf("invalid block: padding bits %d", header.paddingBits)
+	}
+
+	return header, nil
+}
+
+// readPayload reads the compressed bytes of a block. The buffer grows with
+// the data actually read, a corrupt length can't make it allocate 4 GiB.
+func readPayload(reader io.Reader, header blockHeader) ([]byte, error) {
+	var payload bytes.Buffer
+	_, err := io.CopyN(&payload, reader, int64(header.compressedLen))
+	if err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	return payload.Bytes(), nil
+}
+
+// checkExpansion rejects a block claiming more bytes than its payload can
+// code when every payload bit yields at most perBit bytes
+func checkExpansion(header blockHeader, payload []byte, perBit int) error {
+	if uint64(header.originalLen) > uint64(len(payload))*8*uint64(perBit) {
+		return fmt.Errorf("corrupted block: %d bytes can't be coded in %d", header.originalLen, len(payload))
+	}
+	return nil
+}
+
+// ReadBlock reads and decodes the next block. It returns io.EOF once the
+// end-of-stream marker has been read.
+func ReadBlock(reader io.Reader) ([]byte, error) {
+	header, err := readBlockHeader(reader)
+	if err != nil {
+		return nil, err
+	}
+	return readHuffmanBody(reader, header)
+}
+
+// readHuffmanBody reads the code lengths and payload of a WriteBlock block
+func readHuffmanBody(reader io.Reader, header blockHeader) ([]byte, error) {
+	originalLen := header.originalLen
+
+	lengths, err := ReadCodeLengths(reader)
+	if err != nil {
+		return nil, unexpectedEOF(err)
+	}
+
+	payload, err := readPayload(reader, header)
+	if err != nil {
+		return nil, err
+	}
+	err = checkExpansion(header, payload, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	// Rebuild the codes from their lengths, no frequencies needed
+	codeTable, err := CodeTableFromLengths(lengths)
+	if err != nil {
+		return nil, fmt.Errorf("invalid block: %w", err)
+	}
+	decoder, err := NewDecoderFromCodes(codeTable)
+	if err != nil {
+		return nil, fmt.Errorf("invalid block: %w", err)
+	}
+
+	bitReader := NewBitReader(bytes.NewReader(payload))
+	data := make([]byte, originalLen)
+	for i := range data {
+		data[i], err = decoder.DecodeByte(bitReader)
+		if err == io.EOF {
+			return nil, fmt.Errorf("corrupted block: payload ended after %d of %d bytes", i, originalLen)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return data, nil
+}
+
+// ReadAdaptiveBlock reads and decodes a block written by WriteAdaptiveBlock.
+// It returns io.EOF once the end-of-stream marker has been read.
+func ReadAdaptiveBlock(reader io.Reader) ([]byte, error) {
+	header, err := readBlockHeader(reader)
+	if err != nil {
+		return nil, err
+	}
+	return readAdaptiveBody(reader, header)
+}
+
+func readAdaptiveBody(reader io.Reader, header blockHeader) ([]byte, error) {
+	payload, err := readPayload(reader, header)
+	if err != nil {
+		return nil, err
+	}
+	err = checkExpansion(header, payload, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := DecodeAdaptive(bytes.NewReader(payload), int(header.originalLen))
+	if err != nil {
+		return nil, fmt.Errorf("corrupted block: %w", err)
+	}
+	return data, nil
+}
+
+// ReadLZ77Block reads and decodes a block written by WriteLZ77Block. It
+// returns io.EOF once the end-of-stream marker has been read.
+func ReadLZ77Block(reader io.Reader) ([]byte, error) {
+	header, err := readBlockHeader(reader)
+	if err != nil {
+		return nil, err
+	}
+	return readLZ77Body(reader, header)
+}
+
+func readLZ77Body(reader io.Reader, header blockHeader) ([]byte, error) {
+	payload, err := readPayload(reader, header)
+	if err != nil {
+		return nil, err
+	}
+	err = checkExpansion(header, payload, lzMaxMatch)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := DecodeLZ77(bytes.NewReader(payload), int(header.originalLen))
+	if err != nil {
+		return nil, fmt.Errorf("corrupted block: %w", err)
+	}
+	return data, nil
+}
+
+// checkStreamFlags rejects unknown flags and combinations of coding modes
+func checkStreamFlags(flags uint8) error {
+	err := checkFlags(flags, SupportedFlags)
+	if err != nil {
+		return err
+	}
+	modes := 0
+	for _, flag := range []uint8{FlagAdaptive, FlagLZ77, FlagBlockModes} {
+		if flags&flag != 0 {
+			modes++
+		}
+	}
+	if modes > 1 {
+		return fmt.Errorf("adaptive, LZ77 and per-block coding can't be combined")
+	}
+	return nil
+}
+
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// StreamWriter is an io.WriteCloser that splits its input into blocks and
+// writes them as a framed stream
+type StreamWriter struct {
+	writer    *bufio.Writer
+	body      *countingWriter // writer, also feeding the compressed data checksum
+	block     []byte          // pending input for the current block
+	blockSize int
+	flags     uint8
+	level     int
+	params    LZParams
+	sums      *checksums
+	started   bool // stream header written
+	closed    bool
+	err       error        // first failed block when encoding concurrently
+	original  uint64       // input bytes written out as blocks
+	index     []IndexEntry // with FlagIndex, where every block starts
+
+	workers int               // blocks encoded at once, see SetConcurrency
+	pending []chan codedBlock // blocks being encoded, oldest first
+	spare   [][]byte          // block buffers free for reuse
+}
+
+// NewStreamWriter returns a StreamWriter cutting blocks of blockSize bytes,
+// coding them at level 1 with DefaultFlags. A blockSize outside
+// (0, MaxBlockSize] falls back to DefaultBlockSize.
+func NewStreamWriter(writer io.Writer, blockSize int) (*StreamWriter, error) {
+	return NewStreamWriterLevel(writer, blockSize, MinLevel, DefaultFlags)
+}
+
+// NewStreamWriterFlags is like NewStreamWriter with explicit feature flags,
+// including the coding mode flags
+func NewStreamWriterFlags(writer io.Writer, blockSize int, flags uint8) (*StreamWriter, error) {
+	return NewStreamWriterLevel(writer, blockSize, 0, flags)
+}
+
+// NewStreamWriterLevel returns a StreamWriter coding blocks with the
+// pipeline of level (MinLevel to MaxLevel). flags select the checksums, the
+// coding mode comes from the level. Level 0 leaves the coding mode to flags.
+func NewStreamWriterLevel(writer io.Writer, blockSize int, level int, flags uint8) (*StreamWriter, error) {
+	params := DefaultLZParams
+	if level != 0 {
+		config, err := getLevelConfig(level)
+		if err != nil {
+			return nil, err
+		}
+		if flags&codingModeFlags != 0 {
+			return nil, fmt.Errorf("coding mode flags can't be combined with a compression level")
+		}
+		flags |= config.flags
+		params = config.params
+	}
+
+	err := checkStreamFlags(flags)
+	if err != nil {
+		return nil, err
+	}
+	if blockSize <= 0 || blockSize > MaxBlockSize {
+		blockSize = DefaultBlockSize
+	}
+
+	sums := newChecksums(flags)
+	buffered := bufio.NewWriter(writer)
+	return &StreamWriter{
+		writer:    buffered,
+		body:      &countingWriter{writer: io.MultiWriter(buffered, sums.compressedWriter())},
+		block:     make([]byte, 0, blockSize),
+		blockSize: blockSize,
+		flags:     flags,
+		level:     level,
+		params:    params,
+		sums:      sums,
+	}, nil
+}
+
+func (sw *StreamWriter) writeStreamHeader() error {
+	if sw.started {
+		return nil
+	}
+	sw.started = true
+	_, err := sw.writer.Write([]byte{StreamMagic[0], StreamMagic[1], StreamVersion, sw.flags, uint8(sw.level)})
+	return err
+}
+
+// Write buffers p and emits a block every time blockSize bytes are pending
+func (sw *StreamWriter) Write(p []byte) (int, error) {
+	if sw.closed {
+		return 0, errStreamClosed
+	}
+	if sw.err != nil {
+		return 0, sw.err
+	}
+
+	written := 0
+	for len(p) > 0 {
+		n := copy(sw.block[len(sw.block):sw.blockSize], p)
+		sw.block = sw.block[:len(sw.block)+n]
+		p = p[n:]
+		written += n
+
+		if len(sw.block) == sw.blockSize {
+			err := sw.writeBlock()
+			if err != nil {
+				return written, err
+			}
+		}
+	}
+	return written, nil
+}
+
+func (sw *StreamWriter) writeBlock() error {
+	err := sw.writeStreamHeader()
+	if err != nil {
+		return err
+	}
+	if len(sw.block) == 0 {
+		return nil
+	}
+
+	sw.sums.addContent(sw.block)
+	if sw.workers > 1 {
+		return sw.encodeAsync()
+	}
+	sw.addIndexEntry(len(sw.block))
+	err = writeStreamBlock(sw.body, sw.block, sw.flags, sw.params)
+	if err != nil {
+		return err
+	}
+	sw.block = sw.block[:0]
+	return nil
+}
+
+// Flush encodes any pending input as a (possibly short) block and flushes
+// it to the underlying writer
+func (sw *StreamWriter) Flush() error {
+	if sw.closed {
+		return errStreamClosed
+	}
+	if sw.err != nil {
+		return sw.err
+	}
+	err := sw.writeBlock()
+	if err == nil {
+		err = sw.drain(0)
+	}
+	if err != nil {
+		return err
+	}
+	return sw.writer.Flush()
+}
+
+// Close flushes pending input and terminates the stream. It does not close
+// the underlying writer.
+func (sw *StreamWriter) Close() error {
+	if sw.closed {
+		return nil
+	}
+	if sw.err != nil {
+		return sw.err
+	}
+
+	err := sw.writeBlock()
+	if err == nil {
+		err = sw.drain(0)
+	}
+	if err != nil {
+		return err
+	}
+	sw.closed = true
+
+	sw.addIndexEntry(0)
+	err = WriteEndOfStream(sw.body)
+	if err != nil {
+		return err
+	}
+	err = WriteTrailer(sw.writer, sw.sums.trailer(), sw.flags)
+	if err != nil {
+		return err
+	}
+	if sw.flags&FlagIndex != 0 {
+		err = WriteIndex(sw.writer, sw.index)
+		if err != nil {
+			return err
+		}
+	}
+	return sw.writer.Flush()
+}
+
+// addIndexEntry records where the next block, of n original bytes, starts.
+// The end-of-stream marker is recorded with n = 0.
+func (sw *StreamWriter) addIndexEntry(n int) {
+	if sw.flags&FlagIndex != 0 {
+		offset := uint64(StreamHeaderSize) + sw.body.count
+		sw.index = append(sw.index, IndexEntry{OriginalOffset: sw.original, CompressedOffset: offset})
+	}
+	sw.original += uint64(n)
+}
+
+// StreamReader is an io.Reader that decodes a framed stream block by block
+type StreamReader struct {
+	buffered *bufio.Reader
+	reader   io.Reader // buffered, also feeding the compressed data checksum
+	flags    uint8
+	level    int
+	sums     *checksums
+	block    []byte // decoded bytes not yet returned
+	done     bool   // end-of-stream marker and trailer read
+	err      error  // first decoding or checksum error
+	blocks   int    // blocks decoded so far
+
+	limits  DecodeLimits    // checked against every block header, see admit
+	input   *countingReader // compressed bytes read, stream header included
+	claimed uint64          // original bytes of the blocks admitted so far
+
+	workers int               // blocks decoded at once, see SetConcurrency
+	pending []chan codedBlock // blocks being decoded, oldest first
+	ended   bool              // no more blocks to read ahead
+}
+
+// NewStreamReader verifies the stream header and returns a reader for the
+// blocks that follow. It may read more data than necessary from reader.
+func NewStreamReader(reader io.Reader) (*StreamReader, error) {
+	buffered := bufio.NewReader(reader)
+	version, flags, level, err := readStreamHeader(buffered)
+	if err != nil {
+		return nil, err
+	}
+
+	sums := newChecksums(flags)
+	input := &countingReader{reader: buffered, count: uint64(streamHeaderSize(version))}
+	return &StreamReader{
+		buffered: buffered,
+		reader:   io.TeeReader(input, sums.compressedWriter()),
+		flags:    flags,
+		level:    int(level),
+		sums:     sums,
+		input:    input,
+	}, nil
+}
+
+// admit counts the block of header towards the limits before it is
+// decoded, so a block claiming too much output fails without being
+// allocated. Its payload counts as read for the ratio.
+func (sr *StreamReader) admit(header blockHeader) error {
+	sr.claimed += uint64(header.originalLen)
+	return sr.limits.check(sr.claimed, sr.input.count+uint64(header.compressedLen))
+}
+
+// readStreamHeader reads and checks the stream header. The fields read
+// before an error are returned with it.
+func readStreamHeader(reader io.Reader) (version, flags, level uint8, err error) {
+	header := make([]byte, StreamHeaderSize-1)
+	_, err = io.ReadFull(reader, header)
+	if err != nil {
+		return 0, 0, 0, unexpectedEOF(err)
+	}
+	if string(header[:len(StreamMagic)]) != StreamMagic {
+		return 0, 0, 0, fmt.Errorf("invalid stream format: bad magic number")
+	}
+
+	version, flags = header[2], header[3]
+	switch version {
+	case streamVersion1:
+	case StreamVersion:
+		level, err = readByte(reader)
+		if err != nil {
+			return version, flags, 0, unexpectedEOF(err)
+		}
+		if level != 0 && (level < MinLevel || level > MaxLevel) {
+			reason := fmt.Sprintf("compression level %d out of range %d-%d", level, MinLevel, MaxLevel)
+			return version, flags, 0, &FormatError{Offset: int64(StreamHeaderSize - 1), Reason: reason}
+		}
+	default:
+		return version, flags, 0, &UnsupportedVersionError{Format: "stream", Version: version}
+	}
+	return version, flags, level, checkStreamFlags(flags)
+}
+
+// streamHeaderSize is the size of the stream header of version
+func streamHeaderSize(version uint8) int {
+	if version == streamVersion1 {
+		return StreamHeaderSize - 1
+	}
+	return StreamHeaderSize
+}
+
+// Flags returns the feature flags of the stream
+func (sr *StreamReader) Flags() uint8 {
+	return sr.flags
+}
+
+// Level returns the compression level recorded in the stream header, 0 when
+// none was recorded
+func (sr *StreamReader) Level() int {
+	return sr.level
+}
+
+// Read returns decoded bytes, reading the next block when needed. The
+// checksums are verified once the end of the stream is reached, a mismatch
+// is reported as a *ChecksumError instead of io.EOF.
+func (sr *StreamReader) Read(p []byte) (int, error) {
+	for len(sr.block) == 0 {
+		if sr.err != nil {
+			return 0, sr.err
+		}
+		if sr.done {
+			return 0, io.EOF
+		}
+
+		block, err := sr.nextBlock()
+		if err == io.EOF {
+			sr.done = true
+			sr.err = sr.verifyTrailer()
+			continue
+		}
+		if err != nil {
+			sr.err = err
+			continue
+		}
+		sr.sums.addContent(block)
+		sr.block = block
+		sr.blocks++
+	}
+
+	n := copy(p, sr.block)
+	sr.block = sr.block[n:]
+	return n, nil
+}
+
+func (sr *StreamReader) verifyTrailer() error {
+	if TrailerSize(sr.flags) != 0 {
+		trailer, err := ReadTrailer(sr.buffered, sr.flags)
+		if err != nil {
+			return err
+		}
+		err = sr.sums.verify(trailer)
+		if err != nil {
+			return err
+		}
+	}
+	// Sequential reads don't need the index, it is only checked
+	if sr.flags&FlagIndex != 0 {
+		_, err := skipIndex(sr.buffered, sr.blocks)
+		return err
+	}
+	return nil
+}
+
+// CompressStream reads reader until EOF and writes it to writer as a framed
+// stream with blocks of blockSize bytes
+func CompressStream(reader io.Reader, writer io.Writer, blockSize int) error {
+	return CompressStreamFlags(reader, writer, blockSize, DefaultFlags)
+}
+
+// CompressStreamFlags is like CompressStream with explicit feature flags
+func CompressStreamFlags(reader io.Reader, writer io.Writer, blockSize int, flags uint8) error {
+	return CompressStreamLevel(reader, writer, blockSize, 0, flags)
+}
+
+// CompressStreamLevel is like CompressStream with a compression level, see
+// NewStreamWriterLevel
+func CompressStreamLevel(reader io.Reader, writer io.Writer, blockSize int, level int, flags uint8) error {
+	return CompressStreamWorkers(reader, writer, blockSize, level, flags, 1)
+}
+
+// CompressStreamWorkers is like CompressStreamLevel, encoding up to workers
+// blocks at once (see StreamWriter.SetConcurrency). The output is the same
+// for any number of workers.
+func CompressStreamWorkers(reader io.Reader, writer io.Writer, blockSize int, level int, flags uint8, workers int) error {
+	streamWriter, err := NewStreamWriterLevel(writer, blockSize, level, flags)
+	if err != nil {
+		return err
+	}
+	streamWriter.SetConcurrency(workers)
+
+	_, err = io.Copy(streamWriter, reader)
+	if err != nil {
+		return fmt.Errorf("failed to compress stream: %w", err)
+	}
+
+	err = streamWriter.Close()
+	if err != nil {
+		return fmt.Errorf("failed to finish stream: %w", err)
+	}
+	return nil
+}
+
+// DecompressStream decodes a framed stream from reader into writer
+func DecompressStream(reader io.Reader, writer io.Writer) error {
+	streamReader, err := NewStreamReader(reader)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(writer, streamReader)
+	if err != nil {
+		return fmt.Errorf("failed to decompress stream: %w", err)
+	}
+	return nil
+}
+
+// CompressFileBlocks compresses inputPath into outputPath using the framed
+// stream format. Unlike CompressFile it reads the input only once. level and
+// flags are used as in NewStreamWriterLevel.
+func CompressFileBlocks(inputPath, outputPath string, blockSize int, level int, flags uint8) error {
+	return CompressFileWorkers(inputPath, outputPath, blockSize, level, flags, 1)
+}
+
+// CompressFileWorkers is like CompressFileBlocks, encoding up to workers
+// blocks at once. The output is the same for any number of workers.
+func CompressFileWorkers(inputPath, outputPath string, blockSize int, level int, flags uint8, workers int) error {
+	inputFile, err := os.Open(inputPath)
+	if err != nil {
+		return fmt.Errorf("failed to open input file: %s", err)
+	}
+	defer inputFile.Close()
+
+	outputFile, err := CreateAtomic(outputPath, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to create the output file: %w", err)
+	}
+	defer outputFile.Abort()
+
+	err = CompressStreamWorkers(inputFile, outputFile, blockSize, level, flags, workers)
+	if err != nil {
+		return err
+	}
+
+	return outputFile.Commit()
+}
@@ -0,0 +1,177 @@
+package internal
+
+import (
+	"fmt"
+	"io"
+)
+
+// Table-driven decoding: instead of following one tree edge per bit, the
+// decoder peeks primaryTableBits bits and looks the symbol up directly.
+// Codes longer than that go through a second-level table chosen by their
+// first primaryTableBits bits.
+
+const (
+	primaryTableBits = 10
+	// MaxTableCodeLength is the longest code a TableDecoder accepts, longer
+	// codes have to be decoded by walking the tree
+	MaxTableCodeLength = 24
+)
+
+type decodeEntry struct {
+	symbol   int
+	length   int // code length in bits, 0 marks a bit pattern with no code
+	subTable int // index+1 into subTables, 0 when the entry is final
+}
+
+type subTable struct {
+	bits    int // bits indexed after the primary bits
+	entries []decodeEntry
+}
+
+// TableDecoder decodes canonical or tree generated codes using lookup tables
+type TableDecoder struct {
+	primary   []decodeEntry
+	subTables []subTable
+}
+
+// NewTableDecoder builds lookup tables for codes indexed by symbol. Symbols
+// with an empty code are skipped.
+func NewTableDecoder(codes []HuffmanCode) (*TableDecoder, error) {
+	td := &TableDecoder{primary: make([]decodeEntry, 1<<primaryTableBits)}
+
+	// Longest code below each primary prefix decides its sub table size
+	longest := make(map[uint64]int)
+	for symbol, code := range codes {
+		if code.length > MaxTableCodeLength {
+			return nil, fmt.Errorf("code for symbol %d has %d bits, table decoding supports at most %d", symbol, code.length, MaxTableCodeLength)
+		}
+		if code.length > primaryTableBits {
+			prefix := reverseCode(code.bits, code.length) >> (code.length - primaryTableBits)
+			longest[prefix] = max(longest[prefix], code.length)
+		}
+	}
+
+	for symbol, code := range codes {
+		if code.length == 0 {
+			continue
+		}
+		msbFirst := reverseCode(code.bits, code.length)
+
+		if code.length <= primaryTableBits {
+			// Every index starting with this code decodes to symbol
+			fill := primaryTableBits - code.length
+			start := msbFirst << fill
+			for i := uint64(0); i < 1<<fill; i++ {
+				td.primary[start+i] = decodeEntry{symbol: symbol, length: code.length}
+			}
+			continue
+		}
+
+		prefix := msbFirst >> (code.length - primaryTableBits)
+		entry := &td.primary[prefix]
+		if entry.subTable == 0 {
+			bits := longest[prefix] - primaryTableBits
+			td.subTables = append(td.subTables, subTable{
+				bits:    bits,
+				entries: make([]decodeEntry, 1<<bits),
+			})
+			entry.subTable = len(td.subTables)
+		}
+
+		sub := td.subTables[entry.subTable-1]
+		suffixBits := code.length - primaryTableBits
+		suffix := msbFirst & (1<<suffixBits - 1)
+		fill := sub.bits - suffixBits
+		start := suffix << fill
+		for i := uint64(0); i < 1<<fill; i++ {
+			sub.entries[start+i] = decodeEntry{symbol: symbol, length: code.length}
+		}
+	}
+
+	return td, nil
+}
+
+// NewTableDecoderFromCodeTable builds a TableDecoder for a byte code table
+func NewTableDecoderFromCodeTable(codeTable CodeTable) (*TableDecoder, error) {
+	codes := make([]HuffmanCode, 256)
+	for char, code := range codeTable {
+		codes[char] = code
+	}
+	return NewTableDecoder(codes)
+}
+
+// Decode reads one symbol. It returns io.EOF when the stream ends before a
+// complete code was read.
+func (td *TableDecoder) Decode(bitReader *BitReader) (int, error) {
+	bits, available := bitReader.PeekBits(primaryTableBits)
+	entry := td.primary[bits]
+
+	if entry.subTable != 0 {
+		sub := td.subTables[entry.subTable-1]
+		totalBits := primaryTableBits + sub.bits
+		bits, available = bitReader.PeekBits(totalBits)
+		entry = sub.entries[bits&(1<<sub.bits-1)]
+	}
+
+	if available == 0 {
+		if err := bitReader.Err(); err != nil {
+			return 0, err
+		}
+		return 0, io.EOF
+	}
+	if entry.length == 0 {
+		return 0, fmt.Errorf("corrupted data: invalid code")
+	}
+	if entry.length > available {
+		if err := bitReader.Err(); err != nil {
+			return 0, err
+		}
+		return 0, io.EOF
+	}
+
+	bitReader.SkipBits(entry.length)
+	return entry.symbol, nil
+}
+
+// Decoder decodes bytes with a TableDecoder when the codes are short
+// enough, and falls back to walking the tree otherwise
+type Decoder struct {
+	root  *HuffmanNode
+	table *TableDecoder
+}
+
+// NewDecoder returns a Decoder for the tree rooted at root
+func NewDecoder(root *HuffmanNode) *Decoder {
+	decoder := &Decoder{root: root}
+	if TreeDepth(root) <= MaxTableCodeLength {
+		table, err := NewTableDecoderFromCodeTable(GenerateCodes(root))
+		if err == nil {
+			decoder.table = table
+		}
+	}
+	return decoder
+}
+
+// NewDecoderFromCodes returns a Decoder for a code table, e.g. one rebuilt
+// from code lengths. A tree is only built when the table can't be used.
+func NewDecoderFromCodes(codeTable CodeTable) (*Decoder, error) {
+	table, err := NewTableDecoderFromCodeTable(codeTable)
+	if err == nil {
+		return &Decoder{table: table}, nil
+	}
+
+	root, err := BuildTreeFromCodes(codeTable)
+	if err != nil {
+		return nil, err
+	}
+	return &Decoder{root: root}, nil
+}
+
+// DecodeByte reads one byte, io.EOF means the stream ran out of bits
+func (d *Decoder) DecodeByte(bitReader *BitReader) (byte, error) {
+	if d.table == nil {
+		return DecodeSymbol(bitReader, d.root)
+	}
+	symbol, err := d.table.Decode(bitReader)
+	return byte(symbol), err
+}
@@ -11,6 +11,8 @@ type HuffmanNode struct {
 	left      *HuffmanNode
 	right     *HuffmanNode
 	isLeaf    bool
+	parent    *HuffmanNode // only set in adaptive trees
+	order     int          // position in an adaptive tree's node list
 }
 
 func (hf *HuffmanNode) IsLeaf() bool {
@@ -129,30 +131,90 @@ func BuildHuffmanTree(freqTable FrequencyTable) (*HuffmanNode, error) {
 	return root, nil
 }
 
+// TreeDepth returns the length of the longest root-to-leaf path, which is
+// the longest code GenerateCodes will produce for this tree
+func TreeDepth(node *HuffmanNode) int {
+	if node == nil || node.isLeaf {
+		return 0
+	}
+	return 1 + max(TreeDepth(node.left), TreeDepth(node.right))
+}
+
+// buildCodes builds the tree and codes the .hf format stores freqTable with.
+// The decoder rebuilds this exact tree from the frequencies, so codes can't
+// be shortened here. Trees too deep for HuffmanCode are refused.
+func buildCodes(freqTable FrequencyTable) (*HuffmanNode, CodeTable, error) {
+	root, err := BuildHuffmanTree(freqTable)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to build huffman tree: %w", err)
+	}
+	if depth := TreeDepth(root); depth > MaxCodeLength {
+		return nil, nil, fmt.Errorf("huffman tree depth %d exceeds max code length %d", depth, MaxCodeLength)
+	}
+	return root, GenerateCodes(root), nil
+}
+
+// BuildTreeFromCodes rebuilds a decoding tree from a code table, e.g. one
+// produced by CodeTableFromLengths. Real frequencies are unknown here, so
+// every leaf gets frequency 1 and internal nodes count the leaves below them.
+func BuildTreeFromCodes(codeTable CodeTable) (*HuffmanNode, error) {
+	if len(codeTable) == 0 {
+		return nil, fmt.Errorf("code table has no entries to process")
+	}
+
+	root := &HuffmanNode{}
+	for char, code := range codeTable {
+		if code.length == 0 {
+			return nil, fmt.Errorf("empty code for character %d", char)
+		}
+
+		node := root
+		for i := 0; i < code.length; i++ {
+			if node.isLeaf {
+				return nil, fmt.Errorf("code for character %d is not prefix-free", char)
+			}
+			node.frequency++
+
+			// Bits are stored LSB-first, bit i is the i-th step from the root
+			next := &node.left
+			if (code.bits>>i)&1 == 1 {
+				next = &node.right
+			}
+			if *next == nil {
+				*next = &HuffmanNode{}
+			}
+			node = *next
+		}
+
+		if node.isLeaf || node.left != nil || node.right != nil {
+			return nil, fmt.Errorf("code for character %d is not prefix-free", char)
+		}
+		node.char = char
+		node.frequency = 1
+		node.isLeaf = true
+	}
+	return root, nil
+}
+
+// PrintTree prints node and its subtree, one node per line below prefix.
+// Left children (bit 0) come first. Call it with PrintTree(root, "", false).
 func PrintTree(node *HuffmanNode, prefix string, isLeft bool) {
 	if node == nil {
 		return
 	}
-	var newPrefix string
+	connector, newPrefix := "└── ", prefix+"    "
 	if isLeft {
-		fmt.Println(prefix)
-		fmt.Println("├──")
-		newPrefix = prefix + "│   "
-	} else {
-		fmt.Println("└──")
-		newPrefix = prefix + "    "
+		connector, newPrefix = "├── ", prefix+"│   "
 	}
 
 	// print node information
 	if node.isLeaf {
 		// For leaf: show character and frequency
-		fmt.Printf("Leaf: ' %v ' (freq:  %v )", node.char, node.frequency)
+		fmt.Printf("%s%s'%s' (freq: %d)\n", prefix, connector, SymbolName(node.char), node.frequency)
 	} else {
-		fmt.Printf("Internal (freq: ' %v ')", node.frequency)
+		fmt.Printf("%s%s(freq: %d)\n", prefix, connector, node.frequency)
 	}
 
-	fmt.Println()
-
 	// recursively print children
 	if node.left != nil {
 		PrintTree(node.left, newPrefix, true)
@@ -0,0 +1,155 @@
+package test
+
+import (
+	"bytes"
+	"huffman-compressor/huffman"
+	"huffman-compressor/internal"
+	"io"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func TestAdaptive_RoundTrip(t *testing.T) {
+	allBytes := make([]byte, 256)
+	for i := range allBytes {
+		allBytes[i] = byte(i)
+	}
+	random := make([]byte, 5000)
+	rand.New(rand.NewSource(1)).Read(random)
+
+	testCases := []struct {
+		name string
+		data []byte
+	}{
+		{"SingleChar", []byte("a")},
+		{"Repeated", bytes.Repeat([]byte("z"), 1000)},
+		{"Text", []byte(strings.Repeat("adaptive huffman coding updates the tree ", 50))},
+		{"AllByteValues", allBytes},
+		{"AllByteValuesTwice", append(allBytes, allBytes...)},
+		{"Random", random},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var encoded bytes.Buffer
+			_, err := internal.EncodeAdaptive(&encoded, tc.data)
+			if err != nil {
+				t.Fatal("EncodeAdaptive failed:", err)
+			}
+
+			decoded, err := internal.DecodeAdaptive(&encoded, len(tc.data))
+			if err != nil {
+				t.Fatal("DecodeAdaptive failed:", err)
+			}
+			if !bytes.Equal(decoded, tc.data) {
+				t.Error("Round trip did not reproduce the input")
+			}
+		})
+	}
+}
+
+func TestAdaptive_CompressesSkewedData(t *testing.T) {
+	data := []byte(strings.Repeat("aaaaaaabbbc", 200))
+
+	var encoded bytes.Buffer
+	_, err := internal.EncodeAdaptive(&encoded, data)
+	if err != nil {
+		t.Fatal("EncodeAdaptive failed:", err)
+	}
+
+	// Static codes for this distribution average ~1.45 bits per symbol
+	if encoded.Len() > len(data)/4 {
+		t.Errorf("Expected under %d bytes, got %d", len(data)/4, encoded.Len())
+	}
+}
+
+func TestAdaptive_TruncatedPayload(t *testing.T) {
+	data := []byte("the payload is cut short")
+
+	var encoded bytes.Buffer
+	_, err := internal.EncodeAdaptive(&encoded, data)
+	if err != nil {
+		t.Fatal("EncodeAdaptive failed:", err)
+	}
+
+	truncated := encoded.Bytes()[:encoded.Len()/2]
+	_, err = internal.DecodeAdaptive(bytes.NewReader(truncated), len(data))
+	if err == nil {
+		t.Error("Expected error for truncated payload, got nil")
+	}
+}
+
+func TestAdaptiveStream_RoundTrip(t *testing.T) {
+	original := []byte(strings.Repeat("log line with some repeated content\n", 300))
+
+	var compressed bytes.Buffer
+	err := internal.CompressStreamFlags(bytes.NewReader(original), &compressed, 4096, internal.DefaultFlags|internal.FlagAdaptive)
+	if err != nil {
+		t.Fatal("CompressStreamFlags failed:", err)
+	}
+
+	var decompressed bytes.Buffer
+	err = internal.DecompressStream(&compressed, &decompressed)
+	if err != nil {
+		t.Fatal("DecompressStream failed:", err)
+	}
+	if !bytes.Equal(decompressed.Bytes(), original) {
+		t.Error("Round trip did not reproduce the input")
+	}
+}
+
+func TestAdaptiveWriter_ShortMessageOverhead(t *testing.T) {
+	message := []byte(`{"event":"login","user":42}`)
+
+	var adaptive bytes.Buffer
+	writer, err := huffman.NewAdaptiveWriter(&adaptive)
+	if err != nil {
+		t.Fatal("NewAdaptiveWriter failed:", err)
+	}
+	_, err = writer.Write(message)
+	if err != nil {
+		t.Fatal("Write failed:", err)
+	}
+	err = writer.Close()
+	if err != nil {
+		t.Fatal("Close failed:", err)
+	}
+
+	static := compressBytes(t, message)
+	if adaptive.Len() >= len(static) {
+		t.Errorf("Expected adaptive output (%d bytes) to be smaller than static (%d bytes)", adaptive.Len(), len(static))
+	}
+
+	reader, err := huffman.NewReader(&adaptive)
+	if err != nil {
+		t.Fatal("NewReader failed:", err)
+	}
+	decoded, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatal("ReadAll failed:", err)
+	}
+	if !bytes.Equal(decoded, message) {
+		t.Error("Round trip did not reproduce the message")
+	}
+}
+
+func TestWriteHeaderV2_RejectsAdaptiveFlag(t *testing.T) {
+	var buffer bytes.Buffer
+	err := internal.WriteHeaderV2(&buffer, internal.FrequencyTable{'a': 1}, 1, 0, internal.FlagAdaptive)
+	if err == nil {
+		t.Error("Expected error for adaptive flag in a file header, got nil")
+	}
+}
+
+func BenchmarkEncode_Adaptive(b *testing.B) {
+	data := loadSample(b, 1<<20)
+	b.SetBytes(int64(len(data)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, err := internal.EncodeAdaptive(io.Discard, data)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
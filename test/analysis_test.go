@@ -0,0 +1,101 @@
+package test
+
+import (
+	"bytes"
+	"huffman-compressor/internal"
+	"math"
+	"testing"
+)
+
+func almostEqual(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+func TestEntropy_KnownTables(t *testing.T) {
+	tests := []struct {
+		name    string
+		table   internal.FrequencyTable
+		entropy float64
+	}{
+		{"empty", internal.FrequencyTable{}, 0},
+		{"single symbol", internal.FrequencyTable{'a': 10}, 0},
+		{"two equal", internal.FrequencyTable{'a': 5, 'b': 5}, 1},
+		{"dyadic", internal.FrequencyTable{'a': 2, 'b': 1, 'c': 1}, 1.5},
+		{"skewed", internal.FrequencyTable{'a': 3, 'b': 1}, 2 - 0.75*math.Log2(3)},
+	}
+
+	for _, test := range tests {
+		if got := test.table.Entropy(); !almostEqual(got, test.entropy) {
+			t.Errorf("%s: expected entropy %f, got %f", test.name, test.entropy, got)
+		}
+	}
+
+	uniform := make([]byte, 256*4)
+	for i := range uniform {
+		uniform[i] = byte(i)
+	}
+	if got := internal.CountFrequencies(uniform).Entropy(); !almostEqual(got, 8) {
+		t.Errorf("Expected 8 bits for all byte values equally often, got %f", got)
+	}
+}
+
+func TestAnalyze_Redundancy(t *testing.T) {
+	// Dyadic probabilities are coded exactly at the entropy
+	table := internal.FrequencyTable{'a': 2, 'b': 1, 'c': 1}
+	root, err := internal.BuildHuffmanTree(table)
+	if err != nil {
+		t.Fatal(err)
+	}
+	analysis := internal.Analyze(table, internal.GenerateCodes(root))
+	if !almostEqual(analysis.AverageCodeLength, 1.5) || !almostEqual(analysis.Redundancy, 0) ||
+		!almostEqual(analysis.Efficiency, 100) {
+		t.Errorf("Expected a perfect code for dyadic frequencies, got %+v", analysis)
+	}
+
+	// 3:1 still needs a whole bit per symbol
+	table = internal.FrequencyTable{'a': 3, 'b': 1}
+	root, err = internal.BuildHuffmanTree(table)
+	if err != nil {
+		t.Fatal(err)
+	}
+	analysis = internal.Analyze(table, internal.GenerateCodes(root))
+	if !almostEqual(analysis.AverageCodeLength, 1) || !almostEqual(analysis.Redundancy, 1-table.Entropy()) {
+		t.Errorf("Unexpected figures for 3:1 frequencies: %+v", analysis)
+	}
+	if analysis.EntropySize > analysis.PayloadSize {
+		t.Errorf("Entropy bound %d above the payload %d", analysis.EntropySize, analysis.PayloadSize)
+	}
+}
+
+func TestAnalyzeFile_MatchesCompressFile(t *testing.T) {
+	data := bytes.Repeat([]byte("entropy tells how far huffman can go. "), 300)
+	inputPath, compressedPath := compressFile(t, data)
+
+	analysis, err := internal.AnalyzeFile(inputPath)
+	if err != nil {
+		t.Fatal("AnalyzeFile failed:", err)
+	}
+	info, err := internal.GetCompressedInfo(compressedPath)
+	if err != nil {
+		t.Fatal("GetCompressedInfo failed:", err)
+	}
+
+	if analysis.Format != internal.AnalysisFormat {
+		t.Errorf("Expected format %q, got %q", internal.AnalysisFormat, analysis.Format)
+	}
+	if analysis.OriginalSize != uint64(len(data)) {
+		t.Errorf("Expected original size %d, got %d", len(data), analysis.OriginalSize)
+	}
+	if analysis.HeaderSize != info.HeaderSize || analysis.PayloadSize != info.PayloadSize ||
+		analysis.TrailerSize != info.TrailerSize || analysis.CompressedSize != info.CompressedSize {
+		t.Errorf("Analysis %+v doesn't match the compressed file %+v", analysis, info)
+	}
+	if analysis.Redundancy < 0 || analysis.Redundancy >= 1 {
+		t.Errorf("Huffman codes are within 1 bit of the entropy, got redundancy %f", analysis.Redundancy)
+	}
+
+	stream := compressStream(t, data, streamOptions{blockSize: internal.DefaultBlockSize, flags: internal.DefaultFlags})
+	if analysis.StreamSize != uint64(len(stream)) {
+		t.Errorf("Expected stream size %d, got %d", len(stream), analysis.StreamSize)
+	}
+}
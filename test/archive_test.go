@@ -0,0 +1,270 @@
+package test
+
+import (
+	"bytes"
+	"errors"
+	"huffman-compressor/internal"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeTree creates files (path -> contents) below dir
+func writeTree(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+
+	for name, contents := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		err := os.MkdirAll(filepath.Dir(path), 0o755)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = os.WriteFile(path, []byte(contents), 0o644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestArchive_DirectoryRoundTrip(t *testing.T) {
+	work := t.TempDir()
+	source := filepath.Join(work, "src")
+	files := map[string]string{
+		"README.md":         strings.Repeat("archive entries are compressed one by one\n", 50),
+		"empty.txt":         "",
+		"docs/guide.txt":    "guide",
+		"docs/deep/a/b.bin": string([]byte{0, 1, 2, 255, 254}),
+	}
+	writeTree(t, source, files)
+	err := os.Symlink("../README.md", filepath.Join(source, "docs", "readme-link"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.Chmod(filepath.Join(source, "docs", "guide.txt"), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	modTime := time.Date(2020, 5, 17, 12, 30, 0, 500, time.UTC)
+	err = os.Chtimes(filepath.Join(source, "README.md"), modTime, modTime)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	archivePath := filepath.Join(work, "test.hfa")
+	err = internal.CreateArchive(archivePath, []string{source}, 6)
+	if err != nil {
+		t.Fatal("CreateArchive failed:", err)
+	}
+
+	dest := filepath.Join(work, "out")
+	err = internal.ExtractArchive(archivePath, dest, nil, internal.ExtractOptions{})
+	if err != nil {
+		t.Fatal("ExtractArchive failed:", err)
+	}
+
+	extracted := filepath.Join(dest, internal.ArchiveName(source))
+	for name, contents := range files {
+		data, err := os.ReadFile(filepath.Join(extracted, filepath.FromSlash(name)))
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if string(data) != contents {
+			t.Errorf("%s: contents differ after extraction", name)
+		}
+	}
+
+	link, err := os.Readlink(filepath.Join(extracted, "docs", "readme-link"))
+	if err != nil || link != "../README.md" {
+		t.Errorf("Expected symlink to ../README.md, got %q (%v)", link, err)
+	}
+
+	info, err := os.Stat(filepath.Join(extracted, "docs", "guide.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0o600 {
+		t.Errorf("Expected mode 0600, got %04o", info.Mode().Perm())
+	}
+
+	info, err = os.Stat(filepath.Join(extracted, "README.md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !info.ModTime().Equal(modTime) {
+		t.Errorf("Expected modification time %v, got %v", modTime, info.ModTime())
+	}
+}
+
+func TestArchive_ListWithoutDecoding(t *testing.T) {
+	var archive bytes.Buffer
+	writer, err := internal.NewArchiveWriter(&archive, internal.MinLevel)
+	if err != nil {
+		t.Fatal("NewArchiveWriter failed:", err)
+	}
+	err = writer.Add(internal.ArchiveEntry{Path: "dir", Type: internal.EntryDir, Mode: 0o755}, nil)
+	if err != nil {
+		t.Fatal("Add failed:", err)
+	}
+	err = writer.Add(internal.ArchiveEntry{Path: "dir/a.txt", Mode: 0o644}, strings.NewReader("aaaa"))
+	if err != nil {
+		t.Fatal("Add failed:", err)
+	}
+	err = writer.Close()
+	if err != nil {
+		t.Fatal("Close failed:", err)
+	}
+
+	// Garble the entry data: the directory must still be readable
+	data := archive.Bytes()
+	entries := readArchive(t, data).Entries()
+	for i := entries[1].Offset; i < entries[1].Offset+entries[1].CompressedSize; i++ {
+		data[i] = 0xAA
+	}
+
+	entries = readArchive(t, data).Entries()
+	if len(entries) != 2 {
+		t.Fatalf("Expected 2 entries, got %d", len(entries))
+	}
+	if entries[0].Path != "dir" || entries[0].Type != internal.EntryDir {
+		t.Errorf("Unexpected first entry %+v", entries[0])
+	}
+	if entries[1].Path != "dir/a.txt" || entries[1].Size != 4 || entries[1].Mode != 0o644 {
+		t.Errorf("Unexpected second entry %+v", entries[1])
+	}
+}
+
+func readArchive(t *testing.T, data []byte) *internal.ArchiveReader {
+	t.Helper()
+
+	reader, err := internal.NewArchiveReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal("NewArchiveReader failed:", err)
+	}
+	return reader
+}
+
+func TestArchive_OpenSingleEntry(t *testing.T) {
+	var archive bytes.Buffer
+	writer, err := internal.NewArchiveWriter(&archive, 9)
+	if err != nil {
+		t.Fatal("NewArchiveWriter failed:", err)
+	}
+	contents := map[string]string{
+		"one.txt":   strings.Repeat("first entry ", 100),
+		"two.txt":   strings.Repeat("second entry ", 100),
+		"three.txt": "third",
+	}
+	for _, name := range []string{"one.txt", "two.txt", "three.txt"} {
+		err = writer.Add(internal.ArchiveEntry{Path: name, Mode: 0o644}, strings.NewReader(contents[name]))
+		if err != nil {
+			t.Fatal("Add failed:", err)
+		}
+	}
+	err = writer.Close()
+	if err != nil {
+		t.Fatal("Close failed:", err)
+	}
+
+	reader := readArchive(t, archive.Bytes())
+	entry := reader.Entries()[1]
+	entryReader, err := reader.Open(entry)
+	if err != nil {
+		t.Fatal("Open failed:", err)
+	}
+	data, err := io.ReadAll(entryReader)
+	if err != nil {
+		t.Fatal("ReadAll failed:", err)
+	}
+	if string(data) != contents["two.txt"] {
+		t.Error("Open returned the wrong contents")
+	}
+}
+
+func TestArchive_ExtractSelected(t *testing.T) {
+	work := t.TempDir()
+	writeTree(t, work, map[string]string{
+		"tree/keep/a.txt": "a",
+		"tree/keep/b.txt": "b",
+		"tree/skip.txt":   "skip",
+	})
+
+	archivePath := filepath.Join(work, "sel.hfa")
+	err := internal.CreateArchive(archivePath, []string{filepath.Join(work, "tree")}, internal.MinLevel)
+	if err != nil {
+		t.Fatal("CreateArchive failed:", err)
+	}
+
+	prefix := internal.ArchiveName(filepath.Join(work, "tree"))
+	dest := filepath.Join(work, "out")
+	err = internal.ExtractArchive(archivePath, dest, []string{prefix + "/keep"}, internal.ExtractOptions{})
+	if err != nil {
+		t.Fatal("ExtractArchive failed:", err)
+	}
+
+	extracted := filepath.Join(dest, filepath.FromSlash(prefix))
+	for _, name := range []string{"keep/a.txt", "keep/b.txt"} {
+		if _, err := os.Stat(filepath.Join(extracted, name)); err != nil {
+			t.Errorf("Expected %s to be extracted: %v", name, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(extracted, "skip.txt")); !errors.Is(err, os.ErrNotExist) {
+		t.Error("Expected skip.txt not to be extracted")
+	}
+
+	err = internal.ExtractArchive(archivePath, dest, []string{"missing"}, internal.ExtractOptions{})
+	if err == nil {
+		t.Error("Expected error for an entry that isn't in the archive, got nil")
+	}
+}
+
+func TestArchive_DuplicatePath(t *testing.T) {
+	writer, err := internal.NewArchiveWriter(io.Discard, internal.MinLevel)
+	if err != nil {
+		t.Fatal("NewArchiveWriter failed:", err)
+	}
+	err = writer.Add(internal.ArchiveEntry{Path: "same", Type: internal.EntryDir}, nil)
+	if err != nil {
+		t.Fatal("Add failed:", err)
+	}
+	err = writer.Add(internal.ArchiveEntry{Path: "same"}, strings.NewReader("again"))
+	if err == nil {
+		t.Error("Expected error for a duplicate path, got nil")
+	}
+}
+
+func TestArchive_CorruptDirectory(t *testing.T) {
+	var archive bytes.Buffer
+	writer, err := internal.NewArchiveWriter(&archive, internal.MinLevel)
+	if err != nil {
+		t.Fatal("NewArchiveWriter failed:", err)
+	}
+	err = writer.Add(internal.ArchiveEntry{Path: "file"}, strings.NewReader("contents"))
+	if err != nil {
+		t.Fatal("Add failed:", err)
+	}
+	err = writer.Close()
+	if err != nil {
+		t.Fatal("Close failed:", err)
+	}
+	data := archive.Bytes()
+
+	// Last directory byte, just before the 14-byte footer
+	corrupt := bytes.Clone(data)
+	corrupt[len(corrupt)-15] ^= 0xFF
+	_, err = internal.NewArchiveReader(bytes.NewReader(corrupt), int64(len(corrupt)))
+	var checksumErr *internal.ChecksumError
+	if !errors.As(err, &checksumErr) {
+		t.Errorf("Expected ChecksumError for a corrupt directory, got %v", err)
+	}
+
+	for _, size := range []int{0, 3, len(data) - 1} {
+		_, err = internal.NewArchiveReader(bytes.NewReader(data[:size]), int64(size))
+		if err == nil {
+			t.Errorf("Expected error for archive cut to %d bytes, got nil", size)
+		}
+	}
+}
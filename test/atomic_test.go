@@ -0,0 +1,187 @@
+package test
+
+import (
+	"bytes"
+	"huffman-compressor/internal"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// leftovers returns the names in dir other than keep
+func leftovers(t *testing.T, dir string, keep ...string) []string {
+	t.Helper()
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, entry := range entries {
+		if !slices.Contains(keep, entry.Name()) {
+			names = append(names, entry.Name())
+		}
+	}
+	return names
+}
+
+func TestCreateAtomic_CommitAndAbort(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "out.bin")
+
+	file, err := internal.CreateAtomic(path, 0o640)
+	if err != nil {
+		t.Fatal("CreateAtomic failed:", err)
+	}
+	file.WriteString("complete")
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Error("Expected the destination not to exist before Commit")
+	}
+	err = file.Commit()
+	if err != nil {
+		t.Fatal("Commit failed:", err)
+	}
+	file.Abort() // no-op after Commit
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0o640 {
+		t.Errorf("Expected mode 0640, got %04o", info.Mode().Perm())
+	}
+
+	// An aborted replacement leaves the old contents alone
+	file, err = internal.CreateAtomic(path, 0o644)
+	if err != nil {
+		t.Fatal("CreateAtomic failed:", err)
+	}
+	file.WriteString("part")
+	file.Abort()
+
+	if data, _ := os.ReadFile(path); string(data) != "complete" {
+		t.Errorf("Expected the destination to keep its contents, got %q", data)
+	}
+	if names := leftovers(t, dir, "out.bin"); len(names) != 0 {
+		t.Errorf("Expected temporary files to be removed, found %v", names)
+	}
+}
+
+func TestCreateAtomic_KeepsMode(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "out.bin")
+	err := os.WriteFile(path, []byte("old"), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := internal.CreateAtomic(path, 0o644)
+	if err != nil {
+		t.Fatal("CreateAtomic failed:", err)
+	}
+	file.WriteString("new")
+	err = file.Commit()
+	if err != nil {
+		t.Fatal("Commit failed:", err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0o600 {
+		t.Errorf("Expected the replaced file's mode 0600, got %04o", info.Mode().Perm())
+	}
+	if data, _ := os.ReadFile(path); string(data) != "new" {
+		t.Errorf("Expected the new contents, got %q", data)
+	}
+}
+
+func TestCreateAtomic_WritesThroughSymlink(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "target.bin")
+	link := filepath.Join(dir, "link.bin")
+	err := os.WriteFile(target, []byte("old contents"), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.Symlink(target, link)
+	if err != nil {
+		t.Skip("symlinks not supported:", err)
+	}
+
+	file, err := internal.CreateAtomic(link, 0o644)
+	if err != nil {
+		t.Fatal("CreateAtomic failed:", err)
+	}
+	file.WriteString("new")
+	err = file.Commit()
+	if err != nil {
+		t.Fatal("Commit failed:", err)
+	}
+
+	info, err := os.Lstat(link)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode()&os.ModeSymlink == 0 {
+		t.Errorf("Expected %s to stay a symlink, got mode %v", link, info.Mode())
+	}
+	if data, _ := os.ReadFile(target); string(data) != "new" {
+		t.Errorf("Expected the symlink target to hold the new contents, got %q", data)
+	}
+	if names := leftovers(t, dir, "target.bin", "link.bin"); len(names) != 0 {
+		t.Errorf("Expected no temporary files, found %v", names)
+	}
+}
+
+func TestDecompress_FailureKeepsExistingOutput(t *testing.T) {
+	dir := t.TempDir()
+	inputPath := filepath.Join(dir, "input.txt")
+	err := os.WriteFile(inputPath, bytes.Repeat([]byte("atomic output "), 500), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, format := range []string{"file", "stream"} {
+		t.Run(format, func(t *testing.T) {
+			compressedPath := filepath.Join(dir, format+".hf")
+			if format == "file" {
+				err = internal.CompressFile(inputPath, compressedPath)
+			} else {
+				err = internal.CompressFileBlocks(inputPath, compressedPath, 0, 0, internal.DefaultFlags)
+			}
+			if err != nil {
+				t.Fatal("Compression failed:", err)
+			}
+
+			// Cut off the checksum trailer and some of the payload
+			compressed, err := os.ReadFile(compressedPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = os.WriteFile(compressedPath, compressed[:len(compressed)-20], 0644)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			outputPath := filepath.Join(dir, format+".out")
+			err = os.WriteFile(outputPath, []byte("previous"), 0644)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = internal.Decompress(compressedPath, outputPath)
+			if err == nil {
+				t.Fatal("Expected error for a truncated file, got nil")
+			}
+			if data, _ := os.ReadFile(outputPath); string(data) != "previous" {
+				t.Errorf("Expected the existing output to be untouched, got %d bytes", len(data))
+			}
+			if names := leftovers(t, dir, "input.txt", "file.hf", "file.out", "stream.hf", "stream.out"); len(names) != 0 {
+				t.Errorf("Expected temporary files to be removed, found %v", names)
+			}
+		})
+	}
+}
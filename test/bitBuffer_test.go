@@ -2,6 +2,7 @@ package test
 
 import (
 	"bytes"
+	"errors"
 	"huffman-compressor/internal"
 	"testing"
 )
@@ -247,7 +248,7 @@ func TestLargeData(t *testing.T) {
 	}
 }
 
-// Test: Flush behavior (byte written immediately)
+// Test: Flush behavior (complete bytes written on Flush)
 func TestFlushBehavior(t *testing.T) {
 
 	var output bytes.Buffer
@@ -257,13 +258,15 @@ func TestFlushBehavior(t *testing.T) {
 	for i := 0; i < 7; i++ {
 		bb.WriteBit(1)
 	}
+	bb.Flush()
 
 	if len(output.Bytes()) != 0 {
 		t.Errorf("Should not flush incomplete byte")
 	}
 
-	// Write 8th bit - should flush
+	// Write 8th bit - complete byte is written by Flush
 	bb.WriteBit(1)
+	bb.Flush()
 
 	if len(output.Bytes()) != 1 {
 
@@ -358,3 +361,79 @@ func TestBitOrderingExplicit(t *testing.T) {
 		t.Errorf("Expected %08b, got %08b", expected, result[0])
 	}
 }
+
+// failingWriter accepts limit bytes and then fails every write
+type failingWriter struct {
+	limit   int
+	written int
+}
+
+func (fw *failingWriter) Write(p []byte) (int, error) {
+	if fw.written+len(p) > fw.limit {
+		return 0, errors.New("disk full")
+	}
+	fw.written += len(p)
+	return len(p), nil
+}
+
+// Test: Write errors are reported instead of silently truncating output
+func TestBitBufferReportsWriteErrors(t *testing.T) {
+	bb := internal.NewBitBuffer(&failingWriter{limit: 0})
+
+	for i := 0; i < 100; i++ {
+		bb.WriteBits(0xABCD, 16)
+	}
+
+	_, err := bb.Close()
+	if err == nil {
+		t.Fatal("Expected Close to report the write error, got nil")
+	}
+
+	// The error is sticky
+	err = bb.WriteBits(1, 1)
+	if err == nil {
+		t.Error("Expected WriteBits after a failed write to return the error")
+	}
+}
+
+// Test: Enough output to fill the internal buffer surfaces the error from WriteBits
+func TestBitBufferWriteBitsError(t *testing.T) {
+	bb := internal.NewBitBuffer(&failingWriter{limit: 0})
+
+	var err error
+	for i := 0; i < 10000 && err == nil; i++ {
+		err = bb.WriteBits(0xFFFFFFFF, 32)
+	}
+
+	if err == nil {
+		t.Fatal("Expected WriteBits to report the write error, got nil")
+	}
+}
+
+// Test: Codes of up to 64 bits are written whole
+func TestWriteBitsLongCodes(t *testing.T) {
+	var output bytes.Buffer
+	bb := internal.NewBitBuffer(&output)
+
+	// 3 bits "101", then a 64 bit code of all ones, then "0"
+	bb.WriteBits(0b101, 3)
+	bb.WriteBits(^uint64(0), 64)
+	bb.WriteBits(0, 1)
+
+	padding, err := bb.Close()
+	if err != nil {
+		t.Fatal("Close failed:", err)
+	}
+
+	if bb.GetTotalBits() != 68 {
+		t.Errorf("Expected 68 total bits, got %d", bb.GetTotalBits())
+	}
+	if padding != 4 {
+		t.Errorf("Expected 4 padding bits, got %d", padding)
+	}
+
+	expected := []byte{0b10111111, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0b11100000}
+	if !bytes.Equal(output.Bytes(), expected) {
+		t.Errorf("Expected %08b, got %08b", expected, output.Bytes())
+	}
+}
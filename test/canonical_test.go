@@ -0,0 +1,212 @@
+package test
+
+import (
+	"bytes"
+	"huffman-compressor/internal"
+	"strings"
+	"testing"
+)
+
+func TestGenerateCanonicalCodes_SameLengthsAsTree(t *testing.T) {
+	freqTable := internal.FrequencyTable{'a': 45, 'b': 13, 'c': 12, 'd': 16, 'e': 9, 'f': 5}
+
+	root, err := internal.BuildHuffmanTree(freqTable)
+	if err != nil {
+		t.Fatal("BuildHuffmanTree failed:", err)
+	}
+
+	treeCodes := internal.GenerateCodes(root)
+	canonicalCodes, err := internal.GenerateCanonicalCodes(root)
+	if err != nil {
+		t.Fatal("GenerateCanonicalCodes failed:", err)
+	}
+
+	if len(canonicalCodes) != len(treeCodes) {
+		t.Fatalf("Expected %d codes, got %d", len(treeCodes), len(canonicalCodes))
+	}
+
+	for char, code := range treeCodes {
+		canonical := canonicalCodes[char]
+		if canonical.GetLength() != code.GetLength() {
+			t.Errorf("'%c': canonical length %d, tree length %d", char, canonical.GetLength(), code.GetLength())
+		}
+	}
+
+	if !internal.VerifyPrefixFree(canonicalCodes) {
+		t.Error("Canonical codes are not prefix-free")
+	}
+}
+
+func TestCanonicalCodes_KnownAssignment(t *testing.T) {
+	// Classic example: lengths A=2 B=1 C=3 D=3 give B=0 A=10 C=110 D=111
+	lengths := make([]uint8, 256)
+	lengths['A'] = 2
+	lengths['B'] = 1
+	lengths['C'] = 3
+	lengths['D'] = 3
+
+	codeTable, err := internal.CodeTableFromLengths(lengths)
+	if err != nil {
+		t.Fatal("CodeTableFromLengths failed:", err)
+	}
+
+	// CodeToString prints the highest stored bit first, and the first bit of
+	// a code is stored lowest, so the strings come out reversed
+	expected := map[byte]string{'A': "01", 'B': "0", 'C': "011", 'D': "111"}
+	for char, want := range expected {
+		got := internal.CodeToString(codeTable[char])
+		if got != want {
+			t.Errorf("'%c': expected %s, got %s", char, want, got)
+		}
+	}
+}
+
+func TestValidateCodeLengths_OverSubscribed(t *testing.T) {
+	// Three codes of length 1 can't be prefix-free
+	lengths := make([]uint8, 256)
+	lengths['a'] = 1
+	lengths['b'] = 1
+	lengths['c'] = 1
+
+	err := internal.ValidateCodeLengths(lengths)
+	if err == nil {
+		t.Fatal("Expected error for over-subscribed lengths, got nil")
+	}
+
+	_, err = internal.CodeTableFromLengths(lengths)
+	if err == nil {
+		t.Fatal("Expected CodeTableFromLengths to reject over-subscribed lengths")
+	}
+}
+
+func TestValidateCodeLengths_Empty(t *testing.T) {
+	err := internal.ValidateCodeLengths(make([]uint8, 256))
+	if err == nil {
+		t.Fatal("Expected error for table without symbols, got nil")
+	}
+}
+
+func TestCodeLengths_WriteReadNibblePacked(t *testing.T) {
+	lengths := make([]uint8, 256)
+	lengths['{'] = 2
+	lengths['"'] = 2
+	lengths[':'] = 3
+	lengths['}'] = 3
+
+	var buffer bytes.Buffer
+	err := internal.WriteCodeLengths(&buffer, lengths)
+	if err != nil {
+		t.Fatal("WriteCodeLengths failed:", err)
+	}
+
+	// '"' (34) to '}' (125) is 92 symbols packed two per byte
+	expectedSize := 3 + 46
+	if buffer.Len() != expectedSize {
+		t.Errorf("Expected %d bytes, got %d", expectedSize, buffer.Len())
+	}
+	if internal.CalculateCodeLengthsSize(lengths) != expectedSize {
+		t.Errorf("CalculateCodeLengthsSize = %d, want %d", internal.CalculateCodeLengthsSize(lengths), expectedSize)
+	}
+
+	decoded, err := internal.ReadCodeLengths(&buffer)
+	if err != nil {
+		t.Fatal("ReadCodeLengths failed:", err)
+	}
+	if !bytes.Equal(decoded, lengths) {
+		t.Error("Code lengths changed after write/read")
+	}
+}
+
+func TestCodeLengths_WriteReadBytePacked(t *testing.T) {
+	// A length above 15 does not fit a nibble
+	lengths := make([]uint8, 256)
+	lengths[0] = 1
+	lengths[255] = 20
+
+	var buffer bytes.Buffer
+	err := internal.WriteCodeLengths(&buffer, lengths)
+	if err != nil {
+		t.Fatal("WriteCodeLengths failed:", err)
+	}
+
+	if buffer.Len() != 3+256 {
+		t.Errorf("Expected %d bytes, got %d", 3+256, buffer.Len())
+	}
+
+	decoded, err := internal.ReadCodeLengths(&buffer)
+	if err != nil {
+		t.Fatal("ReadCodeLengths failed:", err)
+	}
+	if !bytes.Equal(decoded, lengths) {
+		t.Error("Code lengths changed after write/read")
+	}
+}
+
+func TestBuildTreeFromCodes_Decodes(t *testing.T) {
+	data := []byte("canonical huffman codes only need lengths")
+	root, err := internal.BuildHuffmanTree(internal.CountFrequencies(data))
+	if err != nil {
+		t.Fatal("BuildHuffmanTree failed:", err)
+	}
+
+	codeTable, err := internal.CodeTableFromLengths(internal.CodeLengths(root))
+	if err != nil {
+		t.Fatal("CodeTableFromLengths failed:", err)
+	}
+
+	var encoded bytes.Buffer
+	bitBuffer := internal.NewBitBuffer(&encoded)
+	for _, char := range data {
+		code := codeTable[char]
+		bitBuffer.WriteBits(uint64(code.GetBits()), code.GetLength())
+	}
+	bitBuffer.Close()
+
+	rebuilt, err := internal.BuildTreeFromCodes(codeTable)
+	if err != nil {
+		t.Fatal("BuildTreeFromCodes failed:", err)
+	}
+
+	bitReader := internal.NewBitReader(&encoded)
+	for i, want := range data {
+		got, err := internal.DecodeSymbol(bitReader, rebuilt)
+		if err != nil {
+			t.Fatalf("DecodeSymbol failed at %d: %v", i, err)
+		}
+		if got != want {
+			t.Fatalf("Symbol %d: expected %q, got %q", i, want, got)
+		}
+	}
+}
+
+func TestCodeLengths_SmallerThanFrequencyHeader(t *testing.T) {
+	data := []byte(`{"id":1234,"name":"widget","tags":["a","b","c"],"active":true,"price":19.99}`)
+	freqTable := internal.CountFrequencies(data)
+
+	root, err := internal.BuildHuffmanTree(freqTable)
+	if err != nil {
+		t.Fatal("BuildHuffmanTree failed:", err)
+	}
+
+	lengthsSize := internal.CalculateCodeLengthsSize(internal.CodeLengths(root))
+	freqSize := internal.CalculateHeaderSize(freqTable)
+
+	t.Logf("Frequency header=%d bytes, code lengths=%d bytes", freqSize, lengthsSize)
+	if lengthsSize*2 > freqSize {
+		t.Errorf("Expected code lengths (%d bytes) to be well below the frequency header (%d bytes)", lengthsSize, freqSize)
+	}
+}
+
+func TestStream_SmallJSONDocumentsCompress(t *testing.T) {
+	original := []byte(strings.Repeat(`{"user":"alice","event":"login","ok":true}`+"\n", 8))
+
+	var compressed bytes.Buffer
+	err := internal.CompressStream(bytes.NewReader(original), &compressed, 0)
+	if err != nil {
+		t.Fatal("CompressStream failed:", err)
+	}
+
+	if compressed.Len() >= len(original) {
+		t.Errorf("Expected compression: compressed=%d, original=%d", compressed.Len(), len(original))
+	}
+}
@@ -0,0 +1,176 @@
+package test
+
+import (
+	"bytes"
+	"errors"
+	"huffman-compressor/huffman"
+	"huffman-compressor/internal"
+	"io"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestTrailer_WriteAndRead(t *testing.T) {
+	flags := internal.FlagChecksum | internal.FlagSHA256
+	trailer := internal.Trailer{CompressedCRC: 0xdeadbeef, ContentCRC: 0x01020304}
+	trailer.ContentSHA256[0] = 0xaa
+	trailer.ContentSHA256[31] = 0xbb
+
+	var buffer bytes.Buffer
+	err := internal.WriteTrailer(&buffer, trailer, flags)
+	if err != nil {
+		t.Fatal("WriteTrailer failed:", err)
+	}
+	if buffer.Len() != internal.TrailerSize(flags) {
+		t.Errorf("Expected %d bytes, got %d", internal.TrailerSize(flags), buffer.Len())
+	}
+
+	read, err := internal.ReadTrailer(&buffer, flags)
+	if err != nil {
+		t.Fatal("ReadTrailer failed:", err)
+	}
+	if read != trailer {
+		t.Errorf("Trailer mismatch: got %+v, want %+v", read, trailer)
+	}
+}
+
+func TestStreamChecksum_RoundTripWithSHA256(t *testing.T) {
+	data := strings.Repeat("checksummed stream data ", 40)
+	compressed := compressStream(t, []byte(data), streamOptions{blockSize: 64, flags: internal.FlagChecksum | internal.FlagSHA256})
+
+	var decompressed bytes.Buffer
+	err := internal.DecompressStream(bytes.NewReader(compressed), &decompressed)
+	if err != nil {
+		t.Fatal("DecompressStream failed:", err)
+	}
+	if decompressed.String() != data {
+		t.Error("Round trip did not reproduce the input")
+	}
+}
+
+func TestStreamChecksum_DetectsCorruption(t *testing.T) {
+	data := strings.Repeat("the quick brown fox ", 30)
+	flags := internal.FlagChecksum | internal.FlagSHA256
+	trailerStart := len(compressStream(t, []byte(data), streamOptions{blockSize: 64, flags: flags})) - internal.TrailerSize(flags)
+
+	testCases := []struct {
+		name   string
+		offset int
+		kind   string
+	}{
+		{"CompressedCRC", trailerStart, "compressed data"},
+		{"ContentCRC", trailerStart + 4, "content"},
+		{"ContentSHA256", trailerStart + 8, "content SHA-256"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			compressed := compressStream(t, []byte(data), streamOptions{blockSize: 64, flags: flags})
+			compressed[tc.offset] ^= 0x01
+
+			err := internal.DecompressStream(bytes.NewReader(compressed), io.Discard)
+			var checksumErr *internal.ChecksumError
+			if !errors.As(err, &checksumErr) {
+				t.Fatalf("Expected ChecksumError, got %T: %v", err, err)
+			}
+			if checksumErr.Kind != tc.kind {
+				t.Errorf("Expected %q mismatch, got %q", tc.kind, checksumErr.Kind)
+			}
+		})
+	}
+}
+
+func TestStreamChecksum_DetectsPayloadBitFlip(t *testing.T) {
+	data := strings.Repeat("abcdefgh", 8)
+	compressed := compressStream(t, []byte(data), streamOptions{blockSize: 64, flags: internal.FlagChecksum})
+
+	// Last payload byte of the only block, just before the end marker
+	offset := len(compressed) - internal.TrailerSize(internal.FlagChecksum) - 4 - 1
+	compressed[offset] ^= 0x10
+
+	err := internal.DecompressStream(bytes.NewReader(compressed), io.Discard)
+	if err == nil {
+		t.Fatal("Expected error for corrupted payload, got nil")
+	}
+}
+
+func TestStreamChecksum_WithoutChecksumFlag(t *testing.T) {
+	data := "no checksums here"
+	compressed := compressStream(t, []byte(data), streamOptions{blockSize: 64})
+
+	var decompressed bytes.Buffer
+	err := internal.DecompressStream(bytes.NewReader(compressed), &decompressed)
+	if err != nil {
+		t.Fatal("DecompressStream failed:", err)
+	}
+	if decompressed.String() != data {
+		t.Error("Round trip did not reproduce the input")
+	}
+}
+
+func TestFileChecksum_DecompressDetectsCorruption(t *testing.T) {
+	originalPath := "test_checksum_input.txt"
+	err := os.WriteFile(originalPath, []byte(strings.Repeat("backup data that may rot\n", 50)), 0644)
+	if err != nil {
+		t.Fatal("Failed to create original file:", err)
+	}
+	defer os.Remove(originalPath)
+
+	compressedPath := "test_checksum_input.hf"
+	err = internal.CompressFile(originalPath, compressedPath)
+	if err != nil {
+		t.Fatal("Compression failed:", err)
+	}
+	defer os.Remove(compressedPath)
+
+	outputPath := "test_checksum_output.txt"
+	defer os.Remove(outputPath)
+
+	// Intact file passes both paths
+	err = internal.Decompress(compressedPath, outputPath)
+	if err != nil {
+		t.Fatal("Decompression failed:", err)
+	}
+	err = internal.VerifyCompressedFile(compressedPath)
+	if err != nil {
+		t.Fatal("VerifyCompressedFile failed:", err)
+	}
+
+	// Damage the content checksum
+	compressedData, err := os.ReadFile(compressedPath)
+	if err != nil {
+		t.Fatal("Failed to read compressed file:", err)
+	}
+	compressedData[len(compressedData)-1] ^= 0xff
+	err = os.WriteFile(compressedPath, compressedData, 0644)
+	if err != nil {
+		t.Fatal("Failed to write corrupted file:", err)
+	}
+
+	var checksumErr *internal.ChecksumError
+	err = internal.Decompress(compressedPath, outputPath)
+	if !errors.As(err, &checksumErr) {
+		t.Fatalf("Decompress: expected ChecksumError, got %T: %v", err, err)
+	}
+	err = internal.VerifyCompressedFile(compressedPath)
+	if !errors.As(err, &checksumErr) {
+		t.Fatalf("VerifyCompressedFile: expected ChecksumError, got %T: %v", err, err)
+	}
+}
+
+func TestReader_ReportsChecksumError(t *testing.T) {
+	compressed := compressBytes(t, []byte(strings.Repeat("payload ", 100)))
+	compressed[len(compressed)-1] ^= 0x01
+
+	reader, err := huffman.NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		t.Fatal("NewReader failed:", err)
+	}
+
+	_, err = io.ReadAll(reader)
+	var checksumErr *huffman.ChecksumError
+	if !errors.As(err, &checksumErr) {
+		t.Fatalf("Expected ChecksumError, got %T: %v", err, err)
+	}
+}
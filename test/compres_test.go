@@ -323,13 +323,24 @@ func TestCompressFile_BinaryData(t *testing.T) {
 	outputPath := "test_compress_binary.hf"
 	err = internal.CompressFile(inputPath, outputPath)
 
-	// Should error because 256 unique bytes exceeds uint8 limit
-	if err == nil {
-		t.Fatal("Expected error for 256 unique bytes, got nil")
-		os.Remove(outputPath)
+	// The version 2 header stores up to 256 unique bytes
+	if err != nil {
+		t.Fatal("Compression of 256 unique bytes failed:", err)
+	}
+	defer os.Remove(outputPath)
+
+	outputFile, err := os.Open(outputPath)
+	if err != nil {
+		t.Fatal("Failed to open output:", err)
+	}
+	defer outputFile.Close()
+
+	header, err := internal.ReadHeader(outputFile)
+	if err != nil {
+		t.Fatal("Failed to read header:", err)
 	}
 
-	if !strings.Contains(err.Error(), "255") {
-		t.Errorf("Expected error about 255 limit, got: %v", err)
+	if header.NumChars != 256 {
+		t.Errorf("Expected 256 unique chars, got %d", header.NumChars)
 	}
 }
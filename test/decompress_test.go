@@ -242,9 +242,13 @@ func TestDecompresFile_CorruptData(t *testing.T) {
 	}
 
 	// Flip some bits in the middle of the file (after header)
-	if len(compressedData) > 50 {
-		compressedData[50] ^= 0xFF // bitwise OR ( alternate bits return 1 same bits return 0)
+	header, err := internal.ReadHeader(bytes.NewReader(compressedData))
+	if err != nil {
+		t.Fatal("Failed to read header:", err)
 	}
+	headerSize := internal.CalculateHeaderSizeV2(header.FreqTable, header.OriginalSize)
+	middle := headerSize + (len(compressedData)-headerSize)/2
+	compressedData[middle] ^= 0xFF // bitwise OR ( alternate bits return 1 same bits return 0)
 
 	err = os.WriteFile(compressedPath, compressedData, 0644)
 	if err != nil {
@@ -253,13 +257,12 @@ func TestDecompresFile_CorruptData(t *testing.T) {
 
 	// Try to decompress corrupted file
 	decompressPath := "test_corrupt_output.txt"
+	defer os.Remove(decompressPath)
 	err = internal.Decompress(compressedPath, decompressPath)
 
 	// should either error or produce incorrect output
 	if err == nil {
 		// if no error, verify it doesn't match original
-		defer os.Remove(decompressPath)
-
 		verifyErr := internal.VerifyDecompression(originalPath, decompressPath)
 		if verifyErr == nil {
 			t.Error("Corrupted file decompressed to correct output (unlikely!)")
@@ -269,6 +272,24 @@ func TestDecompresFile_CorruptData(t *testing.T) {
 	t.Logf("Corrupted file properly rejected or produced wrong output")
 }
 
+func TestDecodeSymbol_SingleCharacterDummyLeaf(t *testing.T) {
+	root, err := internal.BuildHuffmanTree(internal.FrequencyTable{'x': 3})
+	if err != nil {
+		t.Fatal("BuildHuffmanTree failed:", err)
+	}
+
+	// 'x' is coded as 0, a 1 bit leads to the dummy leaf
+	bitReader := internal.NewBitReader(bytes.NewReader([]byte{0x40}))
+	char, err := internal.DecodeSymbol(bitReader, root)
+	if err != nil || char != 'x' {
+		t.Fatalf("Expected 'x', got %q (%v)", char, err)
+	}
+	_, err = internal.DecodeSymbol(bitReader, root)
+	if err == nil {
+		t.Error("Expected error for a code reaching the dummy leaf, got nil")
+	}
+}
+
 // ============================================================
 // BITREADER UNIT TESTS
 // ============================================================
@@ -403,3 +424,37 @@ func TestDecompressFile_SpecialChars(t *testing.T) {
 		t.Fatal("Special characters not preserved:", err)
 	}
 }
+
+func TestDecompressFile_AllByteValuesRoundTrip(t *testing.T) {
+	// Every byte value, unevenly distributed
+	originalData := make([]byte, 0, 256*8)
+	for i := 0; i < 256; i++ {
+		originalData = append(originalData, bytes.Repeat([]byte{byte(i)}, 1+i%8)...)
+	}
+
+	originalPath := "test_roundtrip_allbytes.bin"
+	err := os.WriteFile(originalPath, originalData, 0644)
+	if err != nil {
+		t.Fatal("Failed to create original file:", err)
+	}
+	defer os.Remove(originalPath)
+
+	compressedPath := "test_roundtrip_allbytes.hf"
+	err = internal.CompressFile(originalPath, compressedPath)
+	if err != nil {
+		t.Fatal("Compression failed:", err)
+	}
+	defer os.Remove(compressedPath)
+
+	decompressedPath := "test_roundtrip_allbytes_decompressed.bin"
+	err = internal.Decompress(compressedPath, decompressedPath)
+	if err != nil {
+		t.Fatal("Decompression failed:", err)
+	}
+	defer os.Remove(decompressedPath)
+
+	err = internal.VerifyDecompression(originalPath, decompressedPath)
+	if err != nil {
+		t.Fatal("Verification failed:", err)
+	}
+}
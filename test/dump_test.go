@@ -0,0 +1,174 @@
+package test
+
+import (
+	"bytes"
+	"huffman-compressor/internal"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// symbolLine matches a symbol line of a dump: symbol, bit, byte.bit, char,
+// code and path. The char is quoted and may be a space.
+var symbolLine = regexp.MustCompile(`^\s+(\d+)\s+(\d+)\s+(\d+\.\d)\s+('.+'|\?)\s+(\S+)\s+(\S*)$`)
+
+// dumpSymbols returns the fields of the symbol lines of a dump
+func dumpSymbols(dump string) [][]string {
+	var symbols [][]string
+	for _, line := range strings.Split(dump, "\n") {
+		if match := symbolLine.FindStringSubmatch(line); match != nil {
+			symbols = append(symbols, match[1:])
+		}
+	}
+	return symbols
+}
+
+func TestDump_SymbolsFollowTheCodes(t *testing.T) {
+	data := []byte("abracadabra\n")
+	_, path := compressFile(t, data)
+	var output bytes.Buffer
+	err := internal.DumpFile(path, &output, 0, uint64(len(data)))
+	if err != nil {
+		t.Fatal("DumpFile failed:", err)
+	}
+	dump := output.String()
+
+	for _, field := range []string{"magic", "version", "flags", "padding bits", "original size", "compressed crc"} {
+		if !strings.Contains(dump, field) {
+			t.Errorf("Expected field %q in the dump:\n%s", field, dump)
+		}
+	}
+
+	_, codes := exportTree(t, string(data))
+	symbols := dumpSymbols(dump)
+	if len(symbols) != len(data) {
+		t.Fatalf("Expected %d symbols, got %d:\n%s", len(data), len(symbols), dump)
+	}
+	bit := 0
+	for i, fields := range symbols {
+		// symbol, bit, byte.bit, char, code, path
+		char := fields[3]
+		if want := "'" + internal.SymbolName(data[i]) + "'"; char != want {
+			t.Errorf("Symbol %d: expected %s, got %s", i, want, char)
+		}
+		if offset, _ := strconv.Atoi(fields[1]); offset != bit {
+			t.Errorf("Symbol %d: expected bit %d, got %s", i, bit, fields[1])
+		}
+		code := codes[data[i]]
+		if fields[4] != internal.CodeToString(code) {
+			t.Errorf("Symbol %d: expected code %s, got %s", i, internal.CodeToString(code), fields[4])
+		}
+		treePath := strings.NewReplacer("L", "0", "R", "1").Replace(fields[5])
+		if treePath != internal.CodeBits(code) {
+			t.Errorf("Symbol %d: path %s doesn't match the code bits %s", i, fields[5], internal.CodeBits(code))
+		}
+		bit += len(treePath)
+	}
+	if !strings.Contains(dump, "Padding: ") {
+		t.Errorf("Expected the padding to be explained:\n%s", dump)
+	}
+}
+
+func TestDump_Range(t *testing.T) {
+	data := bytes.Repeat([]byte("dump only a few symbols of a larger file. "), 200)
+	_, path := compressFile(t, data)
+	var output bytes.Buffer
+	err := internal.DumpFile(path, &output, 1000, 1010)
+	if err != nil {
+		t.Fatal("DumpFile failed:", err)
+	}
+
+	symbols := dumpSymbols(output.String())
+	if len(symbols) != 10 || symbols[0][0] != "1000" || symbols[9][0] != "1009" {
+		t.Fatalf("Expected symbols 1000-1009, got %v", symbols)
+	}
+	for i, fields := range symbols {
+		if want := "'" + internal.SymbolName(data[1000+i]) + "'"; fields[3] != want {
+			t.Errorf("Symbol %d: expected %s, got %s", 1000+i, want, fields[3])
+		}
+	}
+	// An end past the data is cut to it
+	output.Reset()
+	err = internal.DumpFile(path, &output, uint64(len(data))-2, 1<<40)
+	if err != nil || len(dumpSymbols(output.String())) != 2 {
+		t.Errorf("Expected the last 2 symbols, err %v", err)
+	}
+}
+
+func TestDump_Errors(t *testing.T) {
+	data := []byte("a truncated payload can't be dumped to the end")
+	_, path := compressFile(t, data)
+	compressed, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Cut into the payload, the symbols before the cut are still listed
+	cut := compressed[:len(compressed)-12]
+	var output bytes.Buffer
+	err = internal.Dump(bytes.NewReader(cut), &output, 0, uint64(len(data)))
+	if err == nil {
+		t.Error("Expected error for a truncated payload, got nil")
+	}
+	if len(dumpSymbols(output.String())) == 0 {
+		t.Errorf("Expected the symbols before the cut in the dump:\n%s", output.String())
+	}
+
+	// A stream cut into its second block keeps the first one
+	stream := compressStream(t, data, streamOptions{blockSize: 20, flags: internal.DefaultFlags})
+	output.Reset()
+	err = internal.Dump(bytes.NewReader(stream[:len(stream)-20]), &output, 0, uint64(len(data)))
+	if err == nil {
+		t.Error("Expected error for a truncated stream, got nil")
+	}
+	if len(dumpSymbols(output.String())) < 20 {
+		t.Errorf("Expected the symbols of the first block in the dump:\n%s", output.String())
+	}
+}
+
+func TestDump_Stream(t *testing.T) {
+	data := bytes.Repeat([]byte("every block of a stream has its own codes. "), 20)
+	stream := compressStream(t, data, streamOptions{blockSize: 300, flags: internal.DefaultFlags | internal.FlagIndex})
+	var output bytes.Buffer
+	err := internal.Dump(bytes.NewReader(stream), &output, 250, 350)
+	if err != nil {
+		t.Fatal("Dump failed:", err)
+	}
+	dump := output.String()
+
+	for _, field := range []string{"level", "original size", "compressed size", "code lengths", "end marker", "content crc", "Index: 4 entries"} {
+		if !strings.Contains(dump, field) {
+			t.Errorf("Expected %q in the dump:\n%s", field, dump)
+		}
+	}
+	if blocks := strings.Count(dump, " codes: canonical"); blocks != 3 {
+		t.Errorf("Expected the code tables of 3 blocks, got %d", blocks)
+	}
+
+	// The range spans the first two blocks, bits restart with each block
+	symbols := dumpSymbols(dump)
+	if len(symbols) != 100 || symbols[0][0] != "250" || symbols[99][0] != "349" {
+		t.Fatalf("Expected symbols 250-349, got %d:\n%s", len(symbols), dump)
+	}
+	for i, fields := range symbols {
+		if want := "'" + internal.SymbolName(data[250+i]) + "'"; fields[3] != want {
+			t.Errorf("Symbol %d: expected %s, got %s", 250+i, want, fields[3])
+		}
+	}
+	if symbols[50][1] != "0" {
+		t.Errorf("Expected symbol 300 at bit 0 of the second block, got bit %s", symbols[50][1])
+	}
+
+	// Blocks without code tables are shown without their symbols
+	stream = compressStream(t, data, streamOptions{level: 2, flags: internal.DefaultFlags})
+	output.Reset()
+	err = internal.Dump(bytes.NewReader(stream), &output, 0, uint64(len(data)))
+	if err != nil {
+		t.Fatal("Dump of an LZ77 stream failed:", err)
+	}
+	if !strings.Contains(output.String(), "lz77 coded") || len(dumpSymbols(output.String())) != 0 {
+		t.Errorf("Expected the LZ77 block without symbols:\n%s", output.String())
+	}
+}
@@ -0,0 +1,217 @@
+package test
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"huffman-compressor/internal"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func exportTree(t *testing.T, text string) (*internal.HuffmanNode, internal.CodeTable) {
+	t.Helper()
+	root, err := internal.BuildHuffmanTree(internal.CountFrequencies([]byte(text)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return root, internal.GenerateCodes(root)
+}
+
+// treePaths collects the path from the root to every leaf of the exported tree
+func treePaths(node *internal.TreeNode, path string, paths map[string]string) {
+	if node == nil {
+		return
+	}
+	if node.Symbol != nil {
+		paths[*node.Symbol] = path
+		return
+	}
+	treePaths(node.Left, path+"0", paths)
+	treePaths(node.Right, path+"1", paths)
+}
+
+func TestWriteCodesCSV(t *testing.T) {
+	root, codes := exportTree(t, "abracadabra \"quoted\"\n")
+	var output bytes.Buffer
+	err := internal.WriteCodesCSV(&output, root, codes)
+	if err != nil {
+		t.Fatal("WriteCodesCSV failed:", err)
+	}
+
+	records, err := csv.NewReader(&output).ReadAll()
+	if err != nil {
+		t.Fatal("Output is not valid CSV:", err)
+	}
+	if strings.Join(records[0], ",") != "symbol,byte,frequency,code,length" {
+		t.Errorf("Unexpected header %v", records[0])
+	}
+	if len(records) != len(codes)+1 {
+		t.Fatalf("Expected %d rows, got %d", len(codes), len(records)-1)
+	}
+	// Most frequent first
+	if records[1][0] != "a" || records[1][2] != "5" {
+		t.Errorf("Expected 'a' with frequency 5 first, got %v", records[1])
+	}
+	for _, record := range records[1:] {
+		length, err := strconv.Atoi(record[4])
+		if err != nil || len(record[3]) != length {
+			t.Errorf("Code %q doesn't have length %s", record[3], record[4])
+		}
+	}
+}
+
+func TestWriteCodesJSON_TreeMatchesCodes(t *testing.T) {
+	root, codes := exportTree(t, "the quick brown fox jumps over the lazy dog\n")
+	var output bytes.Buffer
+	err := internal.WriteCodesJSON(&output, root, codes)
+	if err != nil {
+		t.Fatal("WriteCodesJSON failed:", err)
+	}
+
+	var document struct {
+		Codes []internal.CodeEntry `json:"codes"`
+		Tree  *internal.TreeNode   `json:"tree"`
+	}
+	err = json.Unmarshal(output.Bytes(), &document)
+	if err != nil {
+		t.Fatal("Output is not valid JSON:", err)
+	}
+	if len(document.Codes) != len(codes) {
+		t.Fatalf("Expected %d codes, got %d", len(codes), len(document.Codes))
+	}
+
+	// Every code spells the path to its leaf
+	paths := make(map[string]string)
+	treePaths(document.Tree, "", paths)
+	for _, entry := range document.Codes {
+		if paths[entry.Symbol] != entry.Code {
+			t.Errorf("Symbol %q: code %s but tree path %s", entry.Symbol, entry.Code, paths[entry.Symbol])
+		}
+	}
+	if document.Tree.Frequency != 44 {
+		t.Errorf("Expected the root to count all 44 bytes, got %d", document.Tree.Frequency)
+	}
+}
+
+func TestWriteTreeDOT(t *testing.T) {
+	root, _ := exportTree(t, "aab\"\\")
+	var output bytes.Buffer
+	err := internal.WriteTreeDOT(&output, root)
+	if err != nil {
+		t.Fatal("WriteTreeDOT failed:", err)
+	}
+
+	dot := output.String()
+	if !strings.HasPrefix(dot, "digraph huffman {") || !strings.HasSuffix(dot, "}\n") {
+		t.Errorf("Not a digraph:\n%s", dot)
+	}
+	// 4 leaves and 3 internal nodes
+	if edges := strings.Count(dot, " -> "); edges != 6 {
+		t.Errorf("Expected 6 edges, got %d", edges)
+	}
+	for _, label := range []string{`'a'\n2`, `'\\\"'`, `'\\\\'`} {
+		if !strings.Contains(dot, label) {
+			t.Errorf("Expected label %s in:\n%s", label, dot)
+		}
+	}
+}
+
+func TestExport_SingleSymbol(t *testing.T) {
+	root, codes := exportTree(t, "zzzz")
+	entries := internal.CodeEntries(root, codes)
+	if len(entries) != 1 || entries[0].Symbol != "z" || entries[0].Frequency != 4 || entries[0].Length != 1 {
+		t.Errorf("Unexpected entries for a single symbol: %+v", entries)
+	}
+
+	var output bytes.Buffer
+	err := internal.WriteTreeDOT(&output, root)
+	if err != nil {
+		t.Fatal("WriteTreeDOT failed:", err)
+	}
+	if edges := strings.Count(output.String(), " -> "); edges != 1 {
+		t.Errorf("Expected only the edge to the real leaf, got %d", edges)
+	}
+}
+
+func TestFileCodes_CompressedMatchesOriginal(t *testing.T) {
+	inputPath, compressedPath := compressFile(t, bytes.Repeat([]byte("inspect the codes of a file. "), 100))
+
+	root, codes, err := internal.FileCodes(inputPath, 0)
+	if err != nil {
+		t.Fatal("FileCodes of the input failed:", err)
+	}
+	storedRoot, storedCodes, err := internal.FileCodes(compressedPath, 0)
+	if err != nil {
+		t.Fatal("FileCodes of the .hf file failed:", err)
+	}
+	expected, got := internal.CodeEntries(root, codes), internal.CodeEntries(storedRoot, storedCodes)
+	if len(expected) != len(got) {
+		t.Fatalf("Expected %d codes, got %d", len(expected), len(got))
+	}
+	for i := range expected {
+		if expected[i] != got[i] {
+			t.Errorf("Code %d: expected %+v, got %+v", i, expected[i], got[i])
+		}
+	}
+}
+
+func TestStreamCodes_Block(t *testing.T) {
+	data := append(bytes.Repeat([]byte("first block "), 100), bytes.Repeat([]byte("then another one. "), 100)...)
+	compressed := compressStream(t, data, streamOptions{blockSize: 1200, flags: internal.DefaultFlags})
+
+	root, codes, err := internal.StreamCodes(bytes.NewReader(compressed), 1)
+	if err != nil {
+		t.Fatal("StreamCodes failed:", err)
+	}
+	frequencies := internal.CountFrequencies(data[1200:2400])
+	entries := internal.CodeEntries(root, codes)
+	if len(entries) != len(frequencies) {
+		t.Fatalf("Expected %d codes, got %d", len(frequencies), len(entries))
+	}
+	paths := make(map[string]string)
+	treePaths(internal.ExportTree(root), "", paths)
+	for _, entry := range entries {
+		if entry.Frequency != frequencies[entry.Byte] {
+			t.Errorf("'%s': expected frequency %d, got %d", entry.Symbol, frequencies[entry.Byte], entry.Frequency)
+		}
+		if paths[entry.Symbol] != entry.Code || len(entry.Code) != entry.Length {
+			t.Errorf("'%s': code %s of length %d, tree path %s", entry.Symbol, entry.Code, entry.Length, paths[entry.Symbol])
+		}
+	}
+	if root.GetFreq() != 1200 {
+		t.Errorf("Expected the root to count 1200 symbols, got %d", root.GetFreq())
+	}
+
+	_, _, err = internal.StreamCodes(bytes.NewReader(compressed), 3)
+	if err == nil || !strings.Contains(err.Error(), "out of range") {
+		t.Errorf("Expected an out of range error for block 3 of 3, got %v", err)
+	}
+}
+
+func TestStreamCodes_BlockWithoutCodeTable(t *testing.T) {
+	data := bytes.Repeat([]byte("no code table here. "), 50)
+	tests := []struct {
+		name    string
+		options streamOptions
+		mode    byte
+	}{
+		{"adaptive", streamOptions{flags: internal.DefaultFlags | internal.FlagAdaptive}, internal.BlockAdaptive},
+		{"lz77", streamOptions{level: 2, flags: internal.DefaultFlags}, internal.BlockLZ77},
+	}
+
+	for _, test := range tests {
+		compressed := compressStream(t, data, test.options)
+		_, _, err := internal.StreamCodes(bytes.NewReader(compressed), 0)
+		var modeErr *internal.BlockModeError
+		if !errors.As(err, &modeErr) {
+			t.Errorf("%s: expected a BlockModeError, got %v", test.name, err)
+			continue
+		}
+		if modeErr.Block != 0 || modeErr.Mode != test.mode {
+			t.Errorf("%s: expected block 0 with mode %d, got %+v", test.name, test.mode, modeErr)
+		}
+	}
+}
@@ -0,0 +1,242 @@
+package test
+
+import (
+	"errors"
+	"huffman-compressor/internal"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type archiveFixture struct {
+	entry    internal.ArchiveEntry
+	contents string
+}
+
+// writeArchive writes an archive with fixtures as they are, including
+// paths the extractor has to refuse
+func writeArchive(t *testing.T, dir string, fixtures []archiveFixture) string {
+	t.Helper()
+
+	archivePath := filepath.Join(dir, "fixture.hfa")
+	file, err := os.Create(archivePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	writer, err := internal.NewArchiveWriter(file, internal.MinLevel)
+	if err != nil {
+		t.Fatal("NewArchiveWriter failed:", err)
+	}
+	for _, fixture := range fixtures {
+		if fixture.entry.Mode == 0 {
+			fixture.entry.Mode = 0o644
+		}
+		err = writer.Add(fixture.entry, strings.NewReader(fixture.contents))
+		if err != nil {
+			t.Fatal("Add failed:", err)
+		}
+	}
+	err = writer.Close()
+	if err != nil {
+		t.Fatal("Close failed:", err)
+	}
+	return archivePath
+}
+
+func fileFixture(path, contents string) archiveFixture {
+	return archiveFixture{entry: internal.ArchiveEntry{Path: path}, contents: contents}
+}
+
+func symlinkFixture(path, target string) archiveFixture {
+	return archiveFixture{entry: internal.ArchiveEntry{Path: path, Type: internal.EntrySymlink, Mode: 0o777, Link: target}}
+}
+
+func TestExtract_RefusesUnsafePaths(t *testing.T) {
+	testCases := []struct {
+		name    string
+		fixture archiveFixture
+	}{
+		{"ParentDirectory", fileFixture("../evil.txt", "evil")},
+		{"NestedParentDirectory", fileFixture("ok/../../evil.txt", "evil")},
+		{"AbsolutePath", fileFixture("/tmp/evil.txt", "evil")},
+		{"SymlinkOutside", symlinkFixture("link", "../outside")},
+		{"SymlinkAbsolute", symlinkFixture("link", "/etc/passwd")},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			work := t.TempDir()
+			archivePath := writeArchive(t, work, []archiveFixture{fileFixture("good.txt", "good"), tc.fixture})
+			dest := filepath.Join(work, "dest", "inner")
+
+			err := internal.ExtractArchive(archivePath, dest, nil, internal.ExtractOptions{})
+			var unsafe *internal.UnsafePathError
+			if !errors.As(err, &unsafe) {
+				t.Fatalf("Expected UnsafePathError, got %v", err)
+			}
+
+			// Unsafe paths are found before anything is written
+			if _, err := os.Stat(dest); !errors.Is(err, os.ErrNotExist) {
+				t.Error("Expected nothing to be extracted")
+			}
+			if _, err := os.Lstat(filepath.Join(work, "dest", "evil.txt")); err == nil {
+				t.Error("Entry was written outside the destination")
+			}
+		})
+	}
+}
+
+func TestExtract_SkipPolicy(t *testing.T) {
+	work := t.TempDir()
+	archivePath := writeArchive(t, work, []archiveFixture{
+		fileFixture("../evil.txt", "evil"),
+		fileFixture("good.txt", "good"),
+		symlinkFixture("escape", "../../etc"),
+	})
+	dest := filepath.Join(work, "dest")
+
+	var skipped []string
+	options := internal.ExtractOptions{
+		Policy: internal.ExtractSkip,
+		Notify: func(entry internal.ArchiveEntry, name string, err error) {
+			if name != "" {
+				t.Errorf("Expected %s to be skipped, got renamed to %s", entry.Path, name)
+			}
+			skipped = append(skipped, entry.Path)
+		},
+	}
+	err := internal.ExtractArchive(archivePath, dest, nil, options)
+	if err != nil {
+		t.Fatal("ExtractArchive failed:", err)
+	}
+
+	if len(skipped) != 2 || skipped[0] != "../evil.txt" || skipped[1] != "escape" {
+		t.Errorf("Expected ../evil.txt and escape to be skipped, got %v", skipped)
+	}
+	if data, err := os.ReadFile(filepath.Join(dest, "good.txt")); err != nil || string(data) != "good" {
+		t.Errorf("Expected good.txt to be extracted: %v", err)
+	}
+	if _, err := os.Lstat(filepath.Join(work, "evil.txt")); err == nil {
+		t.Error("Entry was written outside the destination")
+	}
+}
+
+func TestExtract_RenamePolicy(t *testing.T) {
+	work := t.TempDir()
+	archivePath := writeArchive(t, work, []archiveFixture{
+		fileFixture("../../evil.txt", "stripped"),
+		fileFixture("/abs/file.txt", "absolute"),
+	})
+	dest := filepath.Join(work, "dest")
+
+	err := internal.ExtractArchive(archivePath, dest, nil, internal.ExtractOptions{Policy: internal.ExtractRename})
+	if err != nil {
+		t.Fatal("ExtractArchive failed:", err)
+	}
+
+	for name, contents := range map[string]string{"evil.txt": "stripped", "abs/file.txt": "absolute"} {
+		data, err := os.ReadFile(filepath.Join(dest, filepath.FromSlash(name)))
+		if err != nil || string(data) != contents {
+			t.Errorf("Expected %s to hold %q: %v", name, contents, err)
+		}
+	}
+}
+
+func TestExtract_Duplicates(t *testing.T) {
+	work := t.TempDir()
+	// "./dup.txt" cleans to the same path as "dup.txt"
+	archivePath := writeArchive(t, work, []archiveFixture{
+		fileFixture("dup.txt", "first"),
+		fileFixture("./dup.txt", "second"),
+	})
+
+	err := internal.ExtractArchive(archivePath, filepath.Join(work, "error"), nil, internal.ExtractOptions{})
+	var duplicate *internal.DuplicateEntryError
+	if !errors.As(err, &duplicate) || duplicate.Path != "dup.txt" {
+		t.Errorf("Expected DuplicateEntryError for dup.txt, got %v", err)
+	}
+
+	dest := filepath.Join(work, "skip")
+	err = internal.ExtractArchive(archivePath, dest, nil, internal.ExtractOptions{Policy: internal.ExtractSkip})
+	if err != nil {
+		t.Fatal("ExtractArchive failed:", err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dest, "dup.txt")); string(data) != "first" {
+		t.Errorf("Expected the first entry to win with skip, got %q", data)
+	}
+
+	dest = filepath.Join(work, "rename")
+	err = internal.ExtractArchive(archivePath, dest, nil, internal.ExtractOptions{Policy: internal.ExtractRename})
+	if err != nil {
+		t.Fatal("ExtractArchive failed:", err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dest, "dup.txt")); string(data) != "first" {
+		t.Errorf("Expected dup.txt to hold the first entry, got %q", data)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dest, "dup.txt.1")); string(data) != "second" {
+		t.Errorf("Expected dup.txt.1 to hold the second entry, got %q", data)
+	}
+}
+
+func TestExtract_SymlinkChainOutside(t *testing.T) {
+	work := t.TempDir()
+	// Each link looks harmless on its own, together they lead outside
+	archivePath := writeArchive(t, work, []archiveFixture{
+		{entry: internal.ArchiveEntry{Path: "a/b", Type: internal.EntryDir, Mode: 0o755}},
+		symlinkFixture("a/b/up", "../.."),
+		symlinkFixture("escape", "a/b/up/../.."),
+	})
+	dest := filepath.Join(work, "dest")
+
+	err := internal.ExtractArchive(archivePath, dest, nil, internal.ExtractOptions{})
+	var unsafe *internal.UnsafePathError
+	if !errors.As(err, &unsafe) || unsafe.Path != "escape" {
+		t.Fatalf("Expected UnsafePathError for escape, got %v", err)
+	}
+	if _, err := os.Lstat(filepath.Join(dest, "escape")); err == nil {
+		t.Error("Expected escape not to be created")
+	}
+}
+
+func TestExtract_ExistingSymlinkInDestination(t *testing.T) {
+	work := t.TempDir()
+	outside := filepath.Join(work, "outside")
+	err := os.Mkdir(outside, 0o755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dest := filepath.Join(work, "dest")
+	err = os.Mkdir(dest, 0o755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.Symlink(outside, filepath.Join(dest, "planted"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	archivePath := writeArchive(t, work, []archiveFixture{fileFixture("planted/file.txt", "through the link")})
+	err = internal.ExtractArchive(archivePath, dest, nil, internal.ExtractOptions{})
+	var unsafe *internal.UnsafePathError
+	if !errors.As(err, &unsafe) {
+		t.Fatalf("Expected UnsafePathError, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(outside, "file.txt")); err == nil {
+		t.Error("Entry was written through a symlink to outside the destination")
+	}
+}
+
+func TestParseExtractPolicy(t *testing.T) {
+	for _, policy := range []internal.ExtractPolicy{internal.ExtractError, internal.ExtractSkip, internal.ExtractRename} {
+		parsed, err := internal.ParseExtractPolicy(policy.String())
+		if err != nil || parsed != policy {
+			t.Errorf("ParseExtractPolicy(%q) = %v, %v", policy.String(), parsed, err)
+		}
+	}
+	if _, err := internal.ParseExtractPolicy("overwrite"); err == nil {
+		t.Error("Expected error for an unknown policy, got nil")
+	}
+}
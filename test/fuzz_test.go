@@ -0,0 +1,124 @@
+package test
+
+import (
+	"bytes"
+	"huffman-compressor/internal"
+	"io"
+	"os"
+	"testing"
+)
+
+// Fuzz targets: run with e.g. go test ./test -fuzz=FuzzDecompress. Without
+// -fuzz they only run their seed corpus. Any input may fail to decode, but
+// none may panic or hang.
+
+// fuzzSeeds returns compressed samples in every format the decoder reads
+func fuzzSeeds(t testing.TB) [][]byte {
+	t.Helper()
+
+	data := []byte("abracadabra, abracadabra, a fuzzed cadabra")
+	var seeds [][]byte
+
+	var header bytes.Buffer
+	err := internal.WriteHeader(&header, internal.FrequencyTable{'a': 3, 'b': 1}, 4, 2)
+	if err != nil {
+		t.Fatal("WriteHeader failed:", err)
+	}
+	seeds = append(seeds, append(header.Bytes(), 0x1c))
+
+	_, compressedPath := compressFile(t, data)
+	file, err := os.ReadFile(compressedPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seeds = append(seeds, file)
+
+	for level := internal.MinLevel; level <= internal.MaxLevel; level += 4 {
+		seeds = append(seeds, compressStream(t, data, streamOptions{level: level, flags: internal.DefaultFlags}))
+	}
+	return append(seeds,
+		compressStream(t, data, streamOptions{flags: internal.FlagAdaptive}),
+		compressStream(t, data, streamOptions{blockSize: 16, level: 1, flags: internal.DefaultFlags | internal.FlagIndex}),
+	)
+}
+
+func FuzzReadHeader(f *testing.F) {
+	for _, seed := range fuzzSeeds(f) {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		header, err := internal.ReadHeader(bytes.NewReader(data))
+		if err != nil {
+			return
+		}
+		if int(header.NumChars) != len(header.FreqTable) {
+			t.Errorf("NumChars %d, but %d entries", header.NumChars, len(header.FreqTable))
+		}
+		for char, freq := range header.FreqTable {
+			if freq <= 0 {
+				t.Errorf("Character %d has frequency %d", char, freq)
+			}
+		}
+	})
+}
+
+func FuzzBitReader(f *testing.F) {
+	f.Add([]byte{0xA5, 0x0F}, []byte{1, 3, 8, 64})
+	f.Add([]byte{}, []byte{0, 10})
+
+	f.Fuzz(func(t *testing.T, data []byte, steps []byte) {
+		bitReader := internal.NewBitReader(bytes.NewReader(data))
+		consumed := 0
+		for _, step := range steps {
+			// Step 0 reads a single bit, others peek up to MaxPeekBits
+			n := int(step) % (internal.MaxPeekBits + 1)
+			if n == 0 {
+				if _, err := bitReader.ReadBit(); err == nil {
+					consumed++
+				}
+				continue
+			}
+
+			_, available := bitReader.PeekBits(n)
+			if available > n {
+				t.Fatalf("PeekBits(%d) reported %d bits", n, available)
+			}
+			bitReader.SkipBits(available)
+			consumed += available
+		}
+		if consumed > 8*len(data) {
+			t.Errorf("Consumed %d bits from %d bytes", consumed, len(data))
+		}
+	})
+}
+
+func FuzzDecompress(f *testing.F) {
+	for _, seed := range fuzzSeeds(f) {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		// The limit keeps a header claiming terabytes from taking forever
+		reader, err := internal.NewLimitedReader(bytes.NewReader(data), internal.DecodeLimits{MaxOutputSize: 1 << 20})
+		if err != nil {
+			return
+		}
+		io.Copy(io.Discard, reader)
+	})
+}
+
+func FuzzSeekableReader(f *testing.F) {
+	for _, seed := range fuzzSeeds(f) {
+		f.Add(seed, int64(20))
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte, offset int64) {
+		reader, err := internal.NewSeekableReader(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			return
+		}
+		reader.ReadAt(make([]byte, 64), offset)
+		io.CopyN(io.Discard, reader, 1<<20)
+	})
+}
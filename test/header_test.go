@@ -2,7 +2,9 @@ package test
 
 import (
 	"bytes"
+	"errors"
 	"huffman-compressor/internal"
+	"io"
 	"testing"
 )
 
@@ -32,7 +34,7 @@ func TestWriteAndReadHeader(t *testing.T) {
 	if header.OriginalSize != originalSize {
 		t.Errorf("OriginalSize mismatch: got %d, want %d", header.OriginalSize, originalSize)
 	}
-	if header.NumChars != uint8(len(freqTable)) {
+	if header.NumChars != uint16(len(freqTable)) {
 		t.Errorf("NumChars mismatch: got %d, want %d", header.NumChars, len(freqTable))
 	}
 	if header.PaddingBits != paddingBits {
@@ -127,3 +129,221 @@ func TestSingleCharacter(t *testing.T) {
 	}
 
 }
+
+func TestWriteAndReadHeaderV2_AllByteValues(t *testing.T) {
+	freqTable := make(internal.FrequencyTable)
+	for i := 0; i < 256; i++ {
+		freqTable[byte(i)] = i + 1
+	}
+	// A frequency that needs more than 32 bits
+	freqTable['x'] = 5 << 32
+
+	var buffer bytes.Buffer
+	err := internal.WriteHeaderV2(&buffer, freqTable, 1<<40, 5, 0)
+	if err != nil {
+		t.Fatal("Failed to write header:", err)
+	}
+
+	if buffer.Len() != internal.CalculateHeaderSizeV2(freqTable, 1<<40) {
+		t.Errorf("Header size mismatch: wrote %d, calculated %d",
+			buffer.Len(), internal.CalculateHeaderSizeV2(freqTable, 1<<40))
+	}
+
+	header, err := internal.ReadHeader(&buffer)
+	if err != nil {
+		t.Fatal("Failed to read header:", err)
+	}
+
+	if header.Version != internal.HeaderVersion2 {
+		t.Errorf("Expected version %d, got %d", internal.HeaderVersion2, header.Version)
+	}
+	if header.NumChars != 256 {
+		t.Errorf("Expected 256 unique chars, got %d", header.NumChars)
+	}
+	if header.OriginalSize != 1<<40 {
+		t.Errorf("OriginalSize mismatch: got %d", header.OriginalSize)
+	}
+	if header.PaddingBits != 5 {
+		t.Errorf("PaddingBits mismatch: got %d", header.PaddingBits)
+	}
+	for char, freq := range freqTable {
+		if header.FreqTable[char] != freq {
+			t.Errorf("Frequency of %d: got %d, want %d", char, header.FreqTable[char], freq)
+		}
+	}
+}
+
+func TestReadHeader_Version1StillSupported(t *testing.T) {
+	freqTable := internal.FrequencyTable{'a': 3, 'b': 1}
+
+	var buffer bytes.Buffer
+	err := internal.WriteHeader(&buffer, freqTable, 4, 2)
+	if err != nil {
+		t.Fatal("Failed to write header:", err)
+	}
+
+	header, err := internal.ReadHeader(&buffer)
+	if err != nil {
+		t.Fatal("Failed to read header:", err)
+	}
+
+	if header.Version != internal.HeaderVersion1 {
+		t.Errorf("Expected version %d, got %d", internal.HeaderVersion1, header.Version)
+	}
+	if header.OriginalSize != 4 || header.PaddingBits != 2 || header.FreqTable['a'] != 3 {
+		t.Errorf("Unexpected header contents: %+v", header)
+	}
+}
+
+func TestWriteHeader_RejectsValuesV1CannotHold(t *testing.T) {
+	allBytes := make(internal.FrequencyTable)
+	for i := 0; i < 256; i++ {
+		allBytes[byte(i)] = 1
+	}
+
+	var buffer bytes.Buffer
+	err := internal.WriteHeader(&buffer, allBytes, 256, 0)
+	if err == nil {
+		t.Error("Expected error for 256 unique chars in a version 1 header, got nil")
+	}
+
+	err = internal.WriteHeader(&buffer, internal.FrequencyTable{'a': 1 << 33}, 1<<33, 0)
+	if err == nil {
+		t.Error("Expected error for frequency above 4 GiB in a version 1 header, got nil")
+	}
+}
+
+func TestReadHeader_UnsupportedVersion(t *testing.T) {
+	buffer := bytes.NewBuffer([]byte{'H', 'F', 9, 0, 0, 0})
+
+	_, err := internal.ReadHeader(buffer)
+	if err == nil {
+		t.Fatal("Expected error for unknown header version, got nil")
+	}
+
+	var versionErr *internal.UnsupportedVersionError
+	if !errors.As(err, &versionErr) {
+		t.Fatalf("Expected UnsupportedVersionError, got %T: %v", err, err)
+	}
+	if versionErr.Version != 9 {
+		t.Errorf("Expected version 9 in error, got %d", versionErr.Version)
+	}
+}
+
+func TestReadHeader_UnsupportedFlags(t *testing.T) {
+	var buffer bytes.Buffer
+	err := internal.WriteHeaderV2(&buffer, internal.FrequencyTable{'a': 1}, 1, 7, 0)
+	if err != nil {
+		t.Fatal("Failed to write header:", err)
+	}
+
+	// Set a flag no version of the format defines yet
+	data := buffer.Bytes()
+	data[3] = 0x80
+
+	_, err = internal.ReadHeader(bytes.NewReader(data))
+	var featureErr *internal.UnsupportedFeatureError
+	if !errors.As(err, &featureErr) {
+		t.Fatalf("Expected UnsupportedFeatureError, got %T: %v", err, err)
+	}
+	if featureErr.Flags != 0x80 {
+		t.Errorf("Expected unknown flags 0x80, got %#x", featureErr.Flags)
+	}
+}
+
+func TestWriteHeaderV2_RejectsUnknownFlags(t *testing.T) {
+	var buffer bytes.Buffer
+	err := internal.WriteHeaderV2(&buffer, internal.FrequencyTable{'a': 1}, 1, 0, 0x80)
+	if err == nil {
+		t.Error("Expected error for unknown flags, got nil")
+	}
+}
+
+func TestReadHeader_VersionAndFlagsFields(t *testing.T) {
+	var buffer bytes.Buffer
+	err := internal.WriteHeaderV2(&buffer, internal.FrequencyTable{'a': 2, 'b': 1}, 3, 6, 0)
+	if err != nil {
+		t.Fatal("Failed to write header:", err)
+	}
+
+	data := buffer.Bytes()
+	if data[2] != internal.HeaderVersion2 {
+		t.Errorf("Expected version byte %d at offset 2, got %d", internal.HeaderVersion2, data[2])
+	}
+	if data[internal.HeaderV2PaddingOffset] != 6 {
+		t.Errorf("Expected padding at offset %d, got %d", internal.HeaderV2PaddingOffset, data[internal.HeaderV2PaddingOffset])
+	}
+
+	header, err := internal.ReadHeader(&buffer)
+	if err != nil {
+		t.Fatal("Failed to read header:", err)
+	}
+	if header.Flags != 0 || header.PaddingBits != 6 {
+		t.Errorf("Unexpected flags %d or padding %d", header.Flags, header.PaddingBits)
+	}
+}
+
+func TestReadHeader_RejectsMalformedEntries(t *testing.T) {
+	// Version 2: [HF][2][Flags][Padding][OrigSize][NumChars:2][char+freq]...
+	testCases := []struct {
+		name   string
+		data   []byte
+		offset int64
+	}{
+		{"ZeroFrequency", []byte{'H', 'F', 2, 0, 0, 3, 0, 2, 'a', 3, 'b', 0}, 10},
+		{"DuplicateCharacter", []byte{'H', 'F', 2, 0, 0, 4, 0, 2, 'a', 2, 'a', 2}, 10},
+		{"TooManyCharacters", []byte{'H', 'F', 2, 0, 0, 1, 1, 1}, 6},
+		{"PaddingBits", []byte{'H', 'F', 2, 0, 8, 1, 0, 1, 'a', 1}, 4},
+		{"TruncatedEntries", []byte{'H', 'F', 2, 0, 0, 3, 0, 2, 'a', 3}, 10},
+		{"TruncatedVarint", []byte{'H', 'F', 2, 0, 0, 0x80}, 6},
+		{"VersionOneZeroFrequency", []byte{'H', 'F', 0, 0, 0, 0, 0, 0, 0, 1, 1, 0, 'a', 0, 0, 0, 0}, 12},
+		{"VersionOneTruncated", []byte{'H', 'F', 0, 0, 0, 0, 0, 0, 0, 1, 1, 0, 'a', 0}, 14},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := internal.ReadHeader(bytes.NewReader(tc.data))
+			var formatErr *internal.FormatError
+			if !errors.As(err, &formatErr) {
+				t.Fatalf("Expected FormatError, got %v", err)
+			}
+			if formatErr.Offset != tc.offset {
+				t.Errorf("Expected offset %d, got %d (%v)", tc.offset, formatErr.Offset, err)
+			}
+		})
+	}
+}
+
+func TestReadHeader_TruncatedIsUnexpectedEOF(t *testing.T) {
+	var buffer bytes.Buffer
+	err := internal.WriteHeaderV2(&buffer, internal.FrequencyTable{'a': 2, 'b': 1}, 3, 0, 0)
+	if err != nil {
+		t.Fatal("Failed to write header:", err)
+	}
+
+	data := buffer.Bytes()
+	for size := len(internal.MagicNumber) + 1; size < len(data); size++ {
+		_, err := internal.ReadHeader(bytes.NewReader(data[:size]))
+		if !errors.Is(err, io.ErrUnexpectedEOF) {
+			t.Errorf("Header cut to %d bytes: expected io.ErrUnexpectedEOF, got %v", size, err)
+		}
+	}
+}
+
+func TestDecompress_RejectsFrequenciesNotMatchingSize(t *testing.T) {
+	var file bytes.Buffer
+	err := internal.WriteHeaderV2(&file, internal.FrequencyTable{'a': 2, 'b': 1}, 10, 0, 0)
+	if err != nil {
+		t.Fatal("Failed to write header:", err)
+	}
+	file.Write([]byte{0x55, 0x55})
+
+	_, err = internal.NewFileReader(bytes.NewReader(file.Bytes()))
+	var formatErr *internal.FormatError
+	if !errors.As(err, &formatErr) {
+		t.Fatalf("Expected FormatError, got %v", err)
+	}
+	if formatErr.Offset != internal.HeaderV2PaddingOffset+1 {
+		t.Errorf("Expected the error at the original size field, got offset %d", formatErr.Offset)
+	}
+}
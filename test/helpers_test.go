@@ -0,0 +1,49 @@
+package test
+
+import (
+	"bytes"
+	"huffman-compressor/internal"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// streamOptions configure compressStream. A zero blockSize is
+// DefaultBlockSize, a zero level leaves the coding to flags, and flags are
+// used as given, 0 included.
+type streamOptions struct {
+	blockSize int
+	level     int
+	flags     uint8
+	workers   int
+}
+
+// compressStream compresses data in one go into a framed stream
+func compressStream(t testing.TB, data []byte, options streamOptions) []byte {
+	t.Helper()
+	var compressed bytes.Buffer
+	err := internal.CompressStreamWorkers(bytes.NewReader(data), &compressed,
+		options.blockSize, options.level, options.flags, max(options.workers, 1))
+	if err != nil {
+		t.Fatalf("Compressing a stream with %+v failed: %v", options, err)
+	}
+	return compressed.Bytes()
+}
+
+// compressFile writes data to a file in a temporary directory and compresses
+// it with CompressFile into a single-table .hf file. It returns both paths.
+func compressFile(t testing.TB, data []byte) (string, string) {
+	t.Helper()
+	dir := t.TempDir()
+	inputPath := filepath.Join(dir, "input.txt")
+	err := os.WriteFile(inputPath, data, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	compressedPath := filepath.Join(dir, "input.hf")
+	err = internal.CompressFile(inputPath, compressedPath)
+	if err != nil {
+		t.Fatal("CompressFile failed:", err)
+	}
+	return inputPath, compressedPath
+}
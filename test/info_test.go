@@ -0,0 +1,116 @@
+package test
+
+import (
+	"bytes"
+	"errors"
+	"huffman-compressor/internal"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCompressedInfo_File(t *testing.T) {
+	dir := t.TempDir()
+	inputPath := filepath.Join(dir, "input.txt")
+	data := strings.Repeat("info reads headers only. ", 200)
+	err := os.WriteFile(inputPath, []byte(data), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	compressedPath := filepath.Join(dir, "input.hf")
+	err = internal.CompressFile(inputPath, compressedPath)
+	if err != nil {
+		t.Fatal("CompressFile failed:", err)
+	}
+
+	info, err := internal.GetCompressedInfo(compressedPath)
+	if err != nil {
+		t.Fatal("GetCompressedInfo failed:", err)
+	}
+	fileInfo, err := os.Stat(compressedPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if info.Format != "file" || info.Version != internal.HeaderVersion2 {
+		t.Errorf("Unexpected format %s version %d", info.Format, info.Version)
+	}
+	if info.OriginalSize != uint64(len(data)) {
+		t.Errorf("Expected original size %d, got %d", len(data), info.OriginalSize)
+	}
+	if info.Symbols != len(internal.CountFrequencies([]byte(data))) {
+		t.Errorf("Unexpected symbol count %d", info.Symbols)
+	}
+	if info.CompressedSize != uint64(fileInfo.Size()) {
+		t.Errorf("Expected compressed size %d, got %d", fileInfo.Size(), info.CompressedSize)
+	}
+	if info.HeaderSize+info.PayloadSize+info.TrailerSize != info.CompressedSize {
+		t.Errorf("Parts don't add up: %+v", info)
+	}
+	if info.TrailerSize != uint64(internal.TrailerSize(internal.DefaultFlags)) {
+		t.Errorf("Unexpected trailer size %d", info.TrailerSize)
+	}
+}
+
+func TestCompressedInfo_Stream(t *testing.T) {
+	data := bytes.Repeat([]byte("blocks are skipped, not decoded\n"), 1000)
+	var compressed bytes.Buffer
+	err := internal.CompressStreamLevel(bytes.NewReader(data), &compressed, 4096, 9, internal.DefaultFlags|internal.FlagSHA256)
+	if err != nil {
+		t.Fatal("CompressStreamLevel failed:", err)
+	}
+
+	info, err := internal.ReadCompressedInfo(bytes.NewReader(compressed.Bytes()))
+	if err != nil {
+		t.Fatal("ReadCompressedInfo failed:", err)
+	}
+	if info.Format != "stream" || info.Level != 9 {
+		t.Errorf("Unexpected format %s level %d", info.Format, info.Level)
+	}
+	if info.Blocks != (len(data)+4095)/4096 {
+		t.Errorf("Expected %d blocks, got %d", (len(data)+4095)/4096, info.Blocks)
+	}
+	if info.OriginalSize != uint64(len(data)) || info.CompressedSize != uint64(compressed.Len()) {
+		t.Errorf("Unexpected sizes %+v", info)
+	}
+	if info.HeaderSize+info.PayloadSize+info.TrailerSize != info.CompressedSize {
+		t.Errorf("Parts don't add up: %+v", info)
+	}
+	if names := internal.FlagNames(info.Flags); names != "crc32,sha256,block-modes" {
+		t.Errorf("Unexpected flag names %q", names)
+	}
+
+	// A truncated stream still reports the headers it has
+	cut := compressed.Bytes()[:compressed.Len()/2]
+	info, err = internal.ReadCompressedInfo(bytes.NewReader(cut))
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("Expected io.ErrUnexpectedEOF for a truncated stream, got %v", err)
+	}
+	if info.Format != "stream" || info.Level != 9 || info.Blocks == 0 {
+		t.Errorf("Expected the intact blocks to be counted, got %+v", info)
+	}
+
+	// Trailing garbage isn't part of the stream
+	_, err = internal.ReadCompressedInfo(io.MultiReader(bytes.NewReader(compressed.Bytes()), strings.NewReader("junk")))
+	if err == nil {
+		t.Error("Expected error for data after the trailer, got nil")
+	}
+}
+
+func TestBenchmark_RoundTrip(t *testing.T) {
+	data := bytes.Repeat([]byte("benchmark data "), 2000)
+	for _, level := range []int{1, 9} {
+		result, err := internal.Benchmark(data, level, 0, 2)
+		if err != nil {
+			t.Fatalf("Benchmark at level %d failed: %v", level, err)
+		}
+		if result.OriginalSize != len(data) || result.CompressedSize == 0 || result.CompressedSize >= len(data) {
+			t.Errorf("Level %d: unexpected sizes %+v", level, result)
+		}
+		if result.CompressSpeed() <= 0 || result.DecompressSpeed() <= 0 {
+			t.Errorf("Level %d: expected positive throughput, got %+v", level, result)
+		}
+	}
+}
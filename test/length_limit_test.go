@@ -0,0 +1,173 @@
+package test
+
+import (
+	"bytes"
+	"huffman-compressor/internal"
+	"testing"
+)
+
+// fibonacciFrequencies gives the most skewed tree possible: every merge
+// pairs the previous subtree with the next symbol
+func fibonacciFrequencies(n int) internal.FrequencyTable {
+	freqTable := make(internal.FrequencyTable)
+	a, b := 1, 1
+	for i := 0; i < n; i++ {
+		freqTable[byte(i)] = a
+		a, b = b, a+b
+	}
+	return freqTable
+}
+
+func kraftSumFits(lengths []uint8) bool {
+	return internal.ValidateCodeLengths(lengths) == nil
+}
+
+func TestTreeDepth_Fibonacci(t *testing.T) {
+	root, err := internal.BuildHuffmanTree(fibonacciFrequencies(30))
+	if err != nil {
+		t.Fatal("BuildHuffmanTree failed:", err)
+	}
+
+	if depth := internal.TreeDepth(root); depth != 29 {
+		t.Errorf("Expected depth 29 for 30 Fibonacci frequencies, got %d", depth)
+	}
+}
+
+func TestPackageMerge_RespectsLimit(t *testing.T) {
+	freqTable := fibonacciFrequencies(30)
+	freqs := make([]int, 256)
+	for char, freq := range freqTable {
+		freqs[char] = freq
+	}
+
+	for _, maxLength := range []int{5, 8, 15, 24} {
+		lengths, err := internal.PackageMerge(freqs, maxLength)
+		if err != nil {
+			t.Fatalf("PackageMerge(%d) failed: %v", maxLength, err)
+		}
+
+		for symbol, length := range lengths {
+			if freqs[symbol] > 0 && length == 0 {
+				t.Errorf("limit %d: symbol %d has no code", maxLength, symbol)
+			}
+			if freqs[symbol] == 0 && length != 0 {
+				t.Errorf("limit %d: unused symbol %d got length %d", maxLength, symbol, length)
+			}
+			if int(length) > maxLength {
+				t.Errorf("limit %d: symbol %d has length %d", maxLength, symbol, length)
+			}
+		}
+
+		if !kraftSumFits(lengths) {
+			t.Errorf("limit %d: lengths are not a valid prefix code", maxLength)
+		}
+	}
+}
+
+func TestPackageMerge_OptimalWhenLimitNotBinding(t *testing.T) {
+	freqTable := internal.FrequencyTable{'a': 45, 'b': 13, 'c': 12, 'd': 16, 'e': 9, 'f': 5}
+
+	root, err := internal.BuildHuffmanTree(freqTable)
+	if err != nil {
+		t.Fatal("BuildHuffmanTree failed:", err)
+	}
+	treeLengths := internal.CodeLengths(root)
+
+	freqs := make([]int, 256)
+	for char, freq := range freqTable {
+		freqs[char] = freq
+	}
+	limited, err := internal.PackageMerge(freqs, 15)
+	if err != nil {
+		t.Fatal("PackageMerge failed:", err)
+	}
+
+	// Both must reach the same total encoded size
+	treeCost, limitedCost := 0, 0
+	for char, freq := range freqTable {
+		treeCost += freq * int(treeLengths[char])
+		limitedCost += freq * int(limited[char])
+	}
+	if treeCost != limitedCost {
+		t.Errorf("Expected optimal cost %d, got %d", treeCost, limitedCost)
+	}
+}
+
+func TestPackageMerge_TooManySymbols(t *testing.T) {
+	freqs := make([]int, 256)
+	for i := range freqs {
+		freqs[i] = 1
+	}
+
+	// 256 symbols need at least 8 bits
+	_, err := internal.PackageMerge(freqs, 7)
+	if err == nil {
+		t.Fatal("Expected error for 256 symbols with 7 bit codes, got nil")
+	}
+
+	lengths, err := internal.PackageMerge(freqs, 8)
+	if err != nil {
+		t.Fatal("PackageMerge failed:", err)
+	}
+	for symbol, length := range lengths {
+		if length != 8 {
+			t.Fatalf("Symbol %d: expected length 8, got %d", symbol, length)
+		}
+	}
+}
+
+func TestPackageMerge_SingleSymbol(t *testing.T) {
+	freqs := make([]int, 256)
+	freqs['x'] = 42
+
+	lengths, err := internal.PackageMerge(freqs, 15)
+	if err != nil {
+		t.Fatal("PackageMerge failed:", err)
+	}
+	if lengths['x'] != 1 {
+		t.Errorf("Expected length 1 for single symbol, got %d", lengths['x'])
+	}
+}
+
+func TestGenerateLimitedCodes_PrefixFree(t *testing.T) {
+	codeTable, err := internal.GenerateLimitedCodes(fibonacciFrequencies(40), 12)
+	if err != nil {
+		t.Fatal("GenerateLimitedCodes failed:", err)
+	}
+
+	if len(codeTable) != 40 {
+		t.Errorf("Expected 40 codes, got %d", len(codeTable))
+	}
+	for char, code := range codeTable {
+		if code.GetLength() > 12 {
+			t.Errorf("Symbol %d: code length %d exceeds 12", char, code.GetLength())
+		}
+	}
+	if !internal.VerifyPrefixFree(codeTable) {
+		t.Error("Limited codes are not prefix-free")
+	}
+}
+
+func TestStream_SkewedBlockRoundTrip(t *testing.T) {
+	// Fibonacci frequencies up to 26 symbols would need 25 bit codes,
+	// blocks cap them at DefaultMaxCodeLength
+	var original []byte
+	for char, freq := range fibonacciFrequencies(26) {
+		original = append(original, bytes.Repeat([]byte{char}, freq)...)
+	}
+
+	var compressed bytes.Buffer
+	err := internal.CompressStream(bytes.NewReader(original), &compressed, internal.MaxBlockSize)
+	if err != nil {
+		t.Fatal("CompressStream failed:", err)
+	}
+
+	var decompressed bytes.Buffer
+	err = internal.DecompressStream(&compressed, &decompressed)
+	if err != nil {
+		t.Fatal("DecompressStream failed:", err)
+	}
+	if !bytes.Equal(decompressed.Bytes(), original) {
+		t.Error("Skewed block round trip failed")
+	}
+}
@@ -0,0 +1,184 @@
+package test
+
+import (
+	"bytes"
+	"errors"
+	"huffman-compressor/huffman"
+	"huffman-compressor/internal"
+	"io"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func TestLevels_RoundTrip(t *testing.T) {
+	random := make([]byte, 20000)
+	rand.New(rand.NewSource(3)).Read(random)
+
+	testCases := []struct {
+		name string
+		data []byte
+	}{
+		{"Empty", nil},
+		{"SingleByte", []byte("x")},
+		{"Text", []byte(strings.Repeat("levels trade speed for ratio, levels trade speed\n", 300))},
+		{"Random", random},
+	}
+
+	for _, tc := range testCases {
+		for level := internal.MinLevel; level <= internal.MaxLevel; level++ {
+			compressed := compressStream(t, tc.data, streamOptions{level: level, flags: internal.DefaultFlags})
+
+			var decompressed bytes.Buffer
+			err := internal.DecompressStream(bytes.NewReader(compressed), &decompressed)
+			if err != nil {
+				t.Fatalf("%s: DecompressStream at level %d failed: %v", tc.name, level, err)
+			}
+			if !bytes.Equal(decompressed.Bytes(), tc.data) {
+				t.Errorf("%s: round trip at level %d did not reproduce the input", tc.name, level)
+			}
+		}
+	}
+}
+
+func TestLevels_HigherLevelsCompressBetter(t *testing.T) {
+	data := loadSample(t, 256<<10)
+
+	sizes := make(map[int]int)
+	for _, level := range []int{1, 2, 6, 9} {
+		sizes[level] = len(compressStream(t, data, streamOptions{level: level, flags: internal.DefaultFlags}))
+	}
+	t.Logf("sizes by level: %v", sizes)
+
+	if sizes[2] >= sizes[1] || sizes[6] > sizes[2] || sizes[9] > sizes[6] {
+		t.Errorf("Expected output to shrink as the level goes up, got %v", sizes)
+	}
+}
+
+func TestLevel9_StoresIncompressibleBlocks(t *testing.T) {
+	data := make([]byte, 50000)
+	rand.New(rand.NewSource(9)).Read(data)
+
+	compressed := compressStream(t, data, streamOptions{level: 9, flags: internal.DefaultFlags})
+
+	// One block: header, block header, mode byte, end marker and trailer
+	overhead := internal.StreamHeaderSize + 9 + 1 + 4 + internal.TrailerSize(internal.DefaultFlags)
+	if len(compressed) > len(data)+overhead {
+		t.Errorf("Expected at most %d bytes for stored data, got %d", len(data)+overhead, len(compressed))
+	}
+}
+
+func TestLevels_RecordedInHeader(t *testing.T) {
+	compressed := compressStream(t, []byte("which level was this"), streamOptions{level: 7, flags: internal.DefaultFlags})
+
+	reader, err := internal.NewStreamReader(bytes.NewReader(compressed))
+	if err != nil {
+		t.Fatal("NewStreamReader failed:", err)
+	}
+	if reader.Level() != 7 {
+		t.Errorf("Expected level 7, got %d", reader.Level())
+	}
+	if reader.Flags()&internal.FlagLZ77 == 0 {
+		t.Error("Expected level 7 to set FlagLZ77")
+	}
+}
+
+func TestLevels_HeaderRejectsInvalidLevel(t *testing.T) {
+	compressed := compressStream(t, []byte("level byte"), streamOptions{level: 3, flags: internal.DefaultFlags})
+	for _, level := range []byte{internal.MaxLevel + 1, 200} {
+		corrupt := bytes.Clone(compressed)
+		corrupt[4] = level
+		_, err := internal.NewStreamReader(bytes.NewReader(corrupt))
+		var formatErr *internal.FormatError
+		if !errors.As(err, &formatErr) || formatErr.Offset != 4 {
+			t.Errorf("Level %d: expected a FormatError at byte 4, got %v", level, err)
+		}
+	}
+}
+
+func TestLevels_InvalidLevel(t *testing.T) {
+	for _, level := range []int{-1, internal.MaxLevel + 1} {
+		err := internal.CompressStreamLevel(strings.NewReader("data"), io.Discard, 0, level, internal.DefaultFlags)
+		if err == nil {
+			t.Errorf("Expected error for level %d, got nil", level)
+		}
+	}
+
+	_, err := huffman.NewWriterLevel(io.Discard, 0)
+	if err == nil {
+		t.Error("Expected NewWriterLevel error for level 0, got nil")
+	}
+}
+
+func TestLevels_RejectCodingModeFlags(t *testing.T) {
+	flags := internal.DefaultFlags | internal.FlagAdaptive
+	err := internal.CompressStreamLevel(strings.NewReader("data"), io.Discard, 0, 5, flags)
+	if err == nil {
+		t.Error("Expected error for a level combined with FlagAdaptive, got nil")
+	}
+}
+
+func TestStream_ReadsVersion1(t *testing.T) {
+	original := []byte(strings.Repeat("streams written before levels existed\n", 40))
+	compressed := compressStream(t, original, streamOptions{level: 1, flags: internal.DefaultFlags})
+
+	// Version 1 headers have no level byte
+	header := []byte(internal.StreamMagic)
+	header = append(header, 1, compressed[len(internal.StreamMagic)+1])
+	v1 := append(header, compressed[internal.StreamHeaderSize:]...)
+
+	var decompressed bytes.Buffer
+	err := internal.DecompressStream(bytes.NewReader(v1), &decompressed)
+	if err != nil {
+		t.Fatal("DecompressStream failed on a version 1 stream:", err)
+	}
+	if !bytes.Equal(decompressed.Bytes(), original) {
+		t.Error("Version 1 stream did not decode to the input")
+	}
+}
+
+func TestStream_UnknownBlockMode(t *testing.T) {
+	compressed := compressStream(t, []byte("mode byte follows the block header"), streamOptions{level: 9, flags: internal.DefaultFlags})
+
+	// The mode byte follows the 9-byte block header
+	compressed[internal.StreamHeaderSize+9] = 7
+
+	err := internal.DecompressStream(bytes.NewReader(compressed), io.Discard)
+	if err == nil {
+		t.Error("Expected error for an unknown block mode, got nil")
+	}
+}
+
+func TestWriterLevel_RoundTrip(t *testing.T) {
+	original := []byte(strings.Repeat("best compression through the writer API ", 100))
+
+	var compressed bytes.Buffer
+	writer, err := huffman.NewWriterLevel(&compressed, huffman.BestCompression)
+	if err != nil {
+		t.Fatal("NewWriterLevel failed:", err)
+	}
+	_, err = writer.Write(original)
+	if err != nil {
+		t.Fatal("Write failed:", err)
+	}
+	err = writer.Close()
+	if err != nil {
+		t.Fatal("Close failed:", err)
+	}
+
+	if !bytes.Equal(decompressBytes(t, compressed.Bytes()), original) {
+		t.Error("Round trip through NewWriterLevel did not reproduce the input")
+	}
+}
+
+func BenchmarkEncode_Level9(b *testing.B) {
+	data := loadSample(b, 1<<20)
+	b.SetBytes(int64(len(data)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		err := internal.CompressStreamLevel(bytes.NewReader(data), io.Discard, 0, 9, internal.DefaultFlags)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package test
+
+import (
+	"bytes"
+	"errors"
+	"huffman-compressor/huffman"
+	"huffman-compressor/internal"
+	"io"
+	"os"
+	"testing"
+)
+
+// writeZeroBomb writes size zero bytes as a level 9 stream, which shrinks
+// them about a thousandfold
+func writeZeroBomb(t *testing.T, path string, size int) {
+	t.Helper()
+
+	var compressed bytes.Buffer
+	err := internal.CompressStreamLevel(bytes.NewReader(make([]byte, size)), &compressed, 0, 9, internal.DefaultFlags)
+	if err != nil {
+		t.Fatal("CompressStreamLevel failed:", err)
+	}
+	err = os.WriteFile(path, compressed.Bytes(), 0644)
+	if err != nil {
+		t.Fatal("Failed to write bomb:", err)
+	}
+}
+
+// writeClaimingHeader writes a .hf file whose header claims originalSize
+// bytes, followed by a few bytes of payload
+func writeClaimingHeader(t *testing.T, path string, originalSize uint64) {
+	t.Helper()
+
+	var file bytes.Buffer
+	freqTable := internal.FrequencyTable{'a': int(originalSize) - 1, 'b': 1}
+	err := internal.WriteHeaderV2(&file, freqTable, originalSize, 0, 0)
+	if err != nil {
+		t.Fatal("WriteHeaderV2 failed:", err)
+	}
+	file.Write(make([]byte, 16))
+	err = os.WriteFile(path, file.Bytes(), 0644)
+	if err != nil {
+		t.Fatal("Failed to write file:", err)
+	}
+}
+
+func TestDecompressLimits_Stream(t *testing.T) {
+	bombPath := "test_limits_bomb.hf"
+	writeZeroBomb(t, bombPath, 4<<20)
+	defer os.Remove(bombPath)
+
+	outputPath := "test_limits_output.txt"
+	defer os.Remove(outputPath)
+
+	testCases := []struct {
+		name   string
+		limits internal.DecodeLimits
+		limit  string
+	}{
+		{"OutputSize", internal.DecodeLimits{MaxOutputSize: 1 << 20}, "output size"},
+		{"Ratio", internal.DecodeLimits{MaxRatio: 50}, "expansion ratio"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := internal.DecompressLimits(bombPath, outputPath, tc.limits)
+			var limitErr *internal.LimitError
+			if !errors.As(err, &limitErr) {
+				t.Fatalf("Expected LimitError, got %v", err)
+			}
+			if limitErr.Limit != tc.limit {
+				t.Errorf("Expected %s limit, got %s", tc.limit, limitErr.Limit)
+			}
+			if _, err := os.Stat(outputPath); !errors.Is(err, os.ErrNotExist) {
+				t.Error("Expected partial output to be removed")
+			}
+		})
+	}
+
+	// Limits the data stays within don't get in the way
+	err := internal.DecompressLimits(bombPath, outputPath, internal.DecodeLimits{MaxOutputSize: 4 << 20, MaxRatio: 5000})
+	if err != nil {
+		t.Fatal("DecompressLimits failed within limits:", err)
+	}
+	info, err := os.Stat(outputPath)
+	if err != nil || info.Size() != 4<<20 {
+		t.Errorf("Expected %d bytes of output: %v", 4<<20, err)
+	}
+}
+
+func TestDecompressLimits_FileHeaderClaim(t *testing.T) {
+	claimPath := "test_limits_claim.hf"
+	writeClaimingHeader(t, claimPath, 1<<40)
+	defer os.Remove(claimPath)
+
+	outputPath := "test_limits_claim_output.txt"
+	defer os.Remove(outputPath)
+
+	for _, limits := range []internal.DecodeLimits{{MaxOutputSize: 1 << 30}, {MaxRatio: 1000}} {
+		err := internal.DecompressLimits(claimPath, outputPath, limits)
+		var limitErr *internal.LimitError
+		if !errors.As(err, &limitErr) {
+			t.Fatalf("Expected LimitError for %+v, got %v", limits, err)
+		}
+		if _, err := os.Stat(outputPath); !errors.Is(err, os.ErrNotExist) {
+			t.Error("Expected no output to be created")
+		}
+	}
+}
+
+func TestReaderLimits(t *testing.T) {
+	bombPath := "test_reader_limits_bomb.hf"
+	writeZeroBomb(t, bombPath, 2<<20)
+	defer os.Remove(bombPath)
+	bomb, err := os.ReadFile(bombPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reader, err := huffman.NewReaderLimits(bytes.NewReader(bomb), huffman.Limits{MaxOutputSize: 100000})
+	if err != nil {
+		t.Fatal("NewReaderLimits failed:", err)
+	}
+	n, err := io.Copy(io.Discard, reader)
+	var limitErr *huffman.LimitError
+	if !errors.As(err, &limitErr) {
+		t.Fatalf("Expected LimitError, got %v", err)
+	}
+	if n > 100000 {
+		t.Errorf("Expected at most 100000 bytes before the error, got %d", n)
+	}
+
+	claimPath := "test_reader_limits_claim.hf"
+	writeClaimingHeader(t, claimPath, 1<<40)
+	defer os.Remove(claimPath)
+	claim, err := os.ReadFile(claimPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = huffman.NewReaderLimits(bytes.NewReader(claim), huffman.Limits{MaxOutputSize: 1 << 30})
+	if !errors.As(err, &limitErr) {
+		t.Errorf("Expected LimitError from the header claim, got %v", err)
+	}
+}
+
+func TestReaderLimits_BlockHeaderClaim(t *testing.T) {
+	// One 4 MiB block of zeros in a few KB
+	bomb := compressStream(t, make([]byte, 4<<20), streamOptions{blockSize: 4 << 20, level: 9, flags: internal.DefaultFlags})
+
+	for _, limits := range []internal.DecodeLimits{{MaxOutputSize: 1 << 20}, {MaxRatio: 50}} {
+		reader, err := internal.NewLimitedReader(bytes.NewReader(bomb), limits)
+		if err != nil {
+			t.Fatal("NewLimitedReader failed:", err)
+		}
+		// The block header gives it away, nothing is decoded
+		n, err := reader.Read(make([]byte, 4096))
+		var limitErr *internal.LimitError
+		if n != 0 || !errors.As(err, &limitErr) {
+			t.Errorf("Limits %+v: expected LimitError before any output, got %d bytes and %v", limits, n, err)
+		}
+	}
+}
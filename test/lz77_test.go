@@ -0,0 +1,161 @@
+package test
+
+import (
+	"bytes"
+	"huffman-compressor/internal"
+	"io"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func TestLZ77_RoundTrip(t *testing.T) {
+	random := make([]byte, 20000)
+	rand.New(rand.NewSource(7)).Read(random)
+
+	// Repeats further apart than the 32 KiB window can't be matched
+	farRepeat := append(append(bytes.Clone(random), make([]byte, 40000)...), random...)
+
+	allBytes := make([]byte, 256)
+	for i := range allBytes {
+		allBytes[i] = byte(i)
+	}
+
+	testCases := []struct {
+		name string
+		data []byte
+	}{
+		{"SingleByte", []byte("x")},
+		{"TwoBytes", []byte("xy")},
+		{"Run", bytes.Repeat([]byte("a"), 10000)},
+		{"Overlapping", []byte("abcabcabcabcabcabcabcabcabcabcabc")},
+		{"Text", []byte(strings.Repeat("the quick brown fox jumps over the lazy dog\n", 200))},
+		{"AllByteValues", bytes.Repeat(allBytes, 4)},
+		{"Random", random},
+		{"FarRepeat", farRepeat},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var encoded bytes.Buffer
+			_, err := internal.EncodeLZ77(&encoded, tc.data, internal.DefaultLZParams)
+			if err != nil {
+				t.Fatal("EncodeLZ77 failed:", err)
+			}
+
+			decoded, err := internal.DecodeLZ77(&encoded, len(tc.data))
+			if err != nil {
+				t.Fatal("DecodeLZ77 failed:", err)
+			}
+			if !bytes.Equal(decoded, tc.data) {
+				t.Error("Round trip did not reproduce the input")
+			}
+		})
+	}
+}
+
+func TestLZ77_GreedyAndLazyAgree(t *testing.T) {
+	data := []byte(strings.Repeat("abcde abcdx abcdefg ", 300))
+
+	for _, params := range []internal.LZParams{
+		{MaxChain: 1, Lazy: false},
+		{MaxChain: 4, Lazy: true},
+		{MaxChain: 256, Lazy: true},
+	} {
+		var encoded bytes.Buffer
+		_, err := internal.EncodeLZ77(&encoded, data, params)
+		if err != nil {
+			t.Fatalf("EncodeLZ77 %+v failed: %v", params, err)
+		}
+		decoded, err := internal.DecodeLZ77(&encoded, len(data))
+		if err != nil {
+			t.Fatalf("DecodeLZ77 %+v failed: %v", params, err)
+		}
+		if !bytes.Equal(decoded, data) {
+			t.Errorf("Round trip with %+v did not reproduce the input", params)
+		}
+	}
+}
+
+func TestLZ77Stream_BeatsPlainHuffmanOnRepetitiveData(t *testing.T) {
+	data := []byte(strings.Repeat("2024-01-01 INFO request served path=/api/v1/items status=200\n", 500))
+
+	var plain, lz bytes.Buffer
+	err := internal.CompressStreamFlags(bytes.NewReader(data), &plain, 0, internal.DefaultFlags)
+	if err != nil {
+		t.Fatal("CompressStreamFlags failed:", err)
+	}
+	err = internal.CompressStreamFlags(bytes.NewReader(data), &lz, 0, internal.DefaultFlags|internal.FlagLZ77)
+	if err != nil {
+		t.Fatal("CompressStreamFlags failed:", err)
+	}
+
+	if lz.Len()*10 > plain.Len() {
+		t.Errorf("Expected LZ77 output (%d bytes) to be under a tenth of plain Huffman (%d bytes)", lz.Len(), plain.Len())
+	}
+
+	var decompressed bytes.Buffer
+	err = internal.DecompressStream(&lz, &decompressed)
+	if err != nil {
+		t.Fatal("DecompressStream failed:", err)
+	}
+	if !bytes.Equal(decompressed.Bytes(), data) {
+		t.Error("Round trip did not reproduce the input")
+	}
+}
+
+func TestLZ77_SampleText(t *testing.T) {
+	data := loadSample(t, 1<<20)
+
+	var plain, lz bytes.Buffer
+	err := internal.CompressStream(bytes.NewReader(data), &plain, 0)
+	if err != nil {
+		t.Fatal("CompressStream failed:", err)
+	}
+	err = internal.CompressStreamFlags(bytes.NewReader(data), &lz, 0, internal.DefaultFlags|internal.FlagLZ77)
+	if err != nil {
+		t.Fatal("CompressStreamFlags failed:", err)
+	}
+
+	t.Logf("plain: %d bytes, lz77: %d bytes", plain.Len(), lz.Len())
+	if lz.Len() >= plain.Len() {
+		t.Errorf("Expected LZ77 to beat plain Huffman on sample text")
+	}
+}
+
+func TestLZ77_TruncatedPayload(t *testing.T) {
+	data := []byte(strings.Repeat("truncated lz77 payload ", 20))
+
+	var encoded bytes.Buffer
+	_, err := internal.EncodeLZ77(&encoded, data, internal.DefaultLZParams)
+	if err != nil {
+		t.Fatal("EncodeLZ77 failed:", err)
+	}
+
+	for _, size := range []int{0, 3, encoded.Len() / 2, encoded.Len() - 1} {
+		_, err = internal.DecodeLZ77(bytes.NewReader(encoded.Bytes()[:size]), len(data))
+		if err == nil {
+			t.Errorf("Expected error for payload cut to %d bytes, got nil", size)
+		}
+	}
+}
+
+func TestStream_RejectsAdaptiveWithLZ77(t *testing.T) {
+	flags := internal.FlagAdaptive | internal.FlagLZ77
+	err := internal.CompressStreamFlags(strings.NewReader("data"), io.Discard, 0, flags)
+	if err == nil {
+		t.Error("Expected error for adaptive and LZ77 together, got nil")
+	}
+}
+
+func BenchmarkEncode_LZ77(b *testing.B) {
+	data := loadSample(b, 1<<20)
+	b.SetBytes(int64(len(data)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, err := internal.EncodeLZ77(io.Discard, data, internal.DefaultLZParams)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,217 @@
+package test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"huffman-compressor/internal"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// parallelInput mixes text, repeats and noise so blocks pick different modes
+func parallelInput() []byte {
+	random := rand.New(rand.NewSource(21))
+	var data bytes.Buffer
+	for i := 0; data.Len() < 200_000; i++ {
+		switch i % 3 {
+		case 0:
+			fmt.Fprintf(&data, "row %d: status=ok region=eu-west\n", i)
+		case 1:
+			data.Write(bytes.Repeat([]byte{byte(i)}, 300))
+		default:
+			noise := make([]byte, 500)
+			random.Read(noise)
+			data.Write(noise)
+		}
+	}
+	return data.Bytes()
+}
+
+// compressWorkers writes data in uneven pieces, flushing halfway through
+func compressWorkers(t *testing.T, data []byte, level int, flags uint8, workers int) []byte {
+	t.Helper()
+	var compressed bytes.Buffer
+	writer, err := internal.NewStreamWriterLevel(&compressed, 4096, level, flags)
+	if err != nil {
+		t.Fatal("NewStreamWriterLevel failed:", err)
+	}
+	writer.SetConcurrency(workers)
+
+	half := len(data) / 2
+	for _, piece := range [][]byte{data[:1000], data[1000:half]} {
+		_, err = writer.Write(piece)
+		if err != nil {
+			t.Fatal("Write failed:", err)
+		}
+	}
+	err = writer.Flush()
+	if err != nil {
+		t.Fatal("Flush failed:", err)
+	}
+	_, err = writer.Write(data[half:])
+	if err != nil {
+		t.Fatal("Write failed:", err)
+	}
+	err = writer.Close()
+	if err != nil {
+		t.Fatal("Close failed:", err)
+	}
+	return compressed.Bytes()
+}
+
+func TestStreamWriter_SameOutputForAnyConcurrency(t *testing.T) {
+	data := parallelInput()
+	configs := []struct {
+		level int
+		flags uint8
+	}{
+		{1, internal.DefaultFlags},
+		{6, internal.DefaultFlags | internal.FlagSHA256},
+		{9, internal.DefaultFlags},
+		{0, internal.DefaultFlags | internal.FlagAdaptive},
+	}
+
+	for _, config := range configs {
+		expected := compressWorkers(t, data, config.level, config.flags, 1)
+		for _, workers := range []int{2, 3, 8} {
+			got := compressWorkers(t, data, config.level, config.flags, workers)
+			if !bytes.Equal(got, expected) {
+				t.Errorf("Level %d flags %#x: output with %d workers differs from a single worker", config.level, config.flags, workers)
+			}
+		}
+	}
+}
+
+func TestStreamReader_Concurrency(t *testing.T) {
+	data := parallelInput()
+	compressed := compressWorkers(t, data, 6, internal.DefaultFlags|internal.FlagSHA256, 4)
+
+	for _, workers := range []int{1, 2, 8} {
+		reader, err := internal.NewStreamReader(bytes.NewReader(compressed))
+		if err != nil {
+			t.Fatal("NewStreamReader failed:", err)
+		}
+		reader.SetConcurrency(workers)
+		decoded, err := io.ReadAll(reader)
+		if err != nil {
+			t.Fatalf("%d workers: ReadAll failed: %v", workers, err)
+		}
+		if !bytes.Equal(decoded, data) {
+			t.Errorf("%d workers: round trip did not reproduce the input", workers)
+		}
+	}
+}
+
+func TestStreamReader_ConcurrencyErrors(t *testing.T) {
+	data := parallelInput()
+	compressed := compressWorkers(t, data, 1, internal.DefaultFlags, 1)
+
+	// A truncated stream fails only after the intact blocks were returned
+	cut := compressed[:len(compressed)/2]
+	reader, err := internal.NewStreamReader(bytes.NewReader(cut))
+	if err != nil {
+		t.Fatal("NewStreamReader failed:", err)
+	}
+	reader.SetConcurrency(4)
+	decoded, err := io.ReadAll(reader)
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("Expected io.ErrUnexpectedEOF, got %v", err)
+	}
+	if len(decoded) == 0 || !bytes.HasPrefix(data, decoded) {
+		t.Errorf("Expected the %d bytes before the cut to be a prefix of the input", len(decoded))
+	}
+
+	// Flipped payload bits are caught by the checksum at the latest
+	corrupt := bytes.Clone(compressed)
+	corrupt[len(corrupt)/3] ^= 0x55
+	reader, err = internal.NewStreamReader(bytes.NewReader(corrupt))
+	if err != nil {
+		t.Fatal("NewStreamReader failed:", err)
+	}
+	reader.SetConcurrency(4)
+	_, err = io.ReadAll(reader)
+	if err == nil {
+		t.Error("Expected error for a corrupted stream, got nil")
+	}
+}
+
+func TestCompressFileWorkers_RoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	inputPath := filepath.Join(dir, "export.csv")
+	data := parallelInput()
+	err := os.WriteFile(inputPath, data, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	serialPath := filepath.Join(dir, "serial.hf")
+	err = internal.CompressFileBlocks(inputPath, serialPath, 8192, 6, internal.DefaultFlags)
+	if err != nil {
+		t.Fatal("CompressFileBlocks failed:", err)
+	}
+	parallelPath := filepath.Join(dir, "parallel.hf")
+	err = internal.CompressFileWorkers(inputPath, parallelPath, 8192, 6, internal.DefaultFlags, 4)
+	if err != nil {
+		t.Fatal("CompressFileWorkers failed:", err)
+	}
+
+	serial, _ := os.ReadFile(serialPath)
+	parallel, _ := os.ReadFile(parallelPath)
+	if !bytes.Equal(serial, parallel) {
+		t.Error("CompressFileWorkers output differs from CompressFileBlocks")
+	}
+
+	outputPath := filepath.Join(dir, "export.out")
+	err = internal.DecompressWorkers(parallelPath, outputPath, internal.DecodeLimits{}, 4)
+	if err != nil {
+		t.Fatal("DecompressWorkers failed:", err)
+	}
+	decoded, _ := os.ReadFile(outputPath)
+	if !bytes.Equal(decoded, data) {
+		t.Error("DecompressWorkers did not reproduce the input")
+	}
+}
+
+// readCounter counts the bytes read from it
+type readCounter struct {
+	reader io.Reader
+	count  int
+}
+
+func (rc *readCounter) Read(p []byte) (int, error) {
+	n, err := rc.reader.Read(p)
+	rc.count += n
+	return n, err
+}
+
+func TestStreamReader_ConcurrencyStopsAtLimits(t *testing.T) {
+	// 8 blocks of 256 KiB that don't compress, so reading ahead shows in
+	// the compressed bytes consumed
+	data := make([]byte, 8<<18)
+	rand.New(rand.NewSource(16)).Read(data)
+	compressed := compressStream(t, data, streamOptions{blockSize: 1 << 18, level: 1, flags: internal.DefaultFlags})
+
+	source := &readCounter{reader: bytes.NewReader(compressed)}
+	reader, err := internal.NewLimitedReaderWorkers(source, internal.DecodeLimits{MaxOutputSize: 2 << 18}, 8)
+	if err != nil {
+		t.Fatal("NewLimitedReaderWorkers failed:", err)
+	}
+	_, err = reader.Read(make([]byte, 4096))
+	if err != nil {
+		t.Fatal("Read within the limits failed:", err)
+	}
+	// Two blocks fit the limit, the header of the third stops reading ahead
+	if source.count > 3<<18 {
+		t.Errorf("Read %d compressed bytes ahead, expected about 2 blocks of %d", source.count, 1<<18)
+	}
+
+	n, err := io.Copy(io.Discard, reader)
+	var limitErr *internal.LimitError
+	if !errors.As(err, &limitErr) || n+4096 != 2<<18 {
+		t.Errorf("Expected the 2 blocks within the limit and a LimitError, got %d bytes and %v", n+4096, err)
+	}
+}
@@ -0,0 +1,143 @@
+package test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"huffman-compressor/internal"
+	"io"
+	"testing"
+)
+
+func seekableInput() []byte {
+	var data bytes.Buffer
+	for i := 0; data.Len() < 100_000; i++ {
+		fmt.Fprintf(&data, "2024-03-01T12:%02d:%02d request %d served in %dms\n", i/60%60, i%60, i, i%97)
+	}
+	return data.Bytes()
+}
+
+// seekableOptions are the stream options of the seekable tests
+func seekableOptions(flags uint8, workers int) streamOptions {
+	return streamOptions{blockSize: 4096, level: 6, flags: flags, workers: workers}
+}
+
+func TestSeekableReader_ReadAt(t *testing.T) {
+	data := seekableInput()
+	for _, flags := range []uint8{internal.DefaultFlags | internal.FlagIndex, internal.DefaultFlags} {
+		compressed := compressStream(t, data, seekableOptions(flags, 1))
+		reader, err := internal.NewSeekableReader(bytes.NewReader(compressed), int64(len(compressed)))
+		if err != nil {
+			t.Fatalf("Flags %#x: NewSeekableReader failed: %v", flags, err)
+		}
+		if reader.Size() != int64(len(data)) || reader.Blocks() != (len(data)+4095)/4096 {
+			t.Fatalf("Flags %#x: unexpected size %d or blocks %d", flags, reader.Size(), reader.Blocks())
+		}
+
+		// Within a block, across blocks, and up to the end
+		for _, span := range [][2]int{{0, 10}, {4090, 4102}, {12000, 30000}, {len(data) - 7, len(data)}} {
+			got := make([]byte, span[1]-span[0])
+			n, err := reader.ReadAt(got, int64(span[0]))
+			if err != nil && !(err == io.EOF && n == len(got)) {
+				t.Errorf("Flags %#x: ReadAt %v failed: %v", flags, span, err)
+			}
+			if !bytes.Equal(got[:n], data[span[0]:span[1]]) {
+				t.Errorf("Flags %#x: ReadAt %v returned the wrong bytes", flags, span)
+			}
+		}
+
+		// Reading past the end is short with io.EOF
+		n, err := reader.ReadAt(make([]byte, 20), int64(len(data)-5))
+		if n != 5 || err != io.EOF {
+			t.Errorf("Flags %#x: expected 5 bytes and io.EOF past the end, got %d, %v", flags, n, err)
+		}
+	}
+}
+
+func TestSeekableReader_SeekAndRead(t *testing.T) {
+	data := seekableInput()
+	compressed := compressStream(t, data, seekableOptions(internal.DefaultFlags|internal.FlagIndex, 1))
+	reader, err := internal.NewSeekableReader(bytes.NewReader(compressed), int64(len(compressed)))
+	if err != nil {
+		t.Fatal("NewSeekableReader failed:", err)
+	}
+
+	_, err = reader.Seek(-1000, io.SeekEnd)
+	if err != nil {
+		t.Fatal("Seek failed:", err)
+	}
+	tail, err := io.ReadAll(reader)
+	if err != nil || !bytes.Equal(tail, data[len(data)-1000:]) {
+		t.Errorf("Expected the last 1000 bytes after seeking from the end, err %v", err)
+	}
+
+	position, err := reader.Seek(50_000, io.SeekStart)
+	if err == nil {
+		position, err = reader.Seek(-10, io.SeekCurrent)
+	}
+	if err != nil || position != 49_990 {
+		t.Fatalf("Expected position 49990, got %d, %v", position, err)
+	}
+	got := make([]byte, 100)
+	_, err = io.ReadFull(reader, got)
+	if err != nil || !bytes.Equal(got, data[49_990:50_090]) {
+		t.Errorf("Read after Seek returned the wrong bytes, err %v", err)
+	}
+
+	_, err = reader.Seek(-1, io.SeekStart)
+	if err == nil {
+		t.Error("Expected error seeking before the start, got nil")
+	}
+}
+
+func TestIndexedStream_SequentialReaders(t *testing.T) {
+	data := seekableInput()
+	flags := internal.DefaultFlags | internal.FlagIndex
+
+	// The index doesn't depend on the number of workers either
+	compressed := compressStream(t, data, seekableOptions(flags, 1))
+	if !bytes.Equal(compressStream(t, data, seekableOptions(flags, 4)), compressed) {
+		t.Error("Indexed output with 4 workers differs from a single worker")
+	}
+
+	var decoded bytes.Buffer
+	err := internal.DecompressStream(bytes.NewReader(compressed), &decoded)
+	if err != nil || !bytes.Equal(decoded.Bytes(), data) {
+		t.Errorf("DecompressStream of an indexed stream failed: %v", err)
+	}
+
+	info, err := internal.ReadCompressedInfo(bytes.NewReader(compressed))
+	if err != nil {
+		t.Fatal("ReadCompressedInfo failed:", err)
+	}
+	if info.IndexSize == 0 || info.HeaderSize+info.PayloadSize+info.TrailerSize+info.IndexSize != info.CompressedSize {
+		t.Errorf("Unexpected sizes for an indexed stream: %+v", info)
+	}
+}
+
+func TestSeekableReader_CorruptIndex(t *testing.T) {
+	data := seekableInput()
+	compressed := compressStream(t, data, seekableOptions(internal.DefaultFlags|internal.FlagIndex, 1))
+
+	// Caught by the index CRC
+	corrupt := bytes.Clone(compressed)
+	corrupt[len(corrupt)-20] ^= 1
+	_, err := internal.NewSeekableReader(bytes.NewReader(corrupt), int64(len(corrupt)))
+	var checksumErr *internal.ChecksumError
+	if !errors.As(err, &checksumErr) {
+		t.Errorf("Expected a ChecksumError for a corrupt index, got %v", err)
+	}
+
+	// The footer doesn't match the stream any more
+	cut := compressed[:len(compressed)-1]
+	_, err = internal.NewSeekableReader(bytes.NewReader(cut), int64(len(cut)))
+	if err == nil {
+		t.Error("Expected error for a stream without its index footer, got nil")
+	}
+
+	// A single-table file has no blocks to seek to
+	_, err = internal.NewSeekableReader(bytes.NewReader([]byte("HF\x02\x01\x00")), 5)
+	if err == nil {
+		t.Error("Expected error for a .hf file, got nil")
+	}
+}
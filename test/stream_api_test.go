@@ -0,0 +1,194 @@
+package test
+
+import (
+	"bytes"
+	"errors"
+	"huffman-compressor/huffman"
+	"huffman-compressor/internal"
+	"io"
+	"os"
+	"strings"
+	"testing"
+)
+
+func compressBytes(t *testing.T, data []byte) []byte {
+	t.Helper()
+
+	var compressed bytes.Buffer
+	writer := huffman.NewWriter(&compressed)
+
+	_, err := writer.Write(data)
+	if err != nil {
+		t.Fatal("Write failed:", err)
+	}
+
+	err = writer.Close()
+	if err != nil {
+		t.Fatal("Close failed:", err)
+	}
+
+	return compressed.Bytes()
+}
+
+func decompressBytes(t *testing.T, data []byte) []byte {
+	t.Helper()
+
+	reader, err := huffman.NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal("NewReader failed:", err)
+	}
+
+	decompressed, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatal("ReadAll failed:", err)
+	}
+
+	return decompressed
+}
+
+func TestStreamAPI_RoundTrip(t *testing.T) {
+	original := []byte(strings.Repeat("The quick brown fox jumps over the lazy dog. ", 100))
+
+	compressed := compressBytes(t, original)
+	if len(compressed) >= len(original) {
+		t.Errorf("Expected compression: compressed=%d, original=%d", len(compressed), len(original))
+	}
+
+	decompressed := decompressBytes(t, compressed)
+	if !bytes.Equal(decompressed, original) {
+		t.Error("Round trip through Writer/Reader did not reproduce the input")
+	}
+}
+
+func TestStreamAPI_MultipleWrites(t *testing.T) {
+	var compressed bytes.Buffer
+	writer := huffman.NewWriter(&compressed)
+
+	chunks := []string{"hello ", "streaming ", "world"}
+	for _, chunk := range chunks {
+		_, err := writer.Write([]byte(chunk))
+		if err != nil {
+			t.Fatal("Write failed:", err)
+		}
+	}
+
+	err := writer.Close()
+	if err != nil {
+		t.Fatal("Close failed:", err)
+	}
+
+	decompressed := decompressBytes(t, compressed.Bytes())
+	if string(decompressed) != strings.Join(chunks, "") {
+		t.Errorf("Content mismatch: got %q", decompressed)
+	}
+}
+
+func TestStreamAPI_EmptyInput(t *testing.T) {
+	compressed := compressBytes(t, nil)
+
+	decompressed := decompressBytes(t, compressed)
+	if len(decompressed) != 0 {
+		t.Errorf("Expected empty output, got %d bytes", len(decompressed))
+	}
+}
+
+func TestStreamAPI_SingleCharacter(t *testing.T) {
+	original := []byte(strings.Repeat("z", 500))
+
+	decompressed := decompressBytes(t, compressBytes(t, original))
+	if !bytes.Equal(decompressed, original) {
+		t.Error("Single character round trip failed")
+	}
+}
+
+func TestStreamAPI_WriteAfterClose(t *testing.T) {
+	var compressed bytes.Buffer
+	writer := huffman.NewWriter(&compressed)
+	writer.Close()
+
+	_, err := writer.Write([]byte("late"))
+	if err != huffman.ErrClosed {
+		t.Errorf("Expected ErrClosed, got %v", err)
+	}
+}
+
+func TestStreamAPI_ReadsCompressFileOutput(t *testing.T) {
+	original := []byte(strings.Repeat("compatible with the file API\n", 40))
+	inputPath := "test_stream_api_input.txt"
+	compressedPath := "test_stream_api_input.hf"
+
+	err := os.WriteFile(inputPath, original, 0644)
+	if err != nil {
+		t.Fatal("Failed to create test file:", err)
+	}
+	defer os.Remove(inputPath)
+
+	err = internal.CompressFile(inputPath, compressedPath)
+	if err != nil {
+		t.Fatal("Compression failed:", err)
+	}
+	defer os.Remove(compressedPath)
+
+	compressed, err := os.ReadFile(compressedPath)
+	if err != nil {
+		t.Fatal("Failed to read compressed file:", err)
+	}
+
+	decompressed := decompressBytes(t, compressed)
+	if !bytes.Equal(decompressed, original) {
+		t.Error("Reader could not decode CompressFile output")
+	}
+}
+
+func TestStreamAPI_DecompressReadsWriterOutput(t *testing.T) {
+	original := []byte(strings.Repeat("written by huffman.Writer\n", 40))
+	compressedPath := "test_stream_api_writer.hf"
+	outputPath := "test_stream_api_writer.txt"
+
+	err := os.WriteFile(compressedPath, compressBytes(t, original), 0644)
+	if err != nil {
+		t.Fatal("Failed to write compressed file:", err)
+	}
+	defer os.Remove(compressedPath)
+
+	err = internal.Decompress(compressedPath, outputPath)
+	if err != nil {
+		t.Fatal("Decompression failed:", err)
+	}
+	defer os.Remove(outputPath)
+
+	decompressed, err := os.ReadFile(outputPath)
+	if err != nil {
+		t.Fatal("Failed to read decompressed file:", err)
+	}
+
+	if !bytes.Equal(decompressed, original) {
+		t.Error("Decompress could not decode Writer output")
+	}
+}
+
+func TestStreamAPI_TruncatedInput(t *testing.T) {
+	original := []byte(strings.Repeat("truncate me please ", 50))
+	compressed := compressBytes(t, original)
+
+	reader, err := huffman.NewReader(bytes.NewReader(compressed[:len(compressed)/2]))
+	if err != nil {
+		t.Fatal("NewReader failed:", err)
+	}
+
+	_, err = io.ReadAll(reader)
+	if err == nil {
+		t.Fatal("Expected error for truncated stream, got nil")
+	}
+}
+
+func TestReader_UnsupportedVersion(t *testing.T) {
+	compressed := compressBytes(t, []byte("from the future"))
+	compressed[2] = 99
+
+	_, err := huffman.NewReader(bytes.NewReader(compressed))
+	var versionErr *huffman.UnsupportedVersionError
+	if !errors.As(err, &versionErr) {
+		t.Fatalf("Expected UnsupportedVersionError, got %T: %v", err, err)
+	}
+}
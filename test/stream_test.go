@@ -0,0 +1,232 @@
+package test
+
+import (
+	"bytes"
+	"errors"
+	"huffman-compressor/internal"
+	"io"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestStream_MultipleBlocksRoundTrip(t *testing.T) {
+	original := []byte(strings.Repeat("block framed data, block framed data\n", 200))
+
+	var compressed bytes.Buffer
+	// Small block size forces many blocks
+	err := internal.CompressStream(bytes.NewReader(original), &compressed, 256)
+	if err != nil {
+		t.Fatal("CompressStream failed:", err)
+	}
+
+	if !bytes.HasPrefix(compressed.Bytes(), []byte(internal.StreamMagic)) {
+		t.Fatalf("Expected stream to start with %q", internal.StreamMagic)
+	}
+
+	var decompressed bytes.Buffer
+	err = internal.DecompressStream(&compressed, &decompressed)
+	if err != nil {
+		t.Fatal("DecompressStream failed:", err)
+	}
+
+	if !bytes.Equal(decompressed.Bytes(), original) {
+		t.Error("Multi block round trip did not reproduce the input")
+	}
+}
+
+func TestStream_AllByteValues(t *testing.T) {
+	// Blocks store the symbol count in 2 bytes, so all 256 values fit
+	original := make([]byte, 1024)
+	for i := range original {
+		original[i] = byte(i)
+	}
+
+	var compressed bytes.Buffer
+	err := internal.CompressStream(bytes.NewReader(original), &compressed, internal.DefaultBlockSize)
+	if err != nil {
+		t.Fatal("CompressStream failed:", err)
+	}
+
+	var decompressed bytes.Buffer
+	err = internal.DecompressStream(&compressed, &decompressed)
+	if err != nil {
+		t.Fatal("DecompressStream failed:", err)
+	}
+
+	if !bytes.Equal(decompressed.Bytes(), original) {
+		t.Error("Binary round trip did not reproduce the input")
+	}
+}
+
+func TestStream_NonSeekableInput(t *testing.T) {
+	original := []byte(strings.Repeat("piped log line\n", 500))
+
+	// A pipe has no size and cannot be rewound
+	pipeReader, pipeWriter := io.Pipe()
+	go func() {
+		for i := 0; i < len(original); i += 100 {
+			end := min(i+100, len(original))
+			pipeWriter.Write(original[i:end])
+		}
+		pipeWriter.Close()
+	}()
+
+	var compressed bytes.Buffer
+	err := internal.CompressStream(pipeReader, &compressed, 1000)
+	if err != nil {
+		t.Fatal("CompressStream failed:", err)
+	}
+
+	var decompressed bytes.Buffer
+	err = internal.DecompressStream(&compressed, &decompressed)
+	if err != nil {
+		t.Fatal("DecompressStream failed:", err)
+	}
+
+	if !bytes.Equal(decompressed.Bytes(), original) {
+		t.Error("Pipe round trip did not reproduce the input")
+	}
+}
+
+func TestStream_EmptyInput(t *testing.T) {
+	var compressed bytes.Buffer
+	err := internal.CompressStream(bytes.NewReader(nil), &compressed, 0)
+	if err != nil {
+		t.Fatal("CompressStream failed:", err)
+	}
+
+	// Stream header followed by the end-of-stream marker and the checksums
+	expectedLen := internal.StreamHeaderSize + 4 + internal.TrailerSize(internal.DefaultFlags)
+	if compressed.Len() != expectedLen {
+		t.Errorf("Expected %d bytes, got %d", expectedLen, compressed.Len())
+	}
+
+	var decompressed bytes.Buffer
+	err = internal.DecompressStream(&compressed, &decompressed)
+	if err != nil {
+		t.Fatal("DecompressStream failed:", err)
+	}
+	if decompressed.Len() != 0 {
+		t.Errorf("Expected empty output, got %d bytes", decompressed.Len())
+	}
+}
+
+func TestStream_MissingEndMarker(t *testing.T) {
+	var compressed bytes.Buffer
+	err := internal.CompressStream(strings.NewReader("no end marker here"), &compressed, 0)
+	if err != nil {
+		t.Fatal("CompressStream failed:", err)
+	}
+
+	trailerSize := internal.TrailerSize(internal.DefaultFlags)
+	truncated := compressed.Bytes()[:compressed.Len()-4-trailerSize]
+
+	err = internal.DecompressStream(bytes.NewReader(truncated), io.Discard)
+	if err == nil {
+		t.Fatal("Expected error for stream without end marker, got nil")
+	}
+}
+
+func TestStream_WriteAndReadBlock(t *testing.T) {
+	data := []byte("abracadabra")
+
+	var buffer bytes.Buffer
+	err := internal.WriteBlock(&buffer, data)
+	if err != nil {
+		t.Fatal("WriteBlock failed:", err)
+	}
+	err = internal.WriteEndOfStream(&buffer)
+	if err != nil {
+		t.Fatal("WriteEndOfStream failed:", err)
+	}
+
+	block, err := internal.ReadBlock(&buffer)
+	if err != nil {
+		t.Fatal("ReadBlock failed:", err)
+	}
+	if string(block) != string(data) {
+		t.Errorf("Block mismatch: got %q, want %q", block, data)
+	}
+
+	_, err = internal.ReadBlock(&buffer)
+	if err != io.EOF {
+		t.Errorf("Expected io.EOF at end marker, got %v", err)
+	}
+}
+
+func TestStream_EmptyBlockRejected(t *testing.T) {
+	var buffer bytes.Buffer
+	err := internal.WriteBlock(&buffer, nil)
+	if err == nil {
+		t.Fatal("Expected error for empty block, got nil")
+	}
+}
+
+func TestCompressFileBlocks_DecompressRoundTrip(t *testing.T) {
+	original := []byte(strings.Repeat("Hello, blocks! ", 300))
+	inputPath := "test_blocks_input.txt"
+	compressedPath := "test_blocks_input.hf"
+	outputPath := "test_blocks_output.txt"
+
+	err := os.WriteFile(inputPath, original, 0644)
+	if err != nil {
+		t.Fatal("Failed to create test file:", err)
+	}
+	defer os.Remove(inputPath)
+
+	err = internal.CompressFileBlocks(inputPath, compressedPath, 512, 0, internal.DefaultFlags)
+	if err != nil {
+		t.Fatal("Compression failed:", err)
+	}
+	defer os.Remove(compressedPath)
+
+	// Decompress detects the framed format from its magic number
+	err = internal.Decompress(compressedPath, outputPath)
+	if err != nil {
+		t.Fatal("Decompression failed:", err)
+	}
+	defer os.Remove(outputPath)
+
+	err = internal.VerifyDecompression(inputPath, outputPath)
+	if err != nil {
+		t.Fatal("Verification failed:", err)
+	}
+}
+
+func TestStream_UnsupportedVersion(t *testing.T) {
+	var compressed bytes.Buffer
+	err := internal.CompressStream(strings.NewReader("versioned"), &compressed, 0)
+	if err != nil {
+		t.Fatal("CompressStream failed:", err)
+	}
+
+	data := compressed.Bytes()
+	if data[2] != internal.StreamVersion {
+		t.Fatalf("Expected version byte %d, got %d", internal.StreamVersion, data[2])
+	}
+	data[2] = internal.StreamVersion + 1
+
+	err = internal.DecompressStream(bytes.NewReader(data), io.Discard)
+	var versionErr *internal.UnsupportedVersionError
+	if !errors.As(err, &versionErr) {
+		t.Fatalf("Expected UnsupportedVersionError, got %T: %v", err, err)
+	}
+}
+
+func TestStream_UnsupportedFlags(t *testing.T) {
+	var compressed bytes.Buffer
+	err := internal.CompressStream(strings.NewReader("flagged"), &compressed, 0)
+	if err != nil {
+		t.Fatal("CompressStream failed:", err)
+	}
+
+	data := compressed.Bytes()
+	data[3] = 0x80
+
+	err = internal.DecompressStream(bytes.NewReader(data), io.Discard)
+	var featureErr *internal.UnsupportedFeatureError
+	if !errors.As(err, &featureErr) {
+		t.Fatalf("Expected UnsupportedFeatureError, got %T: %v", err, err)
+	}
+}
@@ -0,0 +1,224 @@
+package test
+
+import (
+	"bytes"
+	"huffman-compressor/internal"
+	"os"
+	"testing"
+)
+
+// encodeWithTree compresses data with the codes of its own Huffman tree
+func encodeWithTree(t testing.TB, data []byte) ([]byte, *internal.HuffmanNode) {
+	t.Helper()
+
+	root, err := internal.BuildHuffmanTree(internal.CountFrequencies(data))
+	if err != nil {
+		t.Fatal("BuildHuffmanTree failed:", err)
+	}
+	codeTable := internal.GenerateCodes(root)
+
+	var encoded bytes.Buffer
+	bitBuffer := internal.NewBitBuffer(&encoded)
+	for _, char := range data {
+		code := codeTable[char]
+		bitBuffer.WriteBits(uint64(code.GetBits()), code.GetLength())
+	}
+	bitBuffer.Close()
+
+	return encoded.Bytes(), root
+}
+
+func decodeWithTree(t testing.TB, encoded []byte, root *internal.HuffmanNode, count int) []byte {
+	bitReader := internal.NewBitReader(bytes.NewReader(encoded))
+	decoded := make([]byte, count)
+	for i := range decoded {
+		char, err := internal.DecodeSymbol(bitReader, root)
+		if err != nil {
+			t.Fatalf("DecodeSymbol failed at %d: %v", i, err)
+		}
+		decoded[i] = char
+	}
+	return decoded
+}
+
+func decodeWithTable(t testing.TB, encoded []byte, decoder *internal.TableDecoder, count int) []byte {
+	bitReader := internal.NewBitReader(bytes.NewReader(encoded))
+	decoded := make([]byte, count)
+	for i := range decoded {
+		symbol, err := decoder.Decode(bitReader)
+		if err != nil {
+			t.Fatalf("Decode failed at %d: %v", i, err)
+		}
+		decoded[i] = byte(symbol)
+	}
+	return decoded
+}
+
+func loadSample(t testing.TB, size int) []byte {
+	t.Helper()
+
+	data, err := os.ReadFile("../test.txt")
+	if err != nil {
+		t.Skip("sample text not available:", err)
+	}
+	if len(data) > size {
+		data = data[:size]
+	}
+	return data
+}
+
+func TestTableDecoder_MatchesTreeWalk(t *testing.T) {
+	data := loadSample(t, 1<<18)
+	encoded, root := encodeWithTree(t, data)
+
+	decoder, err := internal.NewTableDecoderFromCodeTable(internal.GenerateCodes(root))
+	if err != nil {
+		t.Fatal("NewTableDecoderFromCodeTable failed:", err)
+	}
+
+	fromTree := decodeWithTree(t, encoded, root, len(data))
+	fromTable := decodeWithTable(t, encoded, decoder, len(data))
+
+	if !bytes.Equal(fromTree, fromTable) {
+		t.Fatal("Table decoder output differs from tree walking")
+	}
+	if !bytes.Equal(fromTable, data) {
+		t.Fatal("Table decoder did not reproduce the input")
+	}
+}
+
+func TestTableDecoder_LongCodesUseSubTables(t *testing.T) {
+	// Fibonacci frequencies give codes up to 19 bits, past the primary table
+	var data []byte
+	for char, freq := range fibonacciFrequencies(20) {
+		data = append(data, bytes.Repeat([]byte{char}, freq)...)
+	}
+
+	encoded, root := encodeWithTree(t, data)
+	if internal.TreeDepth(root) <= 10 {
+		t.Fatalf("Expected codes longer than the primary table, depth is %d", internal.TreeDepth(root))
+	}
+
+	decoder, err := internal.NewTableDecoderFromCodeTable(internal.GenerateCodes(root))
+	if err != nil {
+		t.Fatal("NewTableDecoderFromCodeTable failed:", err)
+	}
+
+	fromTable := decodeWithTable(t, encoded, decoder, len(data))
+	if !bytes.Equal(fromTable, data) {
+		t.Fatal("Table decoder failed on long codes")
+	}
+}
+
+func TestTableDecoder_RejectsTooLongCodes(t *testing.T) {
+	root, err := internal.BuildHuffmanTree(fibonacciFrequencies(30))
+	if err != nil {
+		t.Fatal("BuildHuffmanTree failed:", err)
+	}
+
+	_, err = internal.NewTableDecoderFromCodeTable(internal.GenerateCodes(root))
+	if err == nil {
+		t.Fatal("Expected error for codes longer than MaxTableCodeLength, got nil")
+	}
+
+	// The combined decoder falls back to walking the tree
+	var data []byte
+	for char, freq := range fibonacciFrequencies(27) {
+		data = append(data, bytes.Repeat([]byte{char}, freq)...)
+	}
+	encoded, root := encodeWithTree(t, data)
+	if internal.TreeDepth(root) <= internal.MaxTableCodeLength {
+		t.Fatalf("Expected depth above %d, got %d", internal.MaxTableCodeLength, internal.TreeDepth(root))
+	}
+
+	decoder := internal.NewDecoder(root)
+	bitReader := internal.NewBitReader(bytes.NewReader(encoded))
+	for i, want := range data {
+		got, err := decoder.DecodeByte(bitReader)
+		if err != nil {
+			t.Fatalf("DecodeByte failed at %d: %v", i, err)
+		}
+		if got != want {
+			t.Fatalf("Byte %d: expected %d, got %d", i, want, got)
+		}
+	}
+}
+
+func TestTableDecoder_InvalidCode(t *testing.T) {
+	// One symbol gets code "0", so a 1 bit has no meaning
+	lengths := make([]uint8, 256)
+	lengths['a'] = 1
+	codes, err := internal.CanonicalCodes(lengths)
+	if err != nil {
+		t.Fatal("CanonicalCodes failed:", err)
+	}
+
+	decoder, err := internal.NewTableDecoder(codes)
+	if err != nil {
+		t.Fatal("NewTableDecoder failed:", err)
+	}
+
+	bitReader := internal.NewBitReader(bytes.NewReader([]byte{0b01000000}))
+	symbol, err := decoder.Decode(bitReader)
+	if err != nil || symbol != 'a' {
+		t.Fatalf("Expected 'a', got %d (%v)", symbol, err)
+	}
+
+	_, err = decoder.Decode(bitReader)
+	if err == nil {
+		t.Fatal("Expected error for invalid code, got nil")
+	}
+}
+
+func TestBitReader_PeekAndSkip(t *testing.T) {
+	bitReader := internal.NewBitReader(bytes.NewReader([]byte{0b10110011, 0b01010101}))
+
+	bits, available := bitReader.PeekBits(4)
+	if bits != 0b1011 || available != 4 {
+		t.Fatalf("PeekBits(4) = %04b (%d bits), want 1011 (4 bits)", bits, available)
+	}
+
+	// Peeking again returns the same bits
+	bits, _ = bitReader.PeekBits(4)
+	if bits != 0b1011 {
+		t.Fatalf("Second PeekBits(4) = %04b, want 1011", bits)
+	}
+
+	bitReader.SkipBits(6)
+	bits, available = bitReader.PeekBits(12)
+	if bits != 0b110101010100 || available != 10 {
+		t.Fatalf("PeekBits(12) = %012b (%d bits), want 110101010100 (10 bits)", bits, available)
+	}
+
+	bit, err := bitReader.ReadBit()
+	if err != nil || bit != 1 {
+		t.Fatalf("ReadBit after SkipBits = %d (%v), want 1", bit, err)
+	}
+}
+
+func BenchmarkDecode_TreeWalk(b *testing.B) {
+	data := loadSample(b, 1<<20)
+	encoded, root := encodeWithTree(b, data)
+
+	b.SetBytes(int64(len(data)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		decodeWithTree(b, encoded, root, len(data))
+	}
+}
+
+func BenchmarkDecode_Table(b *testing.B) {
+	data := loadSample(b, 1<<20)
+	encoded, root := encodeWithTree(b, data)
+
+	decoder, err := internal.NewTableDecoderFromCodeTable(internal.GenerateCodes(root))
+	if err != nil {
+		b.Fatal("NewTableDecoderFromCodeTable failed:", err)
+	}
+
+	b.SetBytes(int64(len(data)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		decodeWithTable(b, encoded, decoder, len(data))
+	}
+}